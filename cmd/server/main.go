@@ -6,12 +6,14 @@ import (
 	"Goo/jobs"
 	"Goo/messaging"
 	"Goo/server"
+	"Goo/signing"
 	"Goo/storage"
 	"Goo/utils"
 	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
@@ -68,29 +70,69 @@ func start() int {
 	registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 	registry.MustRegister(collectors.NewGoCollector())
 
+	signingKey, ok := getSecret("SIGNING_KEY", "k7QeTnCw3UaPz9Rb", logEnv)
+	if !ok {
+		log.Info("SIGNING_KEY must be set outside development")
+		return 1
+	}
+	signer := signing.NewSigner(signingKey)
+	emailHashSalt, ok := getSecret("EMAIL_HASH_SALT", "Xs4pLq8vWn2cRj6t", logEnv)
+	if !ok {
+		log.Info("EMAIL_HASH_SALT must be set outside development")
+		return 1
+	}
 	queue := createQueue(log, awsConfig)
-	db := createDatabase(log, registry)
+	db := createDatabase(log, registry, emailHashSalt)
 	if err = db.Connect(); err != nil {
 		log.Info("Error connecting to database", zap.Error(err))
 		return 1
 	}
 
+	baseURL := utils.GetStringOrDefault("BASE_URL", fmt.Sprintf("http://%v:%v", host, port))
+	emailer := createEmailer(log, signer, db, baseURL)
+
+	trustedProxies, err := parseTrustedProxies(utils.GetStringsOrDefault("TRUSTED_PROXIES", nil))
+	if err != nil {
+		log.Info("Error parsing TRUSTED_PROXIES", zap.Error(err))
+		return 1
+	}
+
 	s := server.New(server.Options{
 		AdminPassword:   utils.GetStringOrDefault("ADMIN_PASSWORD", "eyDawVH9LLZtaG2q"),
+		BaseURL:         baseURL,
 		Database:        db,
+		Emailer:         emailer,
 		Host:            host,
 		Log:             log,
 		MetricsPassword: utils.GetStringOrDefault("METRICS_PASSWORD", "12345678"),
 		Metrics:         registry,
 		Port:            port,
 		Queue:           queue,
+		Signer:          signer,
+		TrustedProxies:  trustedProxies,
 	})
 
+	unconfirmedSignupRetentionDays := utils.GetIntOrDefault("UNCONFIRMED_SIGNUP_RETENTION_DAYS", 30)
+	if unconfirmedSignupRetentionDays <= 0 {
+		log.Info("UNCONFIRMED_SIGNUP_RETENTION_DAYS must be positive", zap.Int("days", unconfirmedSignupRetentionDays))
+		return 1
+	}
+
 	r := jobs.NewRunner(jobs.NewRunnerOptions{
-		Emailer: createEmailer(log, host, port),
+		Database: db,
+		Digest: jobs.DigestOptions{
+			FeedURLs: utils.GetStringsOrDefault("DIGEST_FEED_URLS", nil),
+			ListID:   utils.GetStringOrDefault("DIGEST_LIST", ""),
+			Subject:  utils.GetStringOrDefault("DIGEST_SUBJECT", ""),
+			AutoSend: utils.GetBoolOrDefault("DIGEST_AUTO_SEND", false),
+			Interval: utils.GetDurationOrDefault("DIGEST_INTERVAL", time.Hour),
+		},
+		Emailer: emailer,
 		Log:     log,
 		Metrics: registry,
 		Queue:   queue,
+
+		UnconfirmedSignupRetentionDays: unconfirmedSignupRetentionDays,
 	})
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
@@ -126,6 +168,33 @@ func start() int {
 	return 0
 }
 
+// getSecret from the environment variable with the given name. The default is public, so it's only used
+// in development, and the bool is false if the variable is not set in other environments.
+func getSecret(name, developmentDefault, logEnv string) (string, bool) {
+	if logEnv == "development" {
+		return utils.GetStringOrDefault(name, developmentDefault), true
+	}
+	secret := utils.GetStringOrDefault(name, "")
+	return secret, secret != ""
+}
+
+// parseTrustedProxies from IP addresses or CIDR prefixes like 10.0.0.0/8.
+func parseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
 func createLogger(env string) (*zap.Logger, error) {
 	switch env {
 	case "production":
@@ -164,7 +233,7 @@ func createAWSEndpointResolver() aws.EndpointResolverWithOptionsFunc {
 	}
 }
 
-func createDatabase(log *zap.Logger, registry *prometheus.Registry) *storage.Database {
+func createDatabase(log *zap.Logger, registry *prometheus.Registry, emailHashSalt string) *storage.Database {
 	return storage.NewDatabase(storage.NewDatabaseOptions{
 		Host:                  utils.GetStringOrDefault("DB_HOST", "localhost"),
 		Port:                  utils.GetIntOrDefault("DB_PORT", 5432),
@@ -176,6 +245,10 @@ func createDatabase(log *zap.Logger, registry *prometheus.Registry) *storage.Dat
 		ConnectionMaxLifetime: utils.GetDurationOrDefault("DB_CONNECTION_MAX_LIFETIME", time.Hour),
 		Log:                   log,
 		Metrics:               registry,
+
+		ConfirmationResendInterval: utils.GetDurationOrDefault("CONFIRMATION_RESEND_INTERVAL", 5*time.Minute),
+		ConfirmationTokenTTL:       utils.GetDurationOrDefault("CONFIRMATION_TOKEN_TTL", 48*time.Hour),
+		EmailHashSalt:              emailHashSalt,
 	})
 }
 
@@ -188,9 +261,9 @@ func createQueue(log *zap.Logger, awsConfig aws.Config) *messaging.Queue {
 	})
 }
 
-func createEmailer(log *zap.Logger, host string, port int) *messaging.Emailer {
+func createEmailer(log *zap.Logger, signer *signing.Signer, db *storage.Database, baseURL string) *messaging.Emailer {
 	return messaging.NewEmailer(messaging.NewEmailerOptions{
-		BaseURL:                   utils.GetStringOrDefault("BASE_URL", fmt.Sprintf("http://%v:%v", host, port)),
+		BaseURL:                   baseURL,
 		Host:                      utils.GetStringOrDefault("EMAIL_HOST", "localhost"),
 		Port:                      utils.GetIntOrDefault("EMAIL_PORT", 1025),
 		MarketingUsername:         utils.GetStringOrDefault("MARKETING_USERNAME", "Goo bot"),
@@ -202,5 +275,7 @@ func createEmailer(log *zap.Logger, host string, port int) *messaging.Emailer {
 		TransactionalEmailAddress: utils.GetStringOrDefault("TRANSACTIONAL_EMAIL", "goo.transactional@example.com"),
 		TransactionalEmailName:    utils.GetStringOrDefault("TRANSACTIONAL_EMAIL_NAME", ""),
 		Log:                       log,
+		Signer:                    signer,
+		Suppressions:              db,
 	})
 }
@@ -0,0 +1,189 @@
+// Package feeds reads RSS and Atom feeds.
+package feeds
+
+import (
+	"Goo/model"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxFeedSize is how many bytes of a feed are read.
+const maxFeedSize = 5 << 20
+
+type Reader struct {
+	client *http.Client
+}
+
+type NewReaderOptions struct {
+	// Client is optional, and defaults to one with a 10 second timeout.
+	Client *http.Client
+}
+
+func NewReader(opts NewReaderOptions) *Reader {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Reader{client: opts.Client}
+}
+
+// Read the items of the RSS or Atom feed at the URL.
+func (r *Reader) Read(ctx context.Context, url string) ([]model.FeedItem, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", res.StatusCode)
+	}
+
+	items, err := Parse(io.LimitReader(res.Body, maxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].FeedURL = url
+	}
+	return items, nil
+}
+
+type rssFeed struct {
+	Items []struct {
+		GUID        string `xml:"guid"`
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		PubDate     string `xml:"pubDate"`
+	} `xml:"channel>item"`
+}
+
+type atomFeed struct {
+	Entries []struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// Parse an RSS 2.0 or Atom feed into items, in the order of the feed.
+// Items without a GUID or link are skipped, and summaries are turned into plain text.
+func Parse(r io.Reader) ([]model.FeedItem, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error parsing feed: %w", err)
+	}
+
+	var items []model.FeedItem
+	switch root.XMLName.Local {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("error parsing RSS feed: %w", err)
+		}
+		for _, i := range feed.Items {
+			item := model.FeedItem{
+				GUID:      strings.TrimSpace(i.GUID),
+				Title:     strings.TrimSpace(i.Title),
+				Link:      strings.TrimSpace(i.Link),
+				Summary:   toText(i.Description),
+				Published: parseTime(i.PubDate, time.RFC1123Z, time.RFC1123),
+			}
+			if item.GUID == "" {
+				item.GUID = item.Link
+			}
+			items = append(items, item)
+		}
+
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("error parsing Atom feed: %w", err)
+		}
+		for _, e := range feed.Entries {
+			item := model.FeedItem{
+				GUID:      strings.TrimSpace(e.ID),
+				Title:     strings.TrimSpace(e.Title),
+				Summary:   toText(e.Summary),
+				Published: parseTime(e.Published, time.RFC3339),
+			}
+			if item.Summary == "" {
+				item.Summary = toText(e.Content)
+			}
+			if item.Published == nil {
+				item.Published = parseTime(e.Updated, time.RFC3339)
+			}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.Link = strings.TrimSpace(l.Href)
+					break
+				}
+			}
+			items = append(items, item)
+		}
+
+	default:
+		return nil, errors.New("not an RSS or Atom feed")
+	}
+
+	var withGUIDs []model.FeedItem
+	for _, item := range items {
+		if item.GUID != "" {
+			withGUIDs = append(withGUIDs, item)
+		}
+	}
+	return withGUIDs, nil
+}
+
+func parseTime(value string, layouts ...string) *time.Time {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+var tagMatcher = regexp.MustCompile(`<[^>]*>`)
+
+// maxSummaryLength in characters, after which summaries are cut off.
+const maxSummaryLength = 300
+
+// toText from HTML, removing tags and collapsing whitespace, and cutting it off if it's too long.
+func toText(s string) string {
+	s = html.UnescapeString(tagMatcher.ReplaceAllString(s, " "))
+	s = strings.Join(strings.Fields(s), " ")
+	if runes := []rune(s); len(runes) > maxSummaryLength {
+		s = strings.TrimSpace(string(runes[:maxSummaryLength])) + "…"
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package feeds_test
+
+import (
+	"Goo/feeds"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const rss = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+  <title>Goo blog</title>
+  <item>
+    <title>Hello, Go</title>
+    <link>https://example.com/hello</link>
+    <guid>https://example.com/?p=1</guid>
+    <description>&lt;p&gt;Say &lt;b&gt;hello&lt;/b&gt; &amp;amp; wave.&lt;/p&gt;</description>
+    <pubDate>Mon, 02 Mar 2026 09:00:00 +0000</pubDate>
+  </item>
+  <item>
+    <title>No guid</title>
+    <link>https://example.com/no-guid</link>
+  </item>
+  <item>
+    <title>Nothing to identify it by</title>
+  </item>
+</channel>
+</rss>`
+
+const atom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Goo blog</title>
+  <entry>
+    <id>urn:uuid:1</id>
+    <title>Hello, Atom</title>
+    <link rel="self" href="https://example.com/feed/1"/>
+    <link href="https://example.com/atom"/>
+    <content type="html">&lt;p&gt;Content only&lt;/p&gt;</content>
+    <updated>2026-03-02T09:00:00Z</updated>
+  </entry>
+</feed>`
+
+func TestReader_Read(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rss", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(rss))
+	})
+	mux.HandleFunc("/atom", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(atom))
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><body>Not a feed</body></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	r := feeds.NewReader(feeds.NewReaderOptions{})
+
+	t.Run("reads RSS items, falling back to the link for the GUID", func(t *testing.T) {
+		items, err := r.Read(context.Background(), server.URL+"/rss")
+		require.NoError(t, err)
+		require.Equal(t, 2, len(items))
+
+		require.Equal(t, server.URL+"/rss", items[0].FeedURL)
+		require.Equal(t, "https://example.com/?p=1", items[0].GUID)
+		require.Equal(t, "Hello, Go", items[0].Title)
+		require.Equal(t, "https://example.com/hello", items[0].Link)
+		require.Equal(t, "Say hello & wave.", items[0].Summary)
+		require.NotNil(t, items[0].Published)
+		require.True(t, time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC).Equal(*items[0].Published))
+
+		require.Equal(t, "https://example.com/no-guid", items[1].GUID)
+		require.Nil(t, items[1].Published)
+	})
+
+	t.Run("reads Atom entries with their alternate link", func(t *testing.T) {
+		items, err := r.Read(context.Background(), server.URL+"/atom")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(items))
+		require.Equal(t, "urn:uuid:1", items[0].GUID)
+		require.Equal(t, "https://example.com/atom", items[0].Link)
+		require.Equal(t, "Content only", items[0].Summary)
+		require.NotNil(t, items[0].Published)
+	})
+
+	t.Run("errors on other documents and bad responses", func(t *testing.T) {
+		_, err := r.Read(context.Background(), server.URL+"/html")
+		require.Error(t, err)
+		_, err = r.Read(context.Background(), server.URL+"/missing")
+		require.Error(t, err)
+	})
+}
+
+func TestParse(t *testing.T) {
+	t.Run("cuts off long summaries", func(t *testing.T) {
+		items, err := feeds.Parse(strings.NewReader(`<rss><channel><item><guid>1</guid><description>` +
+			strings.Repeat("word ", 100) + `</description></item></channel></rss>`))
+		require.NoError(t, err)
+		require.LessOrEqual(t, len([]rune(items[0].Summary)), 301)
+		require.True(t, strings.HasSuffix(items[0].Summary, "…"))
+	})
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"Goo/model"
+	"Goo/views"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxArchiveIssues on the archive page.
+	maxArchiveIssues = 500
+	// maxFeedIssues in the archive feed.
+	maxFeedIssues = 20
+	// maxFrontPageIssues on the front page.
+	maxFrontPageIssues = 5
+)
+
+type sentCampaignGetter interface {
+	GetSentCampaigns(ctx context.Context, listID string, limit int) ([]model.Campaign, error)
+}
+
+type archiveListGetter interface {
+	GetList(ctx context.Context, id string) (*model.List, error)
+}
+
+type archiveGetter interface {
+	sentCampaignGetter
+	archiveListGetter
+	GetCampaign(ctx context.Context, id int) (*model.Campaign, error)
+}
+
+type feedGetter interface {
+	sentCampaignGetter
+	archiveListGetter
+}
+
+type publicEmailRenderer interface {
+	PublicCampaignEmail(c model.Campaign) model.EmailPreview
+}
+
+// NewsletterArchive lists the campaigns sent to the list in the path, or the default list, most recent first,
+// and shows each of them at its slug, with personalization removed. See model.ArchivePath and model.CampaignSlug.
+func NewsletterArchive(mux chi.Router, g archiveGetter, p publicEmailRenderer, log *zap.Logger) {
+	archiveHandler := func(w http.ResponseWriter, r *http.Request) {
+		list, ok := getArchiveList(w, r, g, log)
+		if !ok {
+			return
+		}
+
+		issues, err := getIssues(r.Context(), g, p, list.ID, maxArchiveIssues)
+		if err != nil {
+			log.Info("Error getting archive issues", zap.Error(err))
+			http.Error(w, "error getting archive, refresh to try again", http.StatusBadGateway)
+			return
+		}
+
+		template, err := views.NewsletterArchivePage("/newsletter/archive")
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		err = template.Execute(w, map[string]interface{}{
+			"archive_path": model.ArchivePath(list.ID),
+			"issues":       issues,
+			"list":         list,
+			"signup":       list.ID == model.DefaultListID,
+		})
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	issueHandler := func(w http.ResponseWriter, r *http.Request) {
+		id, ok := model.ParseCampaignSlug(chi.URLParam(r, "slug"))
+		if !ok {
+			http.Error(w, "no such issue", http.StatusNotFound)
+			return
+		}
+
+		list, ok := getArchiveList(w, r, g, log)
+		if !ok {
+			return
+		}
+
+		campaign, err := g.GetCampaign(r.Context(), id)
+		if err != nil {
+			log.Info("Error getting campaign", zap.Error(err))
+			http.Error(w, "error getting issue, refresh to try again", http.StatusBadGateway)
+			return
+		}
+		if campaign == nil || campaign.Status != model.CampaignSent || campaign.ListID != list.ID {
+			http.Error(w, "no such issue", http.StatusNotFound)
+			return
+		}
+
+		archivePath := model.ArchivePath(list.ID)
+		issue := newIssue(*campaign, p)
+		// Links to the issue with an old subject or without one go to the current slug
+		if issue.Slug != chi.URLParam(r, "slug") {
+			http.Redirect(w, r, archivePath+"/"+issue.Slug, http.StatusMovedPermanently)
+			return
+		}
+		// Links in the issue open outside the frame it's shown in
+		issue.HTML = addBaseTarget(issue.HTML)
+
+		template, err := views.NewsletterIssuePage("/newsletter/archive/issue")
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		err = template.Execute(w, map[string]interface{}{
+			"archive_path": archivePath,
+			"issue":        issue,
+			"list":         list,
+			"signup":       list.ID == model.DefaultListID,
+		})
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	mux.Get("/newsletter/archive", archiveHandler)
+	mux.Get("/newsletter/{list}/archive", archiveHandler)
+	mux.Get("/newsletter/archive/{slug}", issueHandler)
+	mux.Get("/newsletter/{list}/archive/{slug}", issueHandler)
+}
+
+// NewsletterArchiveFeed of the latest campaigns sent to the list in the path, or the default list,
+// as an Atom feed linking to the archive pages under the base URL.
+func NewsletterArchiveFeed(mux chi.Router, g feedGetter, p publicEmailRenderer, baseURL string, log *zap.Logger) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		list, ok := getArchiveList(w, r, g, log)
+		if !ok {
+			return
+		}
+
+		issues, err := getIssues(r.Context(), g, p, list.ID, maxFeedIssues)
+		if err != nil {
+			log.Info("Error getting archive issues", zap.Error(err))
+			http.Error(w, "error getting feed", http.StatusBadGateway)
+			return
+		}
+
+		feed, err := views.ArchiveFeed(baseURL+model.ArchivePath(list.ID), "Goo "+list.Name, issues, time.Now())
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		_, _ = w.Write(feed)
+	}
+
+	mux.Get("/newsletter/archive.atom", handler)
+	mux.Get("/newsletter/{list}/archive.atom", handler)
+}
+
+// getArchiveList from the path, or the default list if there is none, writing an error response
+// if there is no such list.
+func getArchiveList(w http.ResponseWriter, r *http.Request, g archiveListGetter, log *zap.Logger) (*model.List, bool) {
+	listID := chi.URLParam(r, "list")
+	if listID == "" {
+		listID = model.DefaultListID
+	}
+
+	list, err := g.GetList(r.Context(), listID)
+	if err != nil {
+		log.Info("Error getting list", zap.Error(err))
+		http.Error(w, "error getting archive, refresh to try again", http.StatusBadGateway)
+		return nil, false
+	}
+	if list == nil {
+		http.Error(w, "no such list", http.StatusNotFound)
+		return nil, false
+	}
+	return list, true
+}
+
+// getIssues of the list, most recently sent first and up to the limit.
+func getIssues(ctx context.Context, g sentCampaignGetter, p publicEmailRenderer, listID string, limit int) ([]model.Issue, error) {
+	campaigns, err := g.GetSentCampaigns(ctx, listID, limit)
+	if err != nil {
+		return nil, err
+	}
+	var issues []model.Issue
+	for _, c := range campaigns {
+		issues = append(issues, newIssue(c, p))
+	}
+	return issues, nil
+}
+
+// newIssue from the sent campaign, with personalization removed.
+func newIssue(c model.Campaign, p publicEmailRenderer) model.Issue {
+	email := p.PublicCampaignEmail(c)
+	issue := model.Issue{
+		Slug:    model.CampaignSlug(c.ID, email.Subject),
+		Subject: email.Subject,
+		HTML:    email.HTML,
+		Text:    email.Text,
+	}
+	if c.Sent != nil {
+		issue.Sent = *c.Sent
+	}
+	return issue
+}
+
+// addBaseTarget to the HTML document, so links open in a new window.
+func addBaseTarget(html string) string {
+	const base = `<base target="_blank">`
+	if html == "" {
+		return ""
+	}
+	if strings.Contains(html, "<head>") {
+		return strings.Replace(html, "<head>", "<head>"+base, 1)
+	}
+	return base + html
+}
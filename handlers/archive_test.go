@@ -0,0 +1,167 @@
+package handlers_test
+
+import (
+	"Goo/handlers"
+	"Goo/model"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type archiveMock struct {
+	campaigns []model.Campaign
+}
+
+func (a *archiveMock) GetSentCampaigns(_ context.Context, listID string, limit int) ([]model.Campaign, error) {
+	var campaigns []model.Campaign
+	for _, c := range a.campaigns {
+		if c.ListID == listID && c.Status == model.CampaignSent && len(campaigns) < limit {
+			campaigns = append(campaigns, c)
+		}
+	}
+	return campaigns, nil
+}
+
+func (a *archiveMock) GetCampaign(_ context.Context, id int) (*model.Campaign, error) {
+	for _, c := range a.campaigns {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (a *archiveMock) GetList(_ context.Context, id string) (*model.List, error) {
+	switch id {
+	case "newsletter":
+		return &model.List{ID: id, Name: "Newsletter"}, nil
+	case "golang":
+		return &model.List{ID: id, Name: "Go"}, nil
+	default:
+		return nil, nil
+	}
+}
+
+type publicEmailRendererMock struct{}
+
+func (p *publicEmailRendererMock) PublicCampaignEmail(c model.Campaign) model.EmailPreview {
+	return model.EmailPreview{
+		Subject: strings.ReplaceAll(c.Subject, "{{first_name}}", ""),
+		HTML:    strings.ReplaceAll(c.HTML, "{{first_name}}", ""),
+		Text:    strings.ReplaceAll(c.Text, "{{first_name}}", ""),
+	}
+}
+
+func newArchiveMock() *archiveMock {
+	sent := time.Date(2022, 11, 1, 9, 0, 0, 0, time.UTC)
+	return &archiveMock{campaigns: []model.Campaign{
+		{ID: 3, ListID: "newsletter", Subject: "Hello {{first_name}}", Status: model.CampaignSent, Sent: &sent,
+			HTML: `<html><head></head><body><p>Hi {{first_name}} & "you"</p></body></html>`},
+		{ID: 2, ListID: "newsletter", Subject: "Text only", Status: model.CampaignSent, Sent: &sent, Text: "Just <text>"},
+		{ID: 4, ListID: "newsletter", Subject: "Draft", Status: model.CampaignDraft, Text: "Hi"},
+		{ID: 5, ListID: "golang", Subject: "Other list", Status: model.CampaignSent, Sent: &sent, Text: "Hi"},
+	}}
+}
+
+func TestNewsletterArchive(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.NewsletterArchive(mux, newArchiveMock(), &publicEmailRendererMock{}, zap.NewNop())
+
+	t.Run("lists sent issues of the default list", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/newsletter/archive")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `<a href="/newsletter/archive/3-hello" class="text-blue-700 underline">Hello </a>`)
+		require.Contains(t, body, `/newsletter/archive/2-text-only`)
+		require.Contains(t, body, "November 1, 2022")
+		require.NotContains(t, body, "Draft")
+		require.NotContains(t, body, "Other list")
+		require.Contains(t, body, `<a href="/" class="underline">Sign up</a>`)
+	})
+
+	t.Run("lists sent issues of another list", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/newsletter/golang/archive")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, "<title>Go archive</title>")
+		require.Contains(t, body, `<a href="/newsletter/golang/archive/5-other-list" class="text-blue-700 underline">Other list</a>`)
+		require.Contains(t, body, `href="/newsletter/golang/archive.atom"`)
+		require.NotContains(t, body, "Hello")
+		require.NotContains(t, body, "Sign up")
+	})
+
+	t.Run("shows an issue of another list", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/newsletter/golang/archive/5-other-list")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `<a href="/newsletter/golang/archive" class="underline">Go archive</a>`)
+	})
+
+	t.Run("returns 404 for lists that do not exist", func(t *testing.T) {
+		code, _, _ := makeGetRequest(mux, "/newsletter/rust/archive")
+		require.Equal(t, http.StatusNotFound, code)
+		code, _, _ = makeGetRequest(mux, "/newsletter/rust/archive/5-other-list")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("shows an issue without personalization", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/newsletter/archive/3-hello")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `srcdoc="&lt;html&gt;&lt;head&gt;&lt;base target=&#34;_blank&#34;&gt;&lt;/head&gt;&lt;body&gt;&lt;p&gt;Hi  &amp; &#34;you&#34;&lt;/p&gt;`)
+		require.NotContains(t, body, "first_name")
+	})
+
+	t.Run("shows a text-only issue", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/newsletter/archive/2-text-only")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, "Just &lt;text&gt;")
+		require.NotContains(t, body, "<iframe")
+	})
+
+	t.Run("redirects to the current slug", func(t *testing.T) {
+		code, header, _ := makeGetRequest(mux, "/newsletter/archive/3-old-subject")
+		require.Equal(t, http.StatusMovedPermanently, code)
+		require.Equal(t, "/newsletter/archive/3-hello", header.Get("Location"))
+	})
+
+	t.Run("returns 404 for issues that are not sent to the default list", func(t *testing.T) {
+		for _, slug := range []string{"1-missing", "4-draft", "5-other-list", "hello"} {
+			code, _, _ := makeGetRequest(mux, "/newsletter/archive/"+slug)
+			require.Equal(t, http.StatusNotFound, code, slug)
+		}
+		code, _, _ := makeGetRequest(mux, "/newsletter/golang/archive/3-hello")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestNewsletterArchiveFeed(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.NewsletterArchiveFeed(mux, newArchiveMock(), &publicEmailRendererMock{}, "http://localhost:8080", zap.NewNop())
+
+	t.Run("has an entry for each sent issue", func(t *testing.T) {
+		code, header, body := makeGetRequest(mux, "/newsletter/archive.atom")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "application/atom+xml; charset=utf-8", header.Get("Content-Type"))
+		require.Contains(t, body, `<feed xmlns="http://www.w3.org/2005/Atom">`)
+		require.Contains(t, body, `<updated>2022-11-01T09:00:00Z</updated>`)
+		require.Contains(t, body, `<id>http://localhost:8080/newsletter/archive/3-hello</id>`)
+		require.Contains(t, body, `<content type="html">&lt;html&gt;&lt;head&gt;&lt;/head&gt;&lt;body&gt;&lt;p&gt;Hi  &amp; &#34;you&#34;&lt;/p&gt;`)
+		require.Contains(t, body, `<content type="text">Just &lt;text&gt;</content>`)
+		require.Equal(t, 2, strings.Count(body, "<entry>"))
+		require.Contains(t, body, `<title>Goo Newsletter</title>`)
+	})
+
+	t.Run("has a feed for each list", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/newsletter/golang/archive.atom")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `<title>Goo Go</title>`)
+		require.Contains(t, body, `<id>http://localhost:8080/newsletter/golang/archive/5-other-list</id>`)
+		require.Equal(t, 1, strings.Count(body, "<entry>"))
+
+		code, _, _ = makeGetRequest(mux, "/newsletter/rust/archive.atom")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
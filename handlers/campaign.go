@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"Goo/messaging"
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type campaignCreator interface {
+	CreateCampaign(ctx context.Context, c model.Campaign) (model.Campaign, error)
+}
+
+// CreateCampaign draft from a JSON body with list_id, subject, html, text and from, and return it as JSON.
+// Instead of html and text, the content can be written in markdown, which is rendered into the branded layout.
+// A/B test variants can use markdown the same way.
+// The list defaults to the default list, and an empty from means the default marketing address.
+// An optional segment_id of a segment on the list targets the campaign at it, and an optional local_send_time
+// like 09:00 delivers it at that time in the timezone of each recipient.
+func CreateCampaign(mux chi.Router, c campaignCreator, log *zap.Logger) {
+	mux.Post("/campaigns", func(w http.ResponseWriter, r *http.Request) {
+		campaign, ok := decodeCampaign(w, r)
+		if !ok {
+			return
+		}
+
+		campaign, err := c.CreateCampaign(r.Context(), campaign)
+		if errors.Is(err, model.ErrSegmentNotFound) {
+			http.Error(w, "no such segment on the list", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Info("Error creating campaign", zap.Error(err))
+			http.Error(w, "error creating campaign", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusCreated, campaign)
+	})
+}
+
+type campaignGetter interface {
+	GetCampaign(ctx context.Context, id int) (*model.Campaign, error)
+	GetCampaigns(ctx context.Context) ([]model.Campaign, error)
+}
+
+// Campaigns as JSON, newest first.
+func Campaigns(mux chi.Router, g campaignGetter, log *zap.Logger) {
+	mux.Get("/campaigns", func(w http.ResponseWriter, r *http.Request) {
+		campaigns, err := g.GetCampaigns(r.Context())
+		if err != nil {
+			log.Info("Error getting campaigns", zap.Error(err))
+			http.Error(w, "error getting campaigns", http.StatusBadGateway)
+			return
+		}
+		if campaigns == nil {
+			campaigns = []model.Campaign{}
+		}
+		writeJSON(w, http.StatusOK, campaigns)
+	})
+}
+
+// Campaign with the ID in the path as JSON.
+func Campaign(mux chi.Router, g campaignGetter, log *zap.Logger) {
+	mux.Get("/campaigns/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := getCampaignID(w, r)
+		if !ok {
+			return
+		}
+
+		campaign, err := g.GetCampaign(r.Context(), id)
+		if err != nil {
+			log.Info("Error getting campaign", zap.Error(err))
+			http.Error(w, "error getting campaign", http.StatusBadGateway)
+			return
+		}
+		if campaign == nil {
+			http.Error(w, "no such campaign", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, campaign)
+	})
+}
+
+type campaignUpdater interface {
+	UpdateCampaignDraft(ctx context.Context, c model.Campaign) (*model.Campaign, error)
+}
+
+// UpdateCampaign draft with the ID in the path from a JSON body like in CreateCampaign, and return it as JSON.
+// Campaigns that are not drafts cannot be changed.
+func UpdateCampaign(mux chi.Router, u campaignUpdater, log *zap.Logger) {
+	mux.Put("/campaigns/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := getCampaignID(w, r)
+		if !ok {
+			return
+		}
+		campaign, ok := decodeCampaign(w, r)
+		if !ok {
+			return
+		}
+		campaign.ID = id
+
+		updated, err := u.UpdateCampaignDraft(r.Context(), campaign)
+		if errors.Is(err, model.ErrCampaignNotEditable) {
+			http.Error(w, "campaign is not a draft", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, model.ErrSegmentNotFound) {
+			http.Error(w, "no such segment on the list", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Info("Error updating campaign", zap.Error(err))
+			http.Error(w, "error updating campaign", http.StatusBadGateway)
+			return
+		}
+		if updated == nil {
+			http.Error(w, "no such campaign", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+	})
+}
+
+type campaignDeleter interface {
+	DeleteCampaignDraft(ctx context.Context, id int) (bool, error)
+}
+
+// DeleteCampaign draft with the ID in the path. Campaigns that are not drafts cannot be deleted.
+func DeleteCampaign(mux chi.Router, d campaignDeleter, log *zap.Logger) {
+	mux.Delete("/campaigns/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := getCampaignID(w, r)
+		if !ok {
+			return
+		}
+
+		deleted, err := d.DeleteCampaignDraft(r.Context(), id)
+		if errors.Is(err, model.ErrCampaignNotEditable) {
+			http.Error(w, "campaign is not a draft", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Info("Error deleting campaign", zap.Error(err))
+			http.Error(w, "error deleting campaign", http.StatusBadGateway)
+			return
+		}
+		if !deleted {
+			http.Error(w, "no such campaign", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type campaignSendStarter interface {
+	StartSendingCampaign(ctx context.Context, id int) (*model.Campaign, error)
+}
+
+// SendCampaign with the ID in the path to all confirmed subscribers on its list or segment, and return it as JSON.
+// Sending is started again for campaigns that are being sent already, which picks up where it left off.
+func SendCampaign(mux chi.Router, s campaignSendStarter, q sender, log *zap.Logger) {
+	mux.Post("/campaigns/{id}/send", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := getCampaignID(w, r)
+		if !ok {
+			return
+		}
+
+		campaign, err := s.StartSendingCampaign(r.Context(), id)
+		if errors.Is(err, model.ErrCampaignNotEditable) {
+			http.Error(w, "campaign cannot be sent", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Info("Error starting to send campaign", zap.Error(err))
+			http.Error(w, "error sending campaign", http.StatusBadGateway)
+			return
+		}
+		if campaign == nil {
+			http.Error(w, "no such campaign", http.StatusNotFound)
+			return
+		}
+
+		if err := q.Send(r.Context(), model.NewCampaignMessage("send_campaign", id)); err != nil {
+			log.Info("Error sending campaign message", zap.Error(err))
+			http.Error(w, "error sending campaign, try again", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, campaign)
+	})
+}
+
+// maxTestEmails is how many seed addresses a test send can have.
+const maxTestEmails = 20
+
+// SendCampaignTest with the ID in the path to the seed addresses from a JSON body with emails,
+// queueing a test email for each. Test emails have model.TestSubjectMarker in front of the subject,
+// and are not recorded as deliveries. Campaigns can be tested in any status.
+func SendCampaignTest(mux chi.Router, g campaignGetter, q sender, log *zap.Logger) {
+	mux.Post("/campaigns/{id}/test", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := getCampaignID(w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Emails []model.Email `json:"emails"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+			http.Error(w, "bad JSON", http.StatusBadRequest)
+			return
+		}
+		if len(body.Emails) == 0 || len(body.Emails) > maxTestEmails {
+			http.Error(w, "emails must have between 1 and "+strconv.Itoa(maxTestEmails)+" addresses", http.StatusBadRequest)
+			return
+		}
+		for _, email := range body.Emails {
+			if !email.IsValid() {
+				http.Error(w, "email is invalid: "+email.String(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		campaign, err := g.GetCampaign(r.Context(), id)
+		if err != nil {
+			log.Info("Error getting campaign", zap.Error(err))
+			http.Error(w, "error getting campaign", http.StatusBadGateway)
+			return
+		}
+		if campaign == nil {
+			http.Error(w, "no such campaign", http.StatusNotFound)
+			return
+		}
+
+		for _, email := range body.Emails {
+			m := model.NewCampaignMessage("campaign_test_email", id)
+			m["email"] = email.String()
+			if err := q.Send(r.Context(), m); err != nil {
+				log.Info("Error sending campaign test email message", zap.Error(err))
+				http.Error(w, "error sending test emails, try again", http.StatusBadGateway)
+				return
+			}
+		}
+		writeJSON(w, http.StatusAccepted, map[string]int{"queued": len(body.Emails)})
+	})
+}
+
+type campaignScheduler interface {
+	ScheduleCampaign(ctx context.Context, id int, sendAt time.Time) (*model.Campaign, error)
+	UnscheduleCampaign(ctx context.Context, id int) (*model.Campaign, error)
+}
+
+// ScheduleCampaign with the ID in the path to start sending at the time from a JSON body with send_at,
+// and return it as JSON. Scheduling a scheduled campaign again reschedules it, until it starts sending.
+func ScheduleCampaign(mux chi.Router, s campaignScheduler, log *zap.Logger) {
+	mux.Post("/campaigns/{id}/schedule", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := getCampaignID(w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			SendAt time.Time `json:"send_at"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+			http.Error(w, "bad JSON", http.StatusBadRequest)
+			return
+		}
+		if !body.SendAt.After(time.Now()) {
+			http.Error(w, "send_at must be in the future", http.StatusBadRequest)
+			return
+		}
+
+		campaign, err := s.ScheduleCampaign(r.Context(), id, body.SendAt)
+		if errors.Is(err, model.ErrCampaignNotEditable) {
+			http.Error(w, "campaign cannot be scheduled", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Info("Error scheduling campaign", zap.Error(err))
+			http.Error(w, "error scheduling campaign", http.StatusBadGateway)
+			return
+		}
+		if campaign == nil {
+			http.Error(w, "no such campaign", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, campaign)
+	})
+}
+
+// UnscheduleCampaign with the ID in the path, moving it back to a draft, and return it as JSON.
+// Campaigns that have started sending cannot be unscheduled.
+func UnscheduleCampaign(mux chi.Router, s campaignScheduler, log *zap.Logger) {
+	mux.Delete("/campaigns/{id}/schedule", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := getCampaignID(w, r)
+		if !ok {
+			return
+		}
+
+		campaign, err := s.UnscheduleCampaign(r.Context(), id)
+		if errors.Is(err, model.ErrCampaignNotEditable) {
+			http.Error(w, "campaign is not scheduled", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Info("Error unscheduling campaign", zap.Error(err))
+			http.Error(w, "error unscheduling campaign", http.StatusBadGateway)
+			return
+		}
+		if campaign == nil {
+			http.Error(w, "no such campaign", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, campaign)
+	})
+}
+
+type campaignPauser interface {
+	PauseCampaign(ctx context.Context, id int) (*model.Campaign, error)
+	ResumeCampaign(ctx context.Context, id int) (*model.Campaign, error)
+	CancelCampaign(ctx context.Context, id int) (*model.Campaign, error)
+}
+
+// PauseCampaign with the ID in the path that is being sent, and return it as JSON.
+// Emails that are being sent already still go out, but no more are sent until the campaign is resumed.
+func PauseCampaign(mux chi.Router, p campaignPauser, log *zap.Logger) {
+	mux.Post("/campaigns/{id}/pause", func(w http.ResponseWriter, r *http.Request) {
+		campaign, ok := changeCampaignStatus(w, r, p.PauseCampaign, "campaign is not being sent", log)
+		if ok {
+			writeJSON(w, http.StatusOK, campaign)
+		}
+	})
+}
+
+// ResumeCampaign with the ID in the path that is paused, and return it as JSON.
+// Sending is started again, which queues any recipients left and finishes the campaign.
+func ResumeCampaign(mux chi.Router, p campaignPauser, q sender, log *zap.Logger) {
+	mux.Post("/campaigns/{id}/resume", func(w http.ResponseWriter, r *http.Request) {
+		campaign, ok := changeCampaignStatus(w, r, p.ResumeCampaign, "campaign is not paused", log)
+		if !ok {
+			return
+		}
+		if err := q.Send(r.Context(), model.NewCampaignMessage("send_campaign", campaign.ID)); err != nil {
+			log.Info("Error sending campaign message", zap.Error(err))
+			http.Error(w, "error resuming campaign, try again", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusOK, campaign)
+	})
+}
+
+// CancelCampaign with the ID in the path that is being sent or paused, and return it as JSON.
+// Recipients that have not been sent to are skipped.
+func CancelCampaign(mux chi.Router, p campaignPauser, log *zap.Logger) {
+	mux.Post("/campaigns/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		campaign, ok := changeCampaignStatus(w, r, p.CancelCampaign, "campaign is not being sent", log)
+		if ok {
+			writeJSON(w, http.StatusOK, campaign)
+		}
+	})
+}
+
+// changeCampaignStatus of the campaign with the ID in the path with the change function, and return it.
+// Writes an error response and returns false if the change fails.
+func changeCampaignStatus(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, id int) (*model.Campaign, error),
+	conflict string, log *zap.Logger) (*model.Campaign, bool) {
+	id, ok := getCampaignID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	campaign, err := change(r.Context(), id)
+	if errors.Is(err, model.ErrCampaignNotEditable) {
+		http.Error(w, conflict, http.StatusConflict)
+		return nil, false
+	}
+	if err != nil {
+		log.Info("Error changing campaign status", zap.Error(err))
+		http.Error(w, "error changing campaign status", http.StatusBadGateway)
+		return nil, false
+	}
+	if campaign == nil {
+		http.Error(w, "no such campaign", http.StatusNotFound)
+		return nil, false
+	}
+	return campaign, true
+}
+
+// decodeCampaign from the JSON body, writing an error response if it's invalid.
+// Markdown content is rendered into the HTML and text bodies, replacing any given.
+func decodeCampaign(w http.ResponseWriter, r *http.Request) (model.Campaign, bool) {
+	var campaign model.Campaign
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&campaign); err != nil {
+		http.Error(w, "bad JSON", http.StatusBadRequest)
+		return campaign, false
+	}
+	if campaign.ListID == "" {
+		campaign.ListID = model.DefaultListID
+	}
+	if !campaign.IsValid() {
+		http.Error(w, "campaign is invalid", http.StatusBadRequest)
+		return campaign, false
+	}
+	if campaign.Markdown != "" {
+		var err error
+		campaign.HTML, campaign.Text, err = messaging.RenderMarkdown(campaign.Markdown)
+		if err != nil {
+			http.Error(w, "markdown is invalid", http.StatusBadRequest)
+			return campaign, false
+		}
+	}
+	if campaign.ABTest != nil {
+		for i, v := range campaign.ABTest.Variants {
+			if v.Markdown == "" {
+				continue
+			}
+			var err error
+			campaign.ABTest.Variants[i].HTML, campaign.ABTest.Variants[i].Text, err = messaging.RenderMarkdown(v.Markdown)
+			if err != nil {
+				http.Error(w, "markdown of variant "+v.Name+" is invalid", http.StatusBadRequest)
+				return campaign, false
+			}
+		}
+	}
+	return campaign, true
+}
+
+// getCampaignID from the path, writing an error response if it's invalid.
+func getCampaignID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "id is invalid", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeJSON with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,426 @@
+package handlers_test
+
+import (
+	"Goo/handlers"
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// campaignsMock has campaign 1 as a draft and campaign 2 as sent.
+type campaignsMock struct {
+	campaign model.Campaign
+}
+
+func (c *campaignsMock) CreateCampaign(_ context.Context, campaign model.Campaign) (model.Campaign, error) {
+	if campaign.SegmentID != nil && *campaign.SegmentID != 1 {
+		return campaign, model.ErrSegmentNotFound
+	}
+	c.campaign = campaign
+	campaign.ID = 1
+	campaign.Status = model.CampaignDraft
+	return campaign, nil
+}
+
+func (c *campaignsMock) GetCampaign(_ context.Context, id int) (*model.Campaign, error) {
+	switch id {
+	case 1:
+		return &model.Campaign{ID: 1, Subject: "Hello", Status: model.CampaignDraft}, nil
+	case 2:
+		return &model.Campaign{ID: 2, Subject: "Hello again", Status: model.CampaignSent}, nil
+	case 4:
+		return &model.Campaign{ID: 4, Subject: "Hello", Status: model.CampaignDraft, ABTest: &model.ABTest{
+			Variants: []model.CampaignVariant{{Name: "a", Subject: "Hi"}, {Name: "b", Subject: "Hey"}},
+		}}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (c *campaignsMock) GetCampaigns(_ context.Context) ([]model.Campaign, error) {
+	return []model.Campaign{{ID: 1, Subject: "Hello", Status: model.CampaignDraft}}, nil
+}
+
+func (c *campaignsMock) UpdateCampaignDraft(_ context.Context, campaign model.Campaign) (*model.Campaign, error) {
+	switch campaign.ID {
+	case 1:
+		c.campaign = campaign
+		return &campaign, nil
+	case 2:
+		return nil, model.ErrCampaignNotEditable
+	default:
+		return nil, nil
+	}
+}
+
+func (c *campaignsMock) DeleteCampaignDraft(_ context.Context, id int) (bool, error) {
+	switch id {
+	case 1:
+		return true, nil
+	case 2:
+		return false, model.ErrCampaignNotEditable
+	default:
+		return false, nil
+	}
+}
+
+func TestCreateCampaign(t *testing.T) {
+	mux := chi.NewMux()
+	c := &campaignsMock{}
+	handlers.CreateCampaign(mux, c, zap.NewNop())
+
+	t.Run("creates a draft on the default list", func(t *testing.T) {
+		code, _, body := makeJSONRequest(mux, http.MethodPost, "/campaigns", `{"subject":"Hello","html":"<p>Hi</p>","text":"Hi"}`)
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, model.Campaign{ListID: "newsletter", Subject: "Hello", HTML: "<p>Hi</p>", Text: "Hi"}, c.campaign)
+
+		var campaign model.Campaign
+		err := json.Unmarshal([]byte(body), &campaign)
+		require.NoError(t, err)
+		require.Equal(t, 1, campaign.ID)
+		require.Equal(t, model.CampaignDraft, campaign.Status)
+	})
+
+	t.Run("creates a draft with an A/B test", func(t *testing.T) {
+		code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns", `{"subject":"Hello","text":"Hi","ab_test":{`+
+			`"variants":[{"name":"a","subject":"Hi"},{"name":"b","subject":"Hey"}],"sample_percent":20,"wait_minutes":60,"metric":"opens"}}`)
+		require.Equal(t, http.StatusCreated, code)
+		require.NotNil(t, c.campaign.ABTest)
+		require.Equal(t, []string{"a", "b"}, c.campaign.ABTest.VariantNames())
+	})
+
+	t.Run("renders markdown into the html and text bodies", func(t *testing.T) {
+		code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns", `{"subject":"Hello","markdown":"Hi *{{first_name}}*","html":"<p>Old</p>"}`)
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, "Hi *{{first_name}}*", c.campaign.Markdown)
+		require.Contains(t, c.campaign.HTML, "<em>{{first_name}}</em>")
+		require.NotContains(t, c.campaign.HTML, "Old")
+		require.Contains(t, c.campaign.Text, "Hi {{first_name}}")
+	})
+
+	t.Run("renders markdown of variants", func(t *testing.T) {
+		code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns", `{"subject":"Hello","markdown":"Hi","ab_test":{`+
+			`"variants":[{"name":"a","subject":"Hi"},{"name":"b","markdown":"Hey *you*"}],"sample_percent":20,"wait_minutes":60,"metric":"opens"}}`)
+		require.Equal(t, http.StatusCreated, code)
+		a, b := c.campaign.ABTest.Variants[0], c.campaign.ABTest.Variants[1]
+		require.Equal(t, "", a.HTML)
+		require.Contains(t, b.HTML, "<em>you</em>")
+		require.Contains(t, b.Text, "Hey you")
+		require.Contains(t, c.campaign.ForVariant("b").HTML, "<em>you</em>")
+	})
+
+	t.Run("rejects segments that are not on the list", func(t *testing.T) {
+		code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns", `{"subject":"Hello","text":"Hi","segment_id":2}`)
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("rejects invalid campaigns", func(t *testing.T) {
+		for _, body := range []string{`{"subject":"Hello"}`, `{"html":"<p>Hi</p>"}`, `not json`,
+			`{"subject":"Hello","text":"Hi","ab_test":{"variants":[{"name":"a","subject":"Hi"}],"sample_percent":20,"wait_minutes":60,"metric":"opens"}}`} {
+			code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns", body)
+			require.Equal(t, http.StatusBadRequest, code, body)
+		}
+	})
+}
+
+func TestCampaigns(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.Campaigns(mux, &campaignsMock{}, zap.NewNop())
+	handlers.Campaign(mux, &campaignsMock{}, zap.NewNop())
+
+	t.Run("lists campaigns", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/campaigns")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `"subject":"Hello"`)
+	})
+
+	t.Run("gets a campaign", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/campaigns/2")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `"status":"sent"`)
+	})
+
+	t.Run("returns 404 if there is no such campaign", func(t *testing.T) {
+		code, _, _ := makeGetRequest(mux, "/campaigns/3")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestUpdateCampaign(t *testing.T) {
+	mux := chi.NewMux()
+	c := &campaignsMock{}
+	handlers.UpdateCampaign(mux, c, zap.NewNop())
+
+	t.Run("updates a draft", func(t *testing.T) {
+		code, _, _ := makeJSONRequest(mux, http.MethodPut, "/campaigns/1", `{"list_id":"golang","subject":"Hi","text":"Hi"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, model.Campaign{ID: 1, ListID: "golang", Subject: "Hi", Text: "Hi"}, c.campaign)
+	})
+
+	t.Run("returns 409 if the campaign is not a draft", func(t *testing.T) {
+		code, _, _ := makeJSONRequest(mux, http.MethodPut, "/campaigns/2", `{"subject":"Hi","text":"Hi"}`)
+		require.Equal(t, http.StatusConflict, code)
+	})
+
+	t.Run("returns 404 if there is no such campaign", func(t *testing.T) {
+		code, _, _ := makeJSONRequest(mux, http.MethodPut, "/campaigns/3", `{"subject":"Hi","text":"Hi"}`)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestDeleteCampaign(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.DeleteCampaign(mux, &campaignsMock{}, zap.NewNop())
+
+	t.Run("deletes a draft", func(t *testing.T) {
+		require.Equal(t, http.StatusNoContent, makeDeleteRequest(mux, "/campaigns/1"))
+	})
+
+	t.Run("returns 409 if the campaign is not a draft", func(t *testing.T) {
+		require.Equal(t, http.StatusConflict, makeDeleteRequest(mux, "/campaigns/2"))
+	})
+
+	t.Run("returns 404 if there is no such campaign", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, makeDeleteRequest(mux, "/campaigns/3"))
+	})
+}
+
+func (c *campaignsMock) StartSendingCampaign(_ context.Context, id int) (*model.Campaign, error) {
+	switch id {
+	case 1:
+		return &model.Campaign{ID: 1, Subject: "Hello", Status: model.CampaignSending}, nil
+	case 2:
+		return nil, model.ErrCampaignNotEditable
+	default:
+		return nil, nil
+	}
+}
+
+func TestSendCampaign(t *testing.T) {
+	t.Run("starts sending the campaign and queues a message", func(t *testing.T) {
+		mux := chi.NewMux()
+		q := &senderMock{}
+		handlers.SendCampaign(mux, &campaignsMock{}, q, zap.NewNop())
+
+		code, _, body := makePostRequest(mux, "/campaigns/1/send", http.Header{}, nil)
+		require.Equal(t, http.StatusAccepted, code)
+		require.Contains(t, body, `"status":"sending"`)
+		require.Equal(t, model.Message{"job": "send_campaign", "campaign_id": "1"}, q.m)
+	})
+
+	t.Run("returns 409 if the campaign cannot be sent", func(t *testing.T) {
+		mux := chi.NewMux()
+		q := &senderMock{}
+		handlers.SendCampaign(mux, &campaignsMock{}, q, zap.NewNop())
+
+		code, _, _ := makePostRequest(mux, "/campaigns/2/send", http.Header{}, nil)
+		require.Equal(t, http.StatusConflict, code)
+		require.Nil(t, q.m)
+	})
+
+	t.Run("returns 404 if there is no such campaign", func(t *testing.T) {
+		mux := chi.NewMux()
+		handlers.SendCampaign(mux, &campaignsMock{}, &senderMock{}, zap.NewNop())
+
+		code, _, _ := makePostRequest(mux, "/campaigns/3/send", http.Header{}, nil)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestSendCampaignTest(t *testing.T) {
+	t.Run("queues a test email for each seed address", func(t *testing.T) {
+		mux := chi.NewMux()
+		q := &senderMock{}
+		handlers.SendCampaignTest(mux, &campaignsMock{}, q, zap.NewNop())
+
+		code, _, body := makeJSONRequest(mux, http.MethodPost, "/campaigns/1/test", `{"emails":["a@example.com","b@example.com"]}`)
+		require.Equal(t, http.StatusAccepted, code)
+		require.Contains(t, body, `"queued":2`)
+		require.Equal(t, model.Message{"job": "campaign_test_email", "campaign_id": "1", "email": "b@example.com"}, q.m)
+	})
+
+	t.Run("returns 400 for no or invalid addresses", func(t *testing.T) {
+		mux := chi.NewMux()
+		q := &senderMock{}
+		handlers.SendCampaignTest(mux, &campaignsMock{}, q, zap.NewNop())
+
+		code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns/1/test", `{"emails":[]}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		code, _, _ = makeJSONRequest(mux, http.MethodPost, "/campaigns/1/test", `{"emails":["a@example.com","nope"]}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Nil(t, q.m)
+	})
+
+	t.Run("returns 404 if there is no such campaign", func(t *testing.T) {
+		mux := chi.NewMux()
+		handlers.SendCampaignTest(mux, &campaignsMock{}, &senderMock{}, zap.NewNop())
+
+		code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns/3/test", `{"emails":["a@example.com"]}`)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func (c *campaignsMock) ScheduleCampaign(_ context.Context, id int, sendAt time.Time) (*model.Campaign, error) {
+	switch id {
+	case 1:
+		return &model.Campaign{ID: 1, Subject: "Hello", Status: model.CampaignScheduled, SendAt: &sendAt}, nil
+	case 2:
+		return nil, model.ErrCampaignNotEditable
+	default:
+		return nil, nil
+	}
+}
+
+func (c *campaignsMock) UnscheduleCampaign(_ context.Context, id int) (*model.Campaign, error) {
+	switch id {
+	case 1:
+		return &model.Campaign{ID: 1, Subject: "Hello", Status: model.CampaignDraft}, nil
+	case 2:
+		return nil, model.ErrCampaignNotEditable
+	default:
+		return nil, nil
+	}
+}
+
+func TestScheduleCampaign(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.ScheduleCampaign(mux, &campaignsMock{}, zap.NewNop())
+
+	t.Run("schedules the campaign", func(t *testing.T) {
+		sendAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		code, _, body := makeJSONRequest(mux, http.MethodPost, "/campaigns/1/schedule", `{"send_at":"`+sendAt+`"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `"status":"scheduled"`)
+		require.Contains(t, body, `"send_at":"`+sendAt+`"`)
+	})
+
+	t.Run("returns 400 if send_at is in the past or missing", func(t *testing.T) {
+		code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns/1/schedule", `{"send_at":"2020-01-01T09:00:00Z"}`)
+		require.Equal(t, http.StatusBadRequest, code)
+
+		code, _, _ = makeJSONRequest(mux, http.MethodPost, "/campaigns/1/schedule", `{}`)
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("returns 409 if the campaign cannot be scheduled", func(t *testing.T) {
+		sendAt := time.Now().Add(time.Hour).Format(time.RFC3339)
+		code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns/2/schedule", `{"send_at":"`+sendAt+`"}`)
+		require.Equal(t, http.StatusConflict, code)
+	})
+
+	t.Run("returns 404 if there is no such campaign", func(t *testing.T) {
+		sendAt := time.Now().Add(time.Hour).Format(time.RFC3339)
+		code, _, _ := makeJSONRequest(mux, http.MethodPost, "/campaigns/3/schedule", `{"send_at":"`+sendAt+`"}`)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestUnscheduleCampaign(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.UnscheduleCampaign(mux, &campaignsMock{}, zap.NewNop())
+
+	t.Run("moves the campaign back to a draft", func(t *testing.T) {
+		code, _, body := makeJSONRequest(mux, http.MethodDelete, "/campaigns/1/schedule", "")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `"status":"draft"`)
+	})
+
+	t.Run("returns 409 if the campaign is not scheduled", func(t *testing.T) {
+		code, _, _ := makeJSONRequest(mux, http.MethodDelete, "/campaigns/2/schedule", "")
+		require.Equal(t, http.StatusConflict, code)
+	})
+}
+
+func (c *campaignsMock) PauseCampaign(_ context.Context, id int) (*model.Campaign, error) {
+	return c.changeStatus(id, model.CampaignPaused)
+}
+
+func (c *campaignsMock) ResumeCampaign(_ context.Context, id int) (*model.Campaign, error) {
+	return c.changeStatus(id, model.CampaignSending)
+}
+
+func (c *campaignsMock) CancelCampaign(_ context.Context, id int) (*model.Campaign, error) {
+	return c.changeStatus(id, model.CampaignCancelled)
+}
+
+func (c *campaignsMock) changeStatus(id int, to model.CampaignStatus) (*model.Campaign, error) {
+	switch id {
+	case 1:
+		return &model.Campaign{ID: 1, Subject: "Hello", Status: to}, nil
+	case 2:
+		return nil, model.ErrCampaignNotEditable
+	default:
+		return nil, nil
+	}
+}
+
+func TestPauseCampaign(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.PauseCampaign(mux, &campaignsMock{}, zap.NewNop())
+	handlers.CancelCampaign(mux, &campaignsMock{}, zap.NewNop())
+
+	t.Run("pauses the campaign", func(t *testing.T) {
+		code, _, body := makePostRequest(mux, "/campaigns/1/pause", http.Header{}, nil)
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `"status":"paused"`)
+	})
+
+	t.Run("cancels the campaign", func(t *testing.T) {
+		code, _, body := makePostRequest(mux, "/campaigns/1/cancel", http.Header{}, nil)
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `"status":"cancelled"`)
+	})
+
+	t.Run("returns 409 if the campaign is not being sent", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/campaigns/2/pause", http.Header{}, nil)
+		require.Equal(t, http.StatusConflict, code)
+
+		code, _, _ = makePostRequest(mux, "/campaigns/2/cancel", http.Header{}, nil)
+		require.Equal(t, http.StatusConflict, code)
+	})
+
+	t.Run("returns 404 if there is no such campaign", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/campaigns/3/pause", http.Header{}, nil)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestResumeCampaign(t *testing.T) {
+	t.Run("resumes the campaign and queues a message to finish sending it", func(t *testing.T) {
+		mux := chi.NewMux()
+		q := &senderMock{}
+		handlers.ResumeCampaign(mux, &campaignsMock{}, q, zap.NewNop())
+
+		code, _, body := makePostRequest(mux, "/campaigns/1/resume", http.Header{}, nil)
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `"status":"sending"`)
+		require.Equal(t, model.Message{"job": "send_campaign", "campaign_id": "1"}, q.m)
+	})
+
+	t.Run("returns 409 if the campaign is not paused", func(t *testing.T) {
+		mux := chi.NewMux()
+		q := &senderMock{}
+		handlers.ResumeCampaign(mux, &campaignsMock{}, q, zap.NewNop())
+
+		code, _, _ := makePostRequest(mux, "/campaigns/2/resume", http.Header{}, nil)
+		require.Equal(t, http.StatusConflict, code)
+		require.Nil(t, q.m)
+	})
+}
+
+func makeJSONRequest(handler http.Handler, method, target, body string) (int, http.Header, string) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res.Code, res.Header(), res.Body.String()
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type consentRecorder interface {
+	RecordConsent(ctx context.Context, c model.Consent) error
+}
+
+// newConsent from the request. The IP is the remote address, which is only taken from forwarded headers
+// sent by trusted proxies, see RealIP. The form URL is the referring page, which is where the form was shown.
+// The consent text version comes from the consent_version form field of the form that was shown,
+// and is the current version if the field is missing or has a version that has never been shown.
+func newConsent(r *http.Request, listID string, email model.Email, action model.ConsentAction) model.Consent {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	textVersion := r.FormValue("consent_version")
+	if !model.IsKnownConsentTextVersion(textVersion) {
+		textVersion = model.ConsentTextVersion
+	}
+	return model.Consent{
+		ListID:      listID,
+		Email:       email,
+		Action:      action,
+		IP:          ip,
+		UserAgent:   r.UserAgent(),
+		FormURL:     r.Referer(),
+		TextVersion: textVersion,
+	}
+}
+
+type consentGetter interface {
+	GetConsents(ctx context.Context, email model.Email) ([]model.Consent, error)
+}
+
+// Consents for the email in the query on all lists, as JSON.
+func Consents(mux chi.Router, g consentGetter, log *zap.Logger) {
+	mux.Get("/consents", func(w http.ResponseWriter, r *http.Request) {
+		email := model.Email(r.URL.Query().Get("email"))
+		if !email.IsValid() {
+			http.Error(w, "email is invalid", http.StatusBadRequest)
+			return
+		}
+
+		consents, err := g.GetConsents(r.Context(), email)
+		if err != nil {
+			log.Info("Error getting consents", zap.Error(err))
+			http.Error(w, "error getting consents", http.StatusBadGateway)
+			return
+		}
+		if consents == nil {
+			consents = []model.Consent{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(consents)
+	})
+}
@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"Goo/handlers"
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type consentRecorderMock struct {
+	consent model.Consent
+}
+
+func (c *consentRecorderMock) RecordConsent(_ context.Context, consent model.Consent) error {
+	c.consent = consent
+	return nil
+}
+
+type consentGetterMock struct{}
+
+func (c *consentGetterMock) GetConsents(_ context.Context, email model.Email) ([]model.Consent, error) {
+	if email != "me@example.com" {
+		return nil, nil
+	}
+	return []model.Consent{{ListID: "newsletter", Email: email, Action: model.ConsentSignup, IP: "192.0.2.1"}}, nil
+}
+
+func TestConsents(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.Consents(mux, &consentGetterMock{}, zap.NewNop())
+
+	t.Run("returns the consents for the email as JSON", func(t *testing.T) {
+		code, header, body := makeGetRequest(mux, "/consents?email=me%40example.com")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "application/json", header.Get("Content-Type"))
+
+		var consents []model.Consent
+		err := json.Unmarshal([]byte(body), &consents)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(consents))
+		require.Equal(t, model.ConsentSignup, consents[0].Action)
+		require.Equal(t, "192.0.2.1", consents[0].IP)
+	})
+
+	t.Run("returns an empty list if there are no consents", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/consents?email=you%40example.com")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "[]\n", body)
+	})
+
+	t.Run("rejects an invalid email address", func(t *testing.T) {
+		code, _, _ := makeGetRequest(mux, "/consents?email=notanemail")
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+}
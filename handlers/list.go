@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type listCreator interface {
+	CreateList(ctx context.Context, id, name string) error
+}
+
+// CreateList from the form values id and name.
+func CreateList(mux chi.Router, c listCreator, log *zap.Logger) {
+	mux.Post("/lists", func(w http.ResponseWriter, r *http.Request) {
+		id := r.FormValue("id")
+		name := r.FormValue("name")
+		if !model.IsValidListID(id) {
+			http.Error(w, "id is invalid", http.StatusBadRequest)
+			return
+		}
+		if name == "" {
+			http.Error(w, "name is empty", http.StatusBadRequest)
+			return
+		}
+
+		if err := c.CreateList(r.Context(), id, name); err != nil {
+			log.Info("Error creating list", zap.Error(err))
+			http.Error(w, "error creating list", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+}
+
+type listGetter interface {
+	GetLists(ctx context.Context) ([]model.List, error)
+}
+
+// Lists as JSON.
+func Lists(mux chi.Router, g listGetter, log *zap.Logger) {
+	mux.Get("/lists", func(w http.ResponseWriter, r *http.Request) {
+		lists, err := g.GetLists(r.Context())
+		if err != nil {
+			log.Info("Error getting lists", zap.Error(err))
+			http.Error(w, "error getting lists", http.StatusBadGateway)
+			return
+		}
+		if lists == nil {
+			lists = []model.List{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(lists)
+	})
+}
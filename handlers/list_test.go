@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"Goo/handlers"
+	"Goo/model"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type listsMock struct {
+	id, name string
+}
+
+func (l *listsMock) CreateList(_ context.Context, id, name string) error {
+	l.id = id
+	l.name = name
+	return nil
+}
+
+func (l *listsMock) GetLists(_ context.Context) ([]model.List, error) {
+	return []model.List{{ID: "newsletter", Name: "Newsletter"}}, nil
+}
+
+func TestCreateList(t *testing.T) {
+	mux := chi.NewMux()
+	l := &listsMock{}
+	handlers.CreateList(mux, l, zap.NewNop())
+
+	t.Run("creates a list", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/lists", createFormHeader(), strings.NewReader("id=golang&name=Go"))
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, "golang", l.id)
+		require.Equal(t, "Go", l.name)
+	})
+
+	t.Run("rejects an id that cannot be used in URLs", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/lists", createFormHeader(), strings.NewReader("id=Go+lang&name=Go"))
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestLists(t *testing.T) {
+	t.Run("returns lists as JSON", func(t *testing.T) {
+		mux := chi.NewMux()
+		handlers.Lists(mux, &listsMock{}, zap.NewNop())
+
+		code, header, body := makeGetRequest(mux, "/lists")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "application/json", header.Get("Content-Type"))
+		require.Contains(t, body, `"id":"newsletter"`)
+	})
+}
@@ -6,8 +6,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -48,3 +51,50 @@ func AddMetrics(registry *prometheus.Registry) Middleware {
 func Metrics(mux chi.Router, registry *prometheus.Registry) {
 	mux.Get("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP)
 }
+
+// RealIP constructs middleware to set the request remote address to the client IP from the X-Forwarded-For
+// or X-Real-IP headers, but only for requests from the trusted proxies. Anyone can set those headers,
+// so for other requests the remote address is kept, which makes it safe to use as evidence, like in newConsent.
+// The client IP is the last address in X-Forwarded-For that is not a trusted proxy, as proxies append to it.
+func RealIP(trustedProxies []netip.Prefix) Middleware {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trustedProxies {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			remote, err := netip.ParseAddr(host)
+			if err != nil || !isTrusted(remote) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(forwarded) - 1; i >= 0; i-- {
+				addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+				if err != nil {
+					break
+				}
+				if !isTrusted(addr) {
+					r.RemoteAddr = addr.Unmap().String()
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+				r.RemoteAddr = addr.Unmap().String()
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
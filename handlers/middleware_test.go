@@ -6,6 +6,8 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
 )
@@ -33,4 +35,41 @@ func TestAddMetrics(t *testing.T) {
 			assert.True(t, strings.Contains(body, `app_http_request_duration_seconds_bucket{code="404",le="+Inf"} 1`))
 		})
 	})
-}
\ No newline at end of file
+}
+
+func TestRealIP(t *testing.T) {
+	mux := chi.NewMux()
+	mux.Use(handlers.RealIP([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}))
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.RemoteAddr))
+	})
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   string
+		realIP         string
+		expectedRemote string
+	}{
+		{"keeps the remote address of untrusted requests", "192.0.2.1:1234", "198.51.100.1", "198.51.100.2", "192.0.2.1:1234"},
+		{"uses X-Forwarded-For from trusted proxies", "10.0.0.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"uses the last untrusted address in X-Forwarded-For", "10.0.0.1:1234", "203.0.113.1, 198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"uses X-Real-IP from trusted proxies without X-Forwarded-For", "10.0.0.1:1234", "", "198.51.100.2", "198.51.100.2"},
+		{"keeps the remote address if the headers are invalid", "10.0.0.1:1234", "notanip", "notanip", "10.0.0.1:1234"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			if test.realIP != "" {
+				req.Header.Set("X-Real-IP", test.realIP)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			assert.Equal(t, test.expectedRemote, rec.Body.String())
+		})
+	}
+}
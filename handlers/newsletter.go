@@ -2,24 +2,54 @@ package handlers
 
 import (
 	"Goo/model"
+	"Goo/signing"
 	"Goo/views"
 	"context"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
 type signupper interface {
-	SignupForNewsletter(ctx context.Context, email model.Email) (string, error)
+	SignupForNewsletter(ctx context.Context, s model.Subscriber) (string, error)
 }
 
 type sender interface {
 	Send(ctx context.Context, m model.Message) error
 }
 
-func NewsletterSignup(mux chi.Router, s signupper, q sender, log *zap.Logger) {
-	mux.Post("/newsletter/signup", func(w http.ResponseWriter, r *http.Request) {
+type deliveryCreator interface {
+	CreateDelivery(ctx context.Context, d model.Delivery) (int, error)
+}
+
+// queueTemplateEmail for the subscriber, creating a queued delivery and passing its ID in the message.
+func queueTemplateEmail(ctx context.Context, d deliveryCreator, q sender, m model.Message, to model.Subscriber) error {
+	id, err := d.CreateDelivery(ctx, model.Delivery{Template: m["job"], ListID: to.ListID, Email: to.Email})
+	if err != nil {
+		return err
+	}
+	m["delivery_id"] = strconv.Itoa(id)
+	return q.Send(ctx, m)
+}
+
+// NewsletterSignup on the list in the path, or the default list if there is none.
+// Besides the email address, the form can have optional first_name and last_name fields,
+// and any number of extra fields named like attributes[key], which are stored as subscriber attributes.
+// An optional timezone field is stored as the subscriber timezone, see getTimezone.
+// The consent given by signing up is recorded, see newConsent.
+func NewsletterSignup(mux chi.Router, s signupper, c consentRecorder, d deliveryCreator, q sender, log *zap.Logger) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+
+		listID := getListID(r)
 		email := model.Email(r.FormValue("email"))
 
 		if !email.IsValid() {
@@ -27,26 +57,100 @@ func NewsletterSignup(mux chi.Router, s signupper, q sender, log *zap.Logger) {
 			return
 		}
 
-		token, err := s.SignupForNewsletter(r.Context(), email)
+		subscriber := model.Subscriber{
+			ListID:     listID,
+			Email:      email,
+			Attributes: getAttributes(r.PostForm),
+			Timezone:   getTimezone(r),
+			Preferences: model.Preferences{
+				FirstName: strings.TrimSpace(r.FormValue("first_name")),
+				LastName:  strings.TrimSpace(r.FormValue("last_name")),
+			},
+		}
+		if !model.IsValidName(subscriber.FirstName) || !model.IsValidName(subscriber.LastName) {
+			http.Error(w, "name is invalid", http.StatusBadRequest)
+			return
+		}
+		if !subscriber.Attributes.IsValid() {
+			http.Error(w, "attributes are invalid", http.StatusBadRequest)
+			return
+		}
+
+		token, err := s.SignupForNewsletter(r.Context(), subscriber)
+		if errors.Is(err, model.ErrInvalidTransition) {
+			// Don't reveal whether the address is on the list already
+			log.Info("Not signing up subscriber in its current state", zap.String("list", listID))
+			http.Redirect(w, r, "/newsletter/thanks", http.StatusFound)
+			return
+		}
+		if errors.Is(err, model.ErrListNotFound) {
+			http.Error(w, "no such newsletter", http.StatusNotFound)
+			return
+		}
 		if err != nil {
 			log.Info("Error signing up for newsletter", zap.Error(err))
 			http.Error(w, "error signing up, refresh to try again", http.StatusBadGateway)
 			return
 		}
 
-		err = q.Send(r.Context(), model.Message{
-			"job":   "confirmation_email",
-			"email": email.String(),
-			"token": token,
-		})
-		if err != nil {
+		if err := c.RecordConsent(r.Context(), newConsent(r, listID, email, model.ConsentSignup)); err != nil {
+			log.Info("Error recording signup consent", zap.Error(err))
+			http.Error(w, "error signing up, refresh to try again", http.StatusBadGateway)
+			return
+		}
+
+		// Signing up again right after the last confirmation email doesn't send another one,
+		// but looks the same, so it doesn't reveal whether the address is pending
+		if token == "" {
+			log.Info("Not sending confirmation email again so soon", zap.String("list", listID))
+			http.Redirect(w, r, "/newsletter/thanks", http.StatusFound)
+			return
+		}
+
+		m := model.NewSubscriberMessage("confirmation_email", subscriber)
+		m["token"] = token
+		if err := queueTemplateEmail(r.Context(), d, q, m, subscriber); err != nil {
 			log.Info("Error sending confirmation email message", zap.Error(err))
 			http.Error(w, "error signing up, refresh to try again", http.StatusBadGateway)
 			return
 		}
 
 		http.Redirect(w, r, "/newsletter/thanks", http.StatusFound)
-	})
+	}
+
+	mux.Post("/newsletter/signup", handler)
+	mux.Post("/newsletter/{list}/signup", handler)
+}
+
+// getAttributes from form fields named like attributes[key].
+func getAttributes(form url.Values) model.Attributes {
+	attributes := model.Attributes{}
+	for name := range form {
+		if !strings.HasPrefix(name, "attributes[") || !strings.HasSuffix(name, "]") {
+			continue
+		}
+		key := strings.TrimSuffix(strings.TrimPrefix(name, "attributes["), "]")
+		attributes[key] = strings.TrimSpace(form.Get(name))
+	}
+	return attributes
+}
+
+// getTimezone from the timezone form value, which is usually filled in by the browser.
+// It's only a hint, so invalid timezones are ignored instead of failing the signup.
+func getTimezone(r *http.Request) string {
+	timezone := strings.TrimSpace(r.FormValue("timezone"))
+	if !model.IsValidTimezone(timezone) {
+		return ""
+	}
+	return timezone
+}
+
+// getListID from the path, falling back to the default list for routes without one.
+func getListID(r *http.Request) string {
+	if listID := chi.URLParam(r, "list"); listID != "" {
+		return listID
+	}
+	return model.DefaultListID
 }
 
 func NewsletterThanks(mux chi.Router) {
@@ -65,11 +169,13 @@ func NewsletterThanks(mux chi.Router) {
 }
 
 type confirmer interface {
-	ConfirmNewsletterSignup(ctx context.Context, token string) (*model.Email, error)
+	ConfirmNewsletterSignup(ctx context.Context, listID, token string) (*model.Subscriber, error)
 }
 
-func NewsletterConfirm(mux chi.Router, s confirmer, q sender, log *zap.Logger) {
-	mux.Get("/newsletter/confirm", func(w http.ResponseWriter, r *http.Request) {
+// NewsletterConfirm on the list in the path, or the default list if there is none.
+// The consent given by confirming is recorded, see newConsent.
+func NewsletterConfirm(mux chi.Router, s confirmer, c consentRecorder, d deliveryCreator, q sender, log *zap.Logger) {
+	getHandler := func(w http.ResponseWriter, r *http.Request) {
 		token := r.FormValue("token")
 
 		template, err := views.NewsletterConfirmPage("/newsletter/confirm")
@@ -78,39 +184,114 @@ func NewsletterConfirm(mux chi.Router, s confirmer, q sender, log *zap.Logger) {
 			return
 		}
 		templateParameters := map[string]interface{}{
-			"token": token,
+			"list":            getListID(r),
+			"token":           token,
+			"consent_version": model.ConsentTextVersion,
 		}
 		err = template.Execute(w, templateParameters)
 		if err != nil {
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
-	})
+	}
 
-	mux.Post("/newsletter/confirm", func(w http.ResponseWriter, r *http.Request) {
+	postHandler := func(w http.ResponseWriter, r *http.Request) {
 		token := r.FormValue("token")
 
-		email, err := s.ConfirmNewsletterSignup(r.Context(), token)
+		listID := getListID(r)
+		subscriber, err := s.ConfirmNewsletterSignup(r.Context(), listID, token)
+		if errors.Is(err, model.ErrTokenExpired) {
+			http.Redirect(w, r, "/newsletter/expired?list="+url.QueryEscape(listID), http.StatusFound)
+			return
+		}
 		if err != nil {
 			log.Info("Error confirming newsletter signup", zap.Error(err))
 			http.Error(w, "error saving email address confirmation, refresh to try again", http.StatusBadGateway)
 			return
 		}
-		if email == nil {
+		if subscriber == nil {
 			http.Error(w, "bad token", http.StatusBadRequest)
 			return
 		}
 
-		err = q.Send(r.Context(), model.Message{
-			"job":   "welcome_email",
-			"email": email.String(),
-		})
+		if err := c.RecordConsent(r.Context(), newConsent(r, listID, subscriber.Email, model.ConsentConfirmation)); err != nil {
+			log.Info("Error recording confirmation consent", zap.Error(err))
+			http.Error(w, "error saving email address confirmation, refresh to try again", http.StatusBadGateway)
+			return
+		}
+
+		err = queueTemplateEmail(r.Context(), d, q, model.NewSubscriberMessage("welcome_email", *subscriber), *subscriber)
 		if err != nil {
 			log.Info("Error sending welcome email message", zap.Error(err))
 			http.Error(w, "error saving email address confirmation, refresh to try again", http.StatusBadGateway)
 			return
 		}
 		http.Redirect(w, r, "/newsletter/confirmed", http.StatusFound)
+	}
+
+	mux.Get("/newsletter/confirm", getHandler)
+	mux.Get("/newsletter/{list}/confirm", getHandler)
+	mux.Post("/newsletter/confirm", postHandler)
+	mux.Post("/newsletter/{list}/confirm", postHandler)
+}
+
+type confirmationRenewer interface {
+	RenewNewsletterConfirmationToken(ctx context.Context, listID string, email model.Email) (*model.Subscriber, string, error)
+}
+
+// NewsletterConfirmResend sends a new confirmation link to an unconfirmed subscriber on the list from the form,
+// or the default list if there is none.
+// It always redirects to the thanks page, so it cannot be used to find out who is subscribed.
+// How often a new link can be sent to one address is limited in storage.
+func NewsletterConfirmResend(mux chi.Router, s confirmationRenewer, d deliveryCreator, q sender, log *zap.Logger) {
+	mux.Post("/newsletter/confirm/resend", func(w http.ResponseWriter, r *http.Request) {
+		listID := r.FormValue("list")
+		if listID == "" {
+			listID = model.DefaultListID
+		}
+		email := model.Email(r.FormValue("email"))
+
+		if !email.IsValid() {
+			http.Error(w, "email is invalid", http.StatusBadRequest)
+			return
+		}
+
+		subscriber, token, err := s.RenewNewsletterConfirmationToken(r.Context(), listID, email)
+		if err != nil {
+			log.Info("Error renewing newsletter confirmation token", zap.Error(err))
+			http.Error(w, "error sending new link, refresh to try again", http.StatusBadGateway)
+			return
+		}
+
+		if subscriber != nil {
+			m := model.NewSubscriberMessage("confirmation_email", *subscriber)
+			m["token"] = token
+			if err := queueTemplateEmail(r.Context(), d, q, m, *subscriber); err != nil {
+				log.Info("Error sending confirmation email message", zap.Error(err))
+				http.Error(w, "error sending new link, refresh to try again", http.StatusBadGateway)
+				return
+			}
+		}
+
+		http.Redirect(w, r, "/newsletter/thanks", http.StatusFound)
+	})
+}
+
+func NewsletterExpired(mux chi.Router) {
+	mux.Get("/newsletter/expired", func(w http.ResponseWriter, r *http.Request) {
+		template, err := views.NewsletterExpiredPage("/newsletter/expired")
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		templateParameters := map[string]interface{}{
+			"list": r.FormValue("list"),
+		}
+		err = template.Execute(w, templateParameters)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
 	})
 }
 
@@ -128,3 +309,163 @@ func NewsletterConfirmed(mux chi.Router) {
 		}
 	})
 }
+
+type unsubscriber interface {
+	UnsubscribeFromNewsletter(ctx context.Context, listID string, email model.Email) error
+}
+
+type verifier interface {
+	Verify(purpose signing.Purpose, token string) (string, bool)
+}
+
+// NewsletterUnsubscribe shows a confirmation page on GET and unsubscribes on POST.
+// The token is the signed list ID and email address, separated by a colon.
+// The POST handler also serves RFC 8058 one-click unsubscribes from the List-Unsubscribe-Post header,
+// in which case the token is in the query string and the body is "List-Unsubscribe=One-Click".
+func NewsletterUnsubscribe(mux chi.Router, s unsubscriber, v verifier, log *zap.Logger) {
+	mux.Get("/newsletter/unsubscribe", func(w http.ResponseWriter, r *http.Request) {
+		token := r.FormValue("token")
+
+		template, err := views.NewsletterUnsubscribePage("/newsletter/unsubscribe")
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		templateParameters := map[string]interface{}{
+			"token": token,
+		}
+		err = template.Execute(w, templateParameters)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	})
+
+	mux.Post("/newsletter/unsubscribe", func(w http.ResponseWriter, r *http.Request) {
+		value, ok := v.Verify(signing.Unsubscribe, r.FormValue("token"))
+		if !ok {
+			http.Error(w, "bad token", http.StatusBadRequest)
+			return
+		}
+		// Tokens from before there were several lists only contain the email address
+		listID, email, found := strings.Cut(value, ":")
+		if !found {
+			listID, email = model.DefaultListID, value
+		}
+
+		if err := s.UnsubscribeFromNewsletter(r.Context(), listID, model.Email(email)); err != nil {
+			log.Info("Error unsubscribing from newsletter", zap.Error(err))
+			http.Error(w, "error unsubscribing, refresh to try again", http.StatusBadGateway)
+			return
+		}
+
+		http.Redirect(w, r, "/newsletter/unsubscribed", http.StatusFound)
+	})
+}
+
+func NewsletterUnsubscribed(mux chi.Router) {
+	mux.Get("/newsletter/unsubscribed", func(w http.ResponseWriter, r *http.Request) {
+		template, err := views.NewsletterUnsubscribedPage("/newsletter/unsubscribed")
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		err = template.Execute(w, nil)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+type preferencesUpdater interface {
+	GetNewsletterPreferences(ctx context.Context, token string) (*model.Subscriber, error)
+	UpdateNewsletterPreferences(ctx context.Context, token string, p model.Preferences) (*model.Subscriber, error)
+}
+
+type option struct {
+	Name    string
+	Checked bool
+}
+
+// NewsletterPreferences lets subscribers change their preferences, identified by their preferences token.
+func NewsletterPreferences(mux chi.Router, p preferencesUpdater, log *zap.Logger) {
+	mux.Get("/newsletter/preferences", func(w http.ResponseWriter, r *http.Request) {
+		token := r.FormValue("token")
+
+		subscriber, err := p.GetNewsletterPreferences(r.Context(), token)
+		if err != nil {
+			log.Info("Error getting newsletter preferences", zap.Error(err))
+			http.Error(w, "error getting preferences, refresh to try again", http.StatusBadGateway)
+			return
+		}
+		if subscriber == nil {
+			http.Error(w, "bad token", http.StatusBadRequest)
+			return
+		}
+
+		template, err := views.NewsletterPreferencesPage("/newsletter/preferences")
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		var topics []option
+		for _, topic := range model.AvailableTopics {
+			topics = append(topics, option{Name: topic, Checked: subscriber.Topics.Has(topic)})
+		}
+		var frequencies []option
+		for _, frequency := range model.AvailableFrequencies {
+			frequencies = append(frequencies, option{Name: frequency, Checked: subscriber.Frequency == frequency})
+		}
+
+		templateParameters := map[string]interface{}{
+			"token":       token,
+			"email":       subscriber.Email.String(),
+			"first_name":  subscriber.FirstName,
+			"last_name":   subscriber.LastName,
+			"topics":      topics,
+			"frequencies": frequencies,
+			"paused":      subscriber.Paused,
+			"saved":       r.FormValue("saved") == "true",
+		}
+		err = template.Execute(w, templateParameters)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	})
+
+	mux.Post("/newsletter/preferences", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+		token := r.PostForm.Get("token")
+
+		preferences := model.Preferences{
+			FirstName: strings.TrimSpace(r.PostForm.Get("first_name")),
+			LastName:  strings.TrimSpace(r.PostForm.Get("last_name")),
+			Topics:    model.Topics(r.PostForm["topic"]),
+			Frequency: r.PostForm.Get("frequency"),
+			Paused:    r.PostForm.Get("paused") == "true",
+		}
+		if !preferences.IsValid() {
+			http.Error(w, "preferences are invalid", http.StatusBadRequest)
+			return
+		}
+
+		subscriber, err := p.UpdateNewsletterPreferences(r.Context(), token, preferences)
+		if err != nil {
+			log.Info("Error updating newsletter preferences", zap.Error(err))
+			http.Error(w, "error saving preferences, refresh to try again", http.StatusBadGateway)
+			return
+		}
+		if subscriber == nil {
+			http.Error(w, "bad token", http.StatusBadRequest)
+			return
+		}
+
+		http.Redirect(w, r, "/newsletter/preferences?saved=true&token="+url.QueryEscape(token), http.StatusFound)
+	})
+}
@@ -3,6 +3,7 @@ package handlers_test
 import (
 	"Goo/handlers"
 	"Goo/model"
+	"Goo/signing"
 	"context"
 	"io"
 	"net/http"
@@ -16,31 +17,61 @@ import (
 )
 
 type signupperMock struct {
-	email model.Email
+	subscriber model.Subscriber
+	// throttle signups of pending subscribers, like the confirmation resend interval
+	throttle bool
+	pending  map[model.Email]bool
 }
 
-func (s *signupperMock) SignupForNewsletter(ctx context.Context, email model.Email) (string, error) {
-	s.email = email
+func (s *signupperMock) SignupForNewsletter(ctx context.Context, subscriber model.Subscriber) (string, error) {
+	if subscriber.ListID == "doesnotexist" {
+		return "", model.ErrListNotFound
+	}
+	if subscriber.Email == "complained@example.com" {
+		return "", model.ErrInvalidTransition
+	}
+	s.subscriber = subscriber
+	if s.throttle {
+		if s.pending[subscriber.Email] {
+			return "", nil
+		}
+		s.pending = map[model.Email]bool{subscriber.Email: true}
+	}
 	return "123", nil
 }
 
 type senderMock struct {
-	m model.Message
+	m     model.Message
+	count int
 }
 
 func (s *senderMock) Send(_ context.Context, m model.Message) error {
 	s.m = m
+	s.count++
 	return nil
 }
 
+type deliveryCreatorMock struct {
+	delivery model.Delivery
+}
+
+func (d *deliveryCreatorMock) CreateDelivery(_ context.Context, delivery model.Delivery) (int, error) {
+	d.delivery = delivery
+	return 7, nil
+}
+
 type confirmerMock struct {
-	token string
+	listID string
+	token  string
 }
 
-func (c *confirmerMock) ConfirmNewsletterSignup(ctx context.Context, token string) (*model.Email, error) {
+func (c *confirmerMock) ConfirmNewsletterSignup(ctx context.Context, listID, token string) (*model.Subscriber, error) {
+	if token == "expired" {
+		return nil, model.ErrTokenExpired
+	}
+	c.listID = listID
 	c.token = token
-	email := model.Email("me@example.com")
-	return &email, nil
+	return &model.Subscriber{ListID: listID, Email: "me@example.com", PreferencesToken: "456"}, nil
 }
 
 func TestNewsletterConfirm(t *testing.T) {
@@ -48,37 +79,238 @@ func TestNewsletterConfirm(t *testing.T) {
 		mux := chi.NewMux()
 		c := &confirmerMock{}
 		q := &senderMock{}
-		handlers.NewsletterConfirm(mux, c, q, zap.NewNop())
+		handlers.NewsletterConfirm(mux, c, &consentRecorderMock{}, &deliveryCreatorMock{}, q, zap.NewNop())
 
 		code, _, _ := makePostRequest(mux, "/newsletter/confirm", createFormHeader(),
 			strings.NewReader("token=123"))
 		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "newsletter", c.listID)
 		require.Equal(t, "123", c.token)
 
 		require.Equal(t, q.m, model.Message{
-			"job":   "welcome_email",
-			"email": "me@example.com",
+			"job":               "welcome_email",
+			"list":              "newsletter",
+			"email":             "me@example.com",
+			"first_name":        "",
+			"last_name":         "",
+			"attributes":        "{}",
+			"preferences_token": "456",
+			"delivery_id":       "7",
 		})
 	})
+
+	t.Run("confirms the signup on the list in the path", func(t *testing.T) {
+		mux := chi.NewMux()
+		c := &confirmerMock{}
+		q := &senderMock{}
+		handlers.NewsletterConfirm(mux, c, &consentRecorderMock{}, &deliveryCreatorMock{}, q, zap.NewNop())
+
+		code, _, body := makeGetRequest(mux, "/newsletter/golang/confirm?token=123")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `action="/newsletter/golang/confirm"`)
+
+		code, _, _ = makePostRequest(mux, "/newsletter/golang/confirm", createFormHeader(),
+			strings.NewReader("token=123"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "golang", c.listID)
+		require.Equal(t, "golang", q.m["list"])
+	})
+
+	t.Run("records the consent given by confirming", func(t *testing.T) {
+		mux := chi.NewMux()
+		r := &consentRecorderMock{}
+		handlers.NewsletterConfirm(mux, &confirmerMock{}, r, &deliveryCreatorMock{}, &senderMock{}, zap.NewNop())
+
+		code, _, body := makeGetRequest(mux, "/newsletter/confirm?token=123")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `name="consent_version" value="`+model.ConsentTextVersion+`"`)
+
+		header := createFormHeader()
+		header.Set("User-Agent", "Mozilla/5.0")
+		header.Set("Referer", "https://example.com/newsletter/confirm?token=123")
+		code, _, _ = makePostRequest(mux, "/newsletter/confirm", header,
+			strings.NewReader("token=123&consent_version="+model.ConsentTextVersion))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, model.Consent{
+			ListID:      "newsletter",
+			Email:       "me@example.com",
+			Action:      model.ConsentConfirmation,
+			IP:          "192.0.2.1",
+			UserAgent:   "Mozilla/5.0",
+			FormURL:     "https://example.com/newsletter/confirm?token=123",
+			TextVersion: model.ConsentTextVersion,
+		}, r.consent)
+	})
+
+	t.Run("records the current consent text version instead of unknown ones", func(t *testing.T) {
+		mux := chi.NewMux()
+		r := &consentRecorderMock{}
+		handlers.NewsletterConfirm(mux, &confirmerMock{}, r, &deliveryCreatorMock{}, &senderMock{}, zap.NewNop())
+
+		code, _, _ := makePostRequest(mux, "/newsletter/confirm", createFormHeader(),
+			strings.NewReader("token=123&consent_version=made-up"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, model.ConsentTextVersion, r.consent.TextVersion)
+	})
+}
+
+func TestNewsletterConfirm_Expired(t *testing.T) {
+	t.Run("redirects to the expired page if the token is too old", func(t *testing.T) {
+		mux := chi.NewMux()
+		q := &senderMock{}
+		handlers.NewsletterConfirm(mux, &confirmerMock{}, &consentRecorderMock{}, &deliveryCreatorMock{}, q, zap.NewNop())
+
+		code, header, _ := makePostRequest(mux, "/newsletter/golang/confirm", createFormHeader(),
+			strings.NewReader("token=expired"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "/newsletter/expired?list=golang", header.Get("Location"))
+		require.Nil(t, q.m)
+	})
+}
+
+type confirmationRenewerMock struct {
+	listID string
+	email  model.Email
+}
+
+func (c *confirmationRenewerMock) RenewNewsletterConfirmationToken(_ context.Context, listID string, email model.Email) (*model.Subscriber, string, error) {
+	c.listID = listID
+	c.email = email
+	if email != "me@example.com" {
+		return nil, "", nil
+	}
+	return &model.Subscriber{ListID: listID, Email: email}, "789", nil
+}
+
+func TestNewsletterConfirmResend(t *testing.T) {
+	t.Run("sends a message with a new token", func(t *testing.T) {
+		mux := chi.NewMux()
+		c := &confirmationRenewerMock{}
+		q := &senderMock{}
+		handlers.NewsletterConfirmResend(mux, c, &deliveryCreatorMock{}, q, zap.NewNop())
+
+		code, header, _ := makePostRequest(mux, "/newsletter/confirm/resend", createFormHeader(),
+			strings.NewReader("list=golang&email=me%40example.com"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "/newsletter/thanks", header.Get("Location"))
+		require.Equal(t, "golang", c.listID)
+		require.Equal(t, "confirmation_email", q.m["job"])
+		require.Equal(t, "golang", q.m["list"])
+		require.Equal(t, "789", q.m["token"])
+	})
+
+	t.Run("redirects without sending a message if there is no new token", func(t *testing.T) {
+		mux := chi.NewMux()
+		c := &confirmationRenewerMock{}
+		q := &senderMock{}
+		handlers.NewsletterConfirmResend(mux, c, &deliveryCreatorMock{}, q, zap.NewNop())
+
+		code, header, _ := makePostRequest(mux, "/newsletter/confirm/resend", createFormHeader(),
+			strings.NewReader("email=you%40example.com"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "/newsletter/thanks", header.Get("Location"))
+		require.Equal(t, "newsletter", c.listID)
+		require.Nil(t, q.m)
+	})
 }
 
 func TestNewsletterSignup(t *testing.T) {
 	mux := chi.NewMux()
 	s := &signupperMock{}
+	c := &consentRecorderMock{}
+	d := &deliveryCreatorMock{}
 	q := &senderMock{}
-	handlers.NewsletterSignup(mux, s, q, zap.NewNop())
+	handlers.NewsletterSignup(mux, s, c, d, q, zap.NewNop())
 
 	t.Run("signs up a valid email address and sends a message", func(t *testing.T) {
 		code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
 			strings.NewReader("email=me%40example.com"))
 		require.Equal(t, http.StatusFound, code)
-		require.Equal(t, model.Email("me@example.com"), s.email)
+		require.Equal(t, model.Email("me@example.com"), s.subscriber.Email)
 
 		require.Equal(t, q.m, model.Message{
-			"job":   "confirmation_email",
-			"email": "me@example.com",
-			"token": "123",
+			"job":         "confirmation_email",
+			"list":        "newsletter",
+			"email":       "me@example.com",
+			"first_name":  "",
+			"last_name":   "",
+			"attributes":  "{}",
+			"token":       "123",
+			"delivery_id": "7",
 		})
+		require.Equal(t, model.Delivery{Template: "confirmation_email", ListID: "newsletter", Email: "me@example.com"}, d.delivery)
+	})
+
+	t.Run("records the consent given by signing up", func(t *testing.T) {
+		header := createFormHeader()
+		header.Set("User-Agent", "Mozilla/5.0")
+		header.Set("Referer", "https://example.com/")
+		code, _, _ := makePostRequest(mux, "/newsletter/signup", header,
+			strings.NewReader("email=me%40example.com"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, model.Consent{
+			ListID:      "newsletter",
+			Email:       "me@example.com",
+			Action:      model.ConsentSignup,
+			IP:          "192.0.2.1",
+			UserAgent:   "Mozilla/5.0",
+			FormURL:     "https://example.com/",
+			TextVersion: model.ConsentTextVersion,
+		}, c.consent)
+	})
+
+	t.Run("signs up with names and attributes", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			strings.NewReader("email=me%40example.com&first_name=+Me+&last_name=Myself&attributes%5Bcompany%5D=Goo&other=ignored"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, model.Subscriber{
+			ListID:      "newsletter",
+			Email:       "me@example.com",
+			Attributes:  model.Attributes{"company": "Goo"},
+			Preferences: model.Preferences{FirstName: "Me", LastName: "Myself"},
+		}, s.subscriber)
+		require.Equal(t, "Me", q.m["first_name"])
+		require.Equal(t, `{"company":"Goo"}`, q.m["attributes"])
+	})
+
+	t.Run("signs up with the timezone hint, ignoring invalid ones", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			strings.NewReader("email=me%40example.com&timezone=Europe%2FCopenhagen"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "Europe/Copenhagen", s.subscriber.Timezone)
+
+		code, _, _ = makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			strings.NewReader("email=me%40example.com&timezone=Mars%2FOlympus_Mons"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "", s.subscriber.Timezone)
+	})
+
+	t.Run("rejects invalid attributes", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			strings.NewReader("email=me%40example.com&attributes%5BCompany%5D=Goo"))
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("signs up on the list in the path", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/newsletter/golang/signup", createFormHeader(),
+			strings.NewReader("email=me%40example.com"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "golang", s.subscriber.ListID)
+		require.Equal(t, "golang", q.m["list"])
+	})
+
+	t.Run("returns 404 if there is no such list", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/newsletter/doesnotexist/signup", createFormHeader(),
+			strings.NewReader("email=me%40example.com"))
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("redirects without sending a message if the subscriber cannot sign up again", func(t *testing.T) {
+		q.m = nil
+		code, _, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+			strings.NewReader("email=complained%40example.com"))
+		require.Equal(t, http.StatusFound, code)
+		require.Nil(t, q.m)
 	})
 
 	t.Run("rejects an invalid email address", func(t *testing.T) {
@@ -86,6 +318,158 @@ func TestNewsletterSignup(t *testing.T) {
 			strings.NewReader("email=notanemail"))
 		require.Equal(t, http.StatusBadRequest, code)
 	})
+
+	t.Run("does not send another confirmation when signing up again right after", func(t *testing.T) {
+		mux := chi.NewMux()
+		q := &senderMock{}
+		handlers.NewsletterSignup(mux, &signupperMock{throttle: true}, &consentRecorderMock{}, &deliveryCreatorMock{}, q, zap.NewNop())
+
+		for i := 0; i < 2; i++ {
+			code, header, _ := makePostRequest(mux, "/newsletter/signup", createFormHeader(),
+				strings.NewReader("email=me%40example.com"))
+			require.Equal(t, http.StatusFound, code)
+			require.Equal(t, "/newsletter/thanks", header.Get("Location"))
+		}
+		require.Equal(t, 1, q.count)
+	})
+}
+
+type unsubscriberMock struct {
+	listID string
+	email  model.Email
+}
+
+func (u *unsubscriberMock) UnsubscribeFromNewsletter(_ context.Context, listID string, email model.Email) error {
+	u.listID = listID
+	u.email = email
+	return nil
+}
+
+func TestNewsletterUnsubscribe(t *testing.T) {
+	signer := signing.NewSigner("secret")
+
+	t.Run("shows a confirmation page with the token", func(t *testing.T) {
+		mux := chi.NewMux()
+		handlers.NewsletterUnsubscribe(mux, &unsubscriberMock{}, signer, zap.NewNop())
+
+		code, _, body := makeGetRequest(mux, "/newsletter/unsubscribe?token=abc")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `value="abc"`)
+	})
+
+	t.Run("unsubscribes the email address from the list in a signed token", func(t *testing.T) {
+		mux := chi.NewMux()
+		u := &unsubscriberMock{}
+		handlers.NewsletterUnsubscribe(mux, u, signer, zap.NewNop())
+
+		code, header, _ := makePostRequest(mux, "/newsletter/unsubscribe", createFormHeader(),
+			strings.NewReader("token="+signer.Sign(signing.Unsubscribe, "golang:me@example.com")))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "/newsletter/unsubscribed", header.Get("Location"))
+		require.Equal(t, "golang", u.listID)
+		require.Equal(t, model.Email("me@example.com"), u.email)
+	})
+
+	t.Run("unsubscribes from the default list if the token has no list", func(t *testing.T) {
+		mux := chi.NewMux()
+		u := &unsubscriberMock{}
+		handlers.NewsletterUnsubscribe(mux, u, signer, zap.NewNop())
+
+		code, _, _ := makePostRequest(mux, "/newsletter/unsubscribe", createFormHeader(),
+			strings.NewReader("token="+signer.Sign(signing.Unsubscribe, "me@example.com")))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "newsletter", u.listID)
+		require.Equal(t, model.Email("me@example.com"), u.email)
+	})
+
+	t.Run("supports one-click unsubscribe with the token in the query string", func(t *testing.T) {
+		mux := chi.NewMux()
+		u := &unsubscriberMock{}
+		handlers.NewsletterUnsubscribe(mux, u, signer, zap.NewNop())
+
+		code, _, _ := makePostRequest(mux, "/newsletter/unsubscribe?token="+signer.Sign(signing.Unsubscribe, "newsletter:me@example.com"),
+			createFormHeader(), strings.NewReader("List-Unsubscribe=One-Click"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, model.Email("me@example.com"), u.email)
+	})
+
+	t.Run("rejects a token with a bad signature", func(t *testing.T) {
+		mux := chi.NewMux()
+		u := &unsubscriberMock{}
+		handlers.NewsletterUnsubscribe(mux, u, signer, zap.NewNop())
+
+		code, _, _ := makePostRequest(mux, "/newsletter/unsubscribe", createFormHeader(),
+			strings.NewReader("token="+signing.NewSigner("other").Sign(signing.Unsubscribe, "me@example.com")))
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Equal(t, model.Email(""), u.email)
+	})
+}
+
+type preferencesUpdaterMock struct {
+	token       string
+	preferences model.Preferences
+}
+
+func (p *preferencesUpdaterMock) GetNewsletterPreferences(_ context.Context, token string) (*model.Subscriber, error) {
+	if token != "456" {
+		return nil, nil
+	}
+	return &model.Subscriber{
+		Email:            "me@example.com",
+		PreferencesToken: token,
+		Preferences:      model.Preferences{FirstName: "Me", LastName: "Myself", Topics: model.Topics{"events"}, Frequency: "monthly"},
+	}, nil
+}
+
+func (p *preferencesUpdaterMock) UpdateNewsletterPreferences(_ context.Context, token string, preferences model.Preferences) (*model.Subscriber, error) {
+	if token != "456" {
+		return nil, nil
+	}
+	p.token = token
+	p.preferences = preferences
+	return &model.Subscriber{Email: "me@example.com", PreferencesToken: token, Preferences: preferences}, nil
+}
+
+func TestNewsletterPreferences(t *testing.T) {
+	mux := chi.NewMux()
+	p := &preferencesUpdaterMock{}
+	handlers.NewsletterPreferences(mux, p, zap.NewNop())
+
+	t.Run("shows the current preferences", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/newsletter/preferences?token=456")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, "me@example.com")
+		require.Contains(t, body, `value="Me"`)
+		require.Contains(t, body, `value="Myself"`)
+		require.Contains(t, body, `value="events" checked`)
+		require.NotContains(t, body, `value="articles" checked`)
+		require.Contains(t, body, `value="monthly" selected`)
+	})
+
+	t.Run("rejects an unknown token", func(t *testing.T) {
+		code, _, _ := makeGetRequest(mux, "/newsletter/preferences?token=wrong")
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("saves the preferences and redirects back", func(t *testing.T) {
+		code, header, _ := makePostRequest(mux, "/newsletter/preferences", createFormHeader(),
+			strings.NewReader("token=456&first_name=+You+&last_name=Yourself&topic=articles&topic=courses&frequency=weekly&paused=true"))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "/newsletter/preferences?saved=true&token=456", header.Get("Location"))
+		require.Equal(t, model.Preferences{
+			FirstName: "You",
+			LastName:  "Yourself",
+			Topics:    model.Topics{"articles", "courses"},
+			Frequency: "weekly",
+			Paused:    true,
+		}, p.preferences)
+	})
+
+	t.Run("rejects invalid preferences", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/newsletter/preferences", createFormHeader(),
+			strings.NewReader("token=456&topic=cats&frequency=weekly"))
+		require.Equal(t, http.StatusBadRequest, code)
+	})
 }
 
 func makePostRequest(handler http.Handler, target string, header http.Header, body io.Reader) (int, http.Header, string) {
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"Goo/model"
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type emailPreviewer interface {
+	PreviewNewsletterConfirmationEmail(to model.Subscriber, token string) model.EmailPreview
+	PreviewNewsletterWelcomeEmail(to model.Subscriber) model.EmailPreview
+	PreviewCampaignEmail(c model.Campaign, to model.Subscriber) model.EmailPreview
+}
+
+type subscriberGetter interface {
+	GetSubscriber(ctx context.Context, listID string, email model.Email) (*model.Subscriber, error)
+}
+
+// CampaignPreview renders the campaign with the ID in the path like it would be sent, without sending it.
+// The email query parameter picks a subscriber on the campaign list to personalize it for,
+// otherwise a sample subscriber is used. The variant query parameter picks an A/B test variant to render
+// instead of the campaign content. See writePreview for the format.
+func CampaignPreview(mux chi.Router, g campaignGetter, s subscriberGetter, p emailPreviewer, log *zap.Logger) {
+	mux.Get("/campaigns/{id}/preview", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := getCampaignID(w, r)
+		if !ok {
+			return
+		}
+
+		campaign, err := g.GetCampaign(r.Context(), id)
+		if err != nil {
+			log.Info("Error getting campaign", zap.Error(err))
+			http.Error(w, "error getting campaign", http.StatusBadGateway)
+			return
+		}
+		if campaign == nil {
+			http.Error(w, "no such campaign", http.StatusNotFound)
+			return
+		}
+
+		if variant := r.URL.Query().Get("variant"); variant != "" {
+			if campaign.ABTest == nil || !campaign.ABTest.HasVariant(variant) {
+				http.Error(w, "no such variant", http.StatusNotFound)
+				return
+			}
+			*campaign = campaign.ForVariant(variant)
+		}
+
+		to, ok := getPreviewSubscriber(w, r, s, campaign.ListID, log)
+		if !ok {
+			return
+		}
+		writePreview(w, r, p.PreviewCampaignEmail(*campaign, to))
+	})
+}
+
+// TemplatePreview renders the confirmation_email or welcome_email template in the path like it would be sent,
+// without sending it. The list and email query parameters pick a subscriber to personalize it for,
+// otherwise a sample subscriber on the list or the default list is used. See writePreview for the format.
+func TemplatePreview(mux chi.Router, s subscriberGetter, p emailPreviewer, log *zap.Logger) {
+	mux.Get("/templates/{name}/preview", func(w http.ResponseWriter, r *http.Request) {
+		listID := r.URL.Query().Get("list")
+		if listID == "" {
+			listID = model.DefaultListID
+		}
+
+		var preview func(to model.Subscriber) model.EmailPreview
+		switch chi.URLParam(r, "name") {
+		case "confirmation_email":
+			preview = func(to model.Subscriber) model.EmailPreview {
+				return p.PreviewNewsletterConfirmationEmail(to, "sample")
+			}
+		case "welcome_email":
+			preview = p.PreviewNewsletterWelcomeEmail
+		default:
+			http.Error(w, "no such template", http.StatusNotFound)
+			return
+		}
+
+		to, ok := getPreviewSubscriber(w, r, s, listID, log)
+		if !ok {
+			return
+		}
+		writePreview(w, r, preview(to))
+	})
+}
+
+// getPreviewSubscriber on the list with the address from the email query parameter,
+// or a sample subscriber if there is none. Writes an error response if there is no such subscriber.
+func getPreviewSubscriber(w http.ResponseWriter, r *http.Request, s subscriberGetter, listID string, log *zap.Logger) (model.Subscriber, bool) {
+	email := model.Email(r.URL.Query().Get("email"))
+	if email == "" {
+		return model.SampleSubscriber(listID), true
+	}
+
+	subscriber, err := s.GetSubscriber(r.Context(), listID, email)
+	if err != nil {
+		log.Info("Error getting subscriber", zap.Error(err))
+		http.Error(w, "error getting subscriber", http.StatusBadGateway)
+		return model.Subscriber{}, false
+	}
+	if subscriber == nil {
+		http.Error(w, "no such subscriber", http.StatusNotFound)
+		return model.Subscriber{}, false
+	}
+	return *subscriber, true
+}
+
+// writePreview as JSON with both parts, or only the HTML or text part with the format query parameter
+// set to html or text, for looking at in a browser.
+func writePreview(w http.ResponseWriter, r *http.Request, preview model.EmailPreview) {
+	switch r.URL.Query().Get("format") {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(preview.HTML))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(preview.Text))
+	default:
+		writeJSON(w, http.StatusOK, preview)
+	}
+}
@@ -0,0 +1,116 @@
+package handlers_test
+
+import (
+	"Goo/handlers"
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type emailPreviewerMock struct {
+	to    model.Subscriber
+	token string
+}
+
+func (p *emailPreviewerMock) PreviewNewsletterConfirmationEmail(to model.Subscriber, token string) model.EmailPreview {
+	p.to = to
+	p.token = token
+	return model.EmailPreview{Subject: "Confirm", HTML: "<p>Confirm</p>", Text: "Confirm"}
+}
+
+func (p *emailPreviewerMock) PreviewNewsletterWelcomeEmail(to model.Subscriber) model.EmailPreview {
+	p.to = to
+	return model.EmailPreview{Subject: "Welcome", HTML: "<p>Welcome</p>", Text: "Welcome"}
+}
+
+func (p *emailPreviewerMock) PreviewCampaignEmail(c model.Campaign, to model.Subscriber) model.EmailPreview {
+	p.to = to
+	return model.EmailPreview{Subject: c.Subject, HTML: "<p>" + c.Subject + "</p>", Text: c.Subject}
+}
+
+type subscriberGetterMock struct{}
+
+func (s *subscriberGetterMock) GetSubscriber(_ context.Context, listID string, email model.Email) (*model.Subscriber, error) {
+	if email != "me@example.com" {
+		return nil, nil
+	}
+	return &model.Subscriber{ListID: listID, Email: email, Preferences: model.Preferences{FirstName: "Me"}}, nil
+}
+
+func TestCampaignPreview(t *testing.T) {
+	mux := chi.NewMux()
+	p := &emailPreviewerMock{}
+	handlers.CampaignPreview(mux, &campaignsMock{}, &subscriberGetterMock{}, p, zap.NewNop())
+
+	t.Run("renders the campaign for a sample subscriber as JSON", func(t *testing.T) {
+		code, header, body := makeGetRequest(mux, "/campaigns/1/preview")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "application/json", header.Get("Content-Type"))
+		var preview model.EmailPreview
+		require.NoError(t, json.Unmarshal([]byte(body), &preview))
+		require.Equal(t, model.EmailPreview{Subject: "Hello", HTML: "<p>Hello</p>", Text: "Hello"}, preview)
+		require.Equal(t, model.SampleSubscriber(""), p.to)
+	})
+
+	t.Run("renders the campaign for the chosen subscriber in the given format", func(t *testing.T) {
+		code, header, body := makeGetRequest(mux, "/campaigns/1/preview?email=me%40example.com&format=html")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "text/html; charset=utf-8", header.Get("Content-Type"))
+		require.Equal(t, "<p>Hello</p>", body)
+		require.Equal(t, "Me", p.to.FirstName)
+
+		_, _, body = makeGetRequest(mux, "/campaigns/1/preview?format=text")
+		require.Equal(t, "Hello", body)
+	})
+
+	t.Run("renders a variant of the campaign", func(t *testing.T) {
+		_, _, body := makeGetRequest(mux, "/campaigns/4/preview?variant=b&format=text")
+		require.Equal(t, "Hey", body)
+
+		code, _, _ := makeGetRequest(mux, "/campaigns/4/preview?variant=c")
+		require.Equal(t, http.StatusNotFound, code)
+		code, _, _ = makeGetRequest(mux, "/campaigns/1/preview?variant=a")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("returns 404 if there is no such campaign or subscriber", func(t *testing.T) {
+		code, _, _ := makeGetRequest(mux, "/campaigns/3/preview")
+		require.Equal(t, http.StatusNotFound, code)
+
+		code, _, _ = makeGetRequest(mux, "/campaigns/1/preview?email=you%40example.com")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestTemplatePreview(t *testing.T) {
+	mux := chi.NewMux()
+	p := &emailPreviewerMock{}
+	handlers.TemplatePreview(mux, &subscriberGetterMock{}, p, zap.NewNop())
+
+	t.Run("renders the confirmation email with a sample token", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/templates/confirmation_email/preview?list=golang")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `"subject":"Confirm"`)
+		require.Equal(t, "golang", p.to.ListID)
+		require.Equal(t, "sample", p.token)
+	})
+
+	t.Run("renders the welcome email for the chosen subscriber", func(t *testing.T) {
+		code, _, body := makeGetRequest(mux, "/templates/welcome_email/preview?email=me%40example.com&format=text")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "Welcome", body)
+		require.Equal(t, model.Email("me@example.com"), p.to.Email)
+		require.Equal(t, "newsletter", p.to.ListID)
+	})
+
+	t.Run("returns 404 if there is no such template", func(t *testing.T) {
+		code, _, _ := makeGetRequest(mux, "/templates/index/preview")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type segmentCreator interface {
+	CreateSegment(ctx context.Context, s model.Segment) (model.Segment, error)
+}
+
+// CreateSegment from a JSON body with list_id, name and query, and return it as JSON.
+// The list defaults to the default list. See model.ParseSegmentQuery for the query language.
+func CreateSegment(mux chi.Router, c segmentCreator, log *zap.Logger) {
+	mux.Post("/segments", func(w http.ResponseWriter, r *http.Request) {
+		var segment model.Segment
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&segment); err != nil {
+			http.Error(w, "bad JSON", http.StatusBadRequest)
+			return
+		}
+		if segment.ListID == "" {
+			segment.ListID = model.DefaultListID
+		}
+		if _, err := model.ParseSegmentQuery(segment.Query); err != nil {
+			http.Error(w, "query is invalid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !segment.IsValid() {
+			http.Error(w, "segment is invalid", http.StatusBadRequest)
+			return
+		}
+
+		segment, err := c.CreateSegment(r.Context(), segment)
+		if err != nil {
+			log.Info("Error creating segment", zap.Error(err))
+			http.Error(w, "error creating segment", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusCreated, segment)
+	})
+}
+
+type segmentGetter interface {
+	GetSegments(ctx context.Context) ([]model.Segment, error)
+}
+
+// Segments as JSON, by list and name.
+func Segments(mux chi.Router, g segmentGetter, log *zap.Logger) {
+	mux.Get("/segments", func(w http.ResponseWriter, r *http.Request) {
+		segments, err := g.GetSegments(r.Context())
+		if err != nil {
+			log.Info("Error getting segments", zap.Error(err))
+			http.Error(w, "error getting segments", http.StatusBadGateway)
+			return
+		}
+		if segments == nil {
+			segments = []model.Segment{}
+		}
+		writeJSON(w, http.StatusOK, segments)
+	})
+}
+
+type segmentDeleter interface {
+	DeleteSegment(ctx context.Context, id int) (bool, error)
+}
+
+// DeleteSegment with the ID in the path. Segments that campaigns are targeted at cannot be deleted.
+func DeleteSegment(mux chi.Router, d segmentDeleter, log *zap.Logger) {
+	mux.Delete("/segments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "id is invalid", http.StatusBadRequest)
+			return
+		}
+
+		deleted, err := d.DeleteSegment(r.Context(), id)
+		if errors.Is(err, model.ErrSegmentInUse) {
+			http.Error(w, "segment is used by campaigns", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Info("Error deleting segment", zap.Error(err))
+			http.Error(w, "error deleting segment", http.StatusBadGateway)
+			return
+		}
+		if !deleted {
+			http.Error(w, "no such segment", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type segmentCounter interface {
+	CountSegment(ctx context.Context, listID, query string) (int, error)
+}
+
+// SegmentCount previews how many subscribers a campaign targeted at a segment would be sent to,
+// from a JSON body with list_id and query like in CreateSegment, without saving the segment.
+// Returns JSON with the count.
+func SegmentCount(mux chi.Router, c segmentCounter, log *zap.Logger) {
+	mux.Post("/segments/count", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ListID string `json:"list_id"`
+			Query  string `json:"query"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+			http.Error(w, "bad JSON", http.StatusBadRequest)
+			return
+		}
+		if body.ListID == "" {
+			body.ListID = model.DefaultListID
+		}
+		if !model.IsValidListID(body.ListID) {
+			http.Error(w, "list_id is invalid", http.StatusBadRequest)
+			return
+		}
+		if _, err := model.ParseSegmentQuery(body.Query); err != nil {
+			http.Error(w, "query is invalid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		count, err := c.CountSegment(r.Context(), body.ListID, body.Query)
+		if err != nil {
+			log.Info("Error counting segment", zap.Error(err))
+			http.Error(w, "error counting segment", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"count": count})
+	})
+}
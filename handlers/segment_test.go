@@ -0,0 +1,125 @@
+package handlers_test
+
+import (
+	"Goo/handlers"
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// segmentsMock has segment 1 unused and segment 2 used by campaigns.
+type segmentsMock struct {
+	segment model.Segment
+	listID  string
+	query   string
+}
+
+func (s *segmentsMock) CreateSegment(_ context.Context, segment model.Segment) (model.Segment, error) {
+	s.segment = segment
+	segment.ID = 1
+	return segment, nil
+}
+
+func (s *segmentsMock) GetSegments(_ context.Context) ([]model.Segment, error) {
+	return []model.Segment{{ID: 1, ListID: "newsletter", Name: "Gophers", Query: `tag = "go"`}}, nil
+}
+
+func (s *segmentsMock) DeleteSegment(_ context.Context, id int) (bool, error) {
+	switch id {
+	case 1:
+		return true, nil
+	case 2:
+		return false, model.ErrSegmentInUse
+	default:
+		return false, nil
+	}
+}
+
+func (s *segmentsMock) CountSegment(_ context.Context, listID, query string) (int, error) {
+	s.listID = listID
+	s.query = query
+	return 42, nil
+}
+
+func TestCreateSegment(t *testing.T) {
+	mux := chi.NewMux()
+	s := &segmentsMock{}
+	handlers.CreateSegment(mux, s, zap.NewNop())
+
+	t.Run("creates a segment on the default list", func(t *testing.T) {
+		code, _, body := makeJSONRequest(mux, http.MethodPost, "/segments", `{"name":"Gophers","query":"tag = \"go\""}`)
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, model.Segment{ListID: "newsletter", Name: "Gophers", Query: `tag = "go"`}, s.segment)
+
+		var segment model.Segment
+		err := json.Unmarshal([]byte(body), &segment)
+		require.NoError(t, err)
+		require.Equal(t, 1, segment.ID)
+	})
+
+	t.Run("rejects invalid segments, with the query error", func(t *testing.T) {
+		code, _, body := makeJSONRequest(mux, http.MethodPost, "/segments", `{"name":"Gophers","query":"tag > \"go\""}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Contains(t, body, "operator > cannot be used with tag")
+
+		for _, body := range []string{`{"query":"tag = \"go\""}`, `{"name":"Gophers"}`, `not json`} {
+			code, _, _ := makeJSONRequest(mux, http.MethodPost, "/segments", body)
+			require.Equal(t, http.StatusBadRequest, code, body)
+		}
+	})
+}
+
+func TestSegments(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.Segments(mux, &segmentsMock{}, zap.NewNop())
+
+	t.Run("lists segments", func(t *testing.T) {
+		code, _, body := makeJSONRequest(mux, http.MethodGet, "/segments", "")
+		require.Equal(t, http.StatusOK, code)
+		require.Contains(t, body, `"name":"Gophers"`)
+	})
+}
+
+func TestDeleteSegment(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.DeleteSegment(mux, &segmentsMock{}, zap.NewNop())
+
+	t.Run("deletes a segment", func(t *testing.T) {
+		require.Equal(t, http.StatusNoContent, makeDeleteRequest(mux, "/segments/1"))
+	})
+
+	t.Run("returns 409 if campaigns use the segment", func(t *testing.T) {
+		require.Equal(t, http.StatusConflict, makeDeleteRequest(mux, "/segments/2"))
+	})
+
+	t.Run("returns 404 if there is no such segment", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, makeDeleteRequest(mux, "/segments/3"))
+	})
+}
+
+func TestSegmentCount(t *testing.T) {
+	mux := chi.NewMux()
+	s := &segmentsMock{}
+	handlers.SegmentCount(mux, s, zap.NewNop())
+
+	t.Run("counts the subscribers in a segment query", func(t *testing.T) {
+		code, _, body := makeJSONRequest(mux, http.MethodPost, "/segments/count",
+			`{"list_id":"golang","query":"tag = \"go\" AND signed_up > 2026-01-01"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.JSONEq(t, `{"count":42}`, body)
+		require.Equal(t, "golang", s.listID)
+		require.Equal(t, `tag = "go" AND signed_up > 2026-01-01`, s.query)
+	})
+
+	t.Run("rejects invalid queries", func(t *testing.T) {
+		code, _, body := makeJSONRequest(mux, http.MethodPost, "/segments/count", `{"query":"signed_up > yesterday"}`)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Contains(t, body, "expected a date")
+	})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type subscriberExporter interface {
+	ExportSubscriber(ctx context.Context, email model.Email) (model.SubjectAccessExport, error)
+}
+
+// SubscriberExport returns everything stored about the email in the query as JSON, for subject access requests.
+func SubscriberExport(mux chi.Router, e subscriberExporter, log *zap.Logger) {
+	mux.Get("/subscribers/export", func(w http.ResponseWriter, r *http.Request) {
+		email := model.Email(r.URL.Query().Get("email"))
+		if !email.IsValid() {
+			http.Error(w, "email is invalid", http.StatusBadRequest)
+			return
+		}
+
+		export, err := e.ExportSubscriber(r.Context(), email)
+		if err != nil {
+			log.Info("Error exporting subscriber", zap.Error(err))
+			http.Error(w, "error exporting subscriber", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(export)
+	})
+}
+
+type subscriberEraser interface {
+	EraseSubscriber(ctx context.Context, email model.Email) error
+}
+
+// SubscriberErase deletes the personal data stored about the email from the form, for erasure requests.
+func SubscriberErase(mux chi.Router, e subscriberEraser, log *zap.Logger) {
+	mux.Post("/subscribers/erase", func(w http.ResponseWriter, r *http.Request) {
+		email := model.Email(r.FormValue("email"))
+		if !email.IsValid() {
+			http.Error(w, "email is invalid", http.StatusBadRequest)
+			return
+		}
+
+		if err := e.EraseSubscriber(r.Context(), email); err != nil {
+			log.Info("Error erasing subscriber", zap.Error(err))
+			http.Error(w, "error erasing subscriber", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,74 @@
+package handlers_test
+
+import (
+	"Goo/handlers"
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type subscriberPrivacyMock struct {
+	erased model.Email
+}
+
+func (s *subscriberPrivacyMock) ExportSubscriber(_ context.Context, email model.Email) (model.SubjectAccessExport, error) {
+	return model.SubjectAccessExport{
+		Email:       email,
+		Subscribers: []model.Subscriber{{ListID: "newsletter", Email: email, State: model.StateConfirmed, PreferencesToken: "secret"}},
+		Events:      []model.SubscriberEvent{},
+		Consents:    []model.Consent{},
+	}, nil
+}
+
+func (s *subscriberPrivacyMock) EraseSubscriber(_ context.Context, email model.Email) error {
+	s.erased = email
+	return nil
+}
+
+func TestSubscriberExport(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.SubscriberExport(mux, &subscriberPrivacyMock{}, zap.NewNop())
+
+	t.Run("exports the subscriber as JSON", func(t *testing.T) {
+		code, header, body := makeGetRequest(mux, "/subscribers/export?email=me%40example.com")
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "application/json", header.Get("Content-Type"))
+		require.NotContains(t, body, "secret")
+
+		var export model.SubjectAccessExport
+		err := json.Unmarshal([]byte(body), &export)
+		require.NoError(t, err)
+		require.Equal(t, model.Email("me@example.com"), export.Email)
+		require.Equal(t, 1, len(export.Subscribers))
+		require.Equal(t, model.StateConfirmed, export.Subscribers[0].State)
+	})
+
+	t.Run("rejects an invalid email address", func(t *testing.T) {
+		code, _, _ := makeGetRequest(mux, "/subscribers/export?email=notanemail")
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestSubscriberErase(t *testing.T) {
+	mux := chi.NewMux()
+	e := &subscriberPrivacyMock{}
+	handlers.SubscriberErase(mux, e, zap.NewNop())
+
+	t.Run("erases the subscriber", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/subscribers/erase", createFormHeader(), strings.NewReader("email=me%40example.com"))
+		require.Equal(t, http.StatusNoContent, code)
+		require.Equal(t, model.Email("me@example.com"), e.erased)
+	})
+
+	t.Run("rejects an invalid email address", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/subscribers/erase", createFormHeader(), strings.NewReader("email=notanemail"))
+		require.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"Goo/model"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type suppressionGetter interface {
+	GetSuppressions(ctx context.Context) ([]model.Suppression, error)
+}
+
+// Suppressions as JSON.
+func Suppressions(mux chi.Router, g suppressionGetter, log *zap.Logger) {
+	mux.Get("/suppressions", func(w http.ResponseWriter, r *http.Request) {
+		suppressions, err := g.GetSuppressions(r.Context())
+		if err != nil {
+			log.Info("Error getting suppressions", zap.Error(err))
+			http.Error(w, "error getting suppressions", http.StatusBadGateway)
+			return
+		}
+		if suppressions == nil {
+			suppressions = []model.Suppression{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(suppressions)
+	})
+}
+
+type suppressionAdder interface {
+	AddSuppression(ctx context.Context, s model.Suppression) (model.Suppression, error)
+}
+
+// AddSuppression from the form values value, reason and expires, and return it as JSON.
+// The value is an email address or a domain. The reason defaults to manual, and expires is optional, see parseExpires.
+func AddSuppression(mux chi.Router, a suppressionAdder, log *zap.Logger) {
+	mux.Post("/suppressions", func(w http.ResponseWriter, r *http.Request) {
+		s, err := newSuppression(r.FormValue("value"), r.FormValue("reason"), r.FormValue("expires"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s, err = a.AddSuppression(r.Context(), s)
+		if err != nil {
+			log.Info("Error adding suppression", zap.Error(err))
+			http.Error(w, "error adding suppression", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(s)
+	})
+}
+
+type suppressionDeleter interface {
+	DeleteSuppression(ctx context.Context, id int) (bool, error)
+}
+
+// DeleteSuppression with the ID in the path.
+func DeleteSuppression(mux chi.Router, d suppressionDeleter, log *zap.Logger) {
+	mux.Delete("/suppressions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "id is invalid", http.StatusBadRequest)
+			return
+		}
+
+		deleted, err := d.DeleteSuppression(r.Context(), id)
+		if err != nil {
+			log.Info("Error deleting suppression", zap.Error(err))
+			http.Error(w, "error deleting suppression", http.StatusBadGateway)
+			return
+		}
+		if !deleted {
+			http.Error(w, "no such suppression", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+type suppressionImporter interface {
+	ImportSuppressions(ctx context.Context, suppressions []model.Suppression) (int, error)
+}
+
+// ImportSuppressions from a CSV request body with the columns value, reason and expires, like in AddSuppression.
+// Only the value is required. Nothing is imported if any line is invalid.
+func ImportSuppressions(mux chi.Router, i suppressionImporter, log *zap.Logger) {
+	mux.Post("/suppressions/import", func(w http.ResponseWriter, r *http.Request) {
+		reader := csv.NewReader(http.MaxBytesReader(w, r.Body, 10<<20))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+
+		var suppressions []model.Suppression
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				http.Error(w, "bad CSV: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(record) > 3 {
+				line, _ := reader.FieldPos(0)
+				http.Error(w, fmt.Sprintf("line %v has too many columns", line), http.StatusBadRequest)
+				return
+			}
+			record = append(record, "", "")
+			s, err := newSuppression(record[0], record[1], record[2])
+			if err != nil {
+				line, _ := reader.FieldPos(0)
+				http.Error(w, fmt.Sprintf("line %v: %v", line, err), http.StatusBadRequest)
+				return
+			}
+			suppressions = append(suppressions, s)
+		}
+
+		count, err := i.ImportSuppressions(r.Context(), suppressions)
+		if err != nil {
+			log.Info("Error importing suppressions", zap.Error(err))
+			http.Error(w, "error importing suppressions", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"imported": count})
+	})
+}
+
+// newSuppression from strings, returning an error that can be shown to the user if they are invalid.
+func newSuppression(value, reason, expires string) (model.Suppression, error) {
+	if reason == "" {
+		reason = string(model.SuppressionManual)
+	}
+	expiresTime, err := parseExpires(expires)
+	if err != nil {
+		return model.Suppression{}, err
+	}
+	s := model.NewSuppression(value, model.SuppressionReason(strings.TrimSpace(reason)), expiresTime)
+	if !s.IsValid() {
+		return model.Suppression{}, errors.New("suppression is invalid")
+	}
+	return s, nil
+}
+
+// parseExpires as either an RFC 3339 timestamp or a date. Returns nil for the empty string, which never expires.
+func parseExpires(expires string) (*time.Time, error) {
+	expires = strings.TrimSpace(expires)
+	if expires == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, expires); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, errors.New("expires is invalid")
+}
@@ -0,0 +1,138 @@
+package handlers_test
+
+import (
+	"Goo/handlers"
+	"Goo/model"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type suppressionsMock struct {
+	added    model.Suppression
+	imported []model.Suppression
+}
+
+func (s *suppressionsMock) GetSuppressions(_ context.Context) ([]model.Suppression, error) {
+	return []model.Suppression{{ID: 1, Kind: model.SuppressionDomain, Value: "example.com", Reason: model.SuppressionBounce}}, nil
+}
+
+func (s *suppressionsMock) AddSuppression(_ context.Context, suppression model.Suppression) (model.Suppression, error) {
+	s.added = suppression
+	suppression.ID = 2
+	return suppression, nil
+}
+
+func (s *suppressionsMock) DeleteSuppression(_ context.Context, id int) (bool, error) {
+	return id == 1, nil
+}
+
+func (s *suppressionsMock) ImportSuppressions(_ context.Context, suppressions []model.Suppression) (int, error) {
+	s.imported = suppressions
+	return len(suppressions), nil
+}
+
+func TestSuppressions(t *testing.T) {
+	t.Run("returns suppressions as JSON", func(t *testing.T) {
+		mux := chi.NewMux()
+		handlers.Suppressions(mux, &suppressionsMock{}, zap.NewNop())
+
+		code, _, body := makeGetRequest(mux, "/suppressions")
+		require.Equal(t, http.StatusOK, code)
+
+		var suppressions []model.Suppression
+		err := json.Unmarshal([]byte(body), &suppressions)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(suppressions))
+		require.Equal(t, "example.com", suppressions[0].Value)
+	})
+}
+
+func TestAddSuppression(t *testing.T) {
+	mux := chi.NewMux()
+	s := &suppressionsMock{}
+	handlers.AddSuppression(mux, s, zap.NewNop())
+
+	t.Run("adds a manual suppression of an address", func(t *testing.T) {
+		code, _, body := makePostRequest(mux, "/suppressions", createFormHeader(), strings.NewReader("value=Me%40example.com"))
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, model.SuppressionAddress, s.added.Kind)
+		require.Equal(t, "me@example.com", s.added.Value)
+		require.Equal(t, model.SuppressionManual, s.added.Reason)
+		require.Nil(t, s.added.Expires)
+		require.Contains(t, body, `"id":2`)
+	})
+
+	t.Run("adds an expiring suppression of a domain", func(t *testing.T) {
+		code, _, _ := makePostRequest(mux, "/suppressions", createFormHeader(),
+			strings.NewReader("value=example.com&reason=bounce&expires=2027-01-01"))
+		require.Equal(t, http.StatusCreated, code)
+		require.Equal(t, model.SuppressionDomain, s.added.Kind)
+		require.Equal(t, model.SuppressionBounce, s.added.Reason)
+		require.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), *s.added.Expires)
+	})
+
+	t.Run("rejects invalid suppressions", func(t *testing.T) {
+		for _, body := range []string{"value=notadomain", "value=example.com&reason=erasure", "value=example.com&expires=tomorrow"} {
+			code, _, _ := makePostRequest(mux, "/suppressions", createFormHeader(), strings.NewReader(body))
+			require.Equal(t, http.StatusBadRequest, code, body)
+		}
+	})
+}
+
+func TestDeleteSuppression(t *testing.T) {
+	mux := chi.NewMux()
+	handlers.DeleteSuppression(mux, &suppressionsMock{}, zap.NewNop())
+
+	t.Run("deletes a suppression", func(t *testing.T) {
+		code := makeDeleteRequest(mux, "/suppressions/1")
+		require.Equal(t, http.StatusNoContent, code)
+	})
+
+	t.Run("returns 404 if there is no such suppression", func(t *testing.T) {
+		code := makeDeleteRequest(mux, "/suppressions/3")
+		require.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestImportSuppressions(t *testing.T) {
+	mux := chi.NewMux()
+	s := &suppressionsMock{}
+	handlers.ImportSuppressions(mux, s, zap.NewNop())
+
+	t.Run("imports suppressions from CSV", func(t *testing.T) {
+		code, _, body := makePostRequest(mux, "/suppressions/import", http.Header{},
+			strings.NewReader("me@example.com\nexample.org,bounce\nyou@example.com, complaint, 2027-01-01\n"))
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, "{\"imported\":3}\n", body)
+		require.Equal(t, 3, len(s.imported))
+		require.Equal(t, model.SuppressionManual, s.imported[0].Reason)
+		require.Equal(t, model.SuppressionDomain, s.imported[1].Kind)
+		require.Equal(t, model.SuppressionComplaint, s.imported[2].Reason)
+		require.NotNil(t, s.imported[2].Expires)
+	})
+
+	t.Run("imports nothing if a line is invalid", func(t *testing.T) {
+		s.imported = nil
+		code, _, body := makePostRequest(mux, "/suppressions/import", http.Header{},
+			strings.NewReader("me@example.com\nnotanaddress\n"))
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Contains(t, body, "line 2")
+		require.Nil(t, s.imported)
+	})
+}
+
+func makeDeleteRequest(handler http.Handler, target string) int {
+	req := httptest.NewRequest(http.MethodDelete, target, nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res.Result().StatusCode
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"Goo/model"
+	"Goo/signing"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// transparentGIF is a 1x1 transparent GIF image.
+var transparentGIF, _ = base64.StdEncoding.DecodeString("R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7")
+
+// imageProxyUserAgents of proxies and scanners that load images and follow links before the recipient
+// opens the email, matched case-insensitively.
+var imageProxyUserAgents = []string{"yahoomailproxy", "barracuda", "mimecast"}
+
+// appleMailProxyNetwork is where Apple Mail Privacy Protection loads images from when the email is received.
+var _, appleMailProxyNetwork, _ = net.ParseCIDR("17.0.0.0/8")
+
+type openRecorder interface {
+	RecordDeliveryOpen(ctx context.Context, id int) (bool, error)
+}
+
+// TrackOpen of the delivery with the signed ID in the path, from the tracking pixel in campaign emails,
+// and respond with a transparent GIF. Only the first open of a delivery is recorded.
+// Prefetches by known image proxies are not recorded, as the recipient has not necessarily opened the email.
+// The image is returned even if the open cannot be recorded, so the email does not show a broken image.
+func TrackOpen(mux chi.Router, o openRecorder, v verifier, log *zap.Logger) {
+	mux.Get("/t/o/{id}", func(w http.ResponseWriter, r *http.Request) {
+		token := chi.URLParam(r, "id")
+		if !strings.HasSuffix(token, ".gif") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if value, ok := v.Verify(signing.Open, strings.TrimSuffix(token, ".gif")); ok && !isImageProxyPrefetch(r) {
+			if id, err := strconv.Atoi(value); err == nil {
+				if _, err := o.RecordDeliveryOpen(r.Context(), id); err != nil {
+					log.Info("Error recording delivery open", zap.Error(err))
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Cache-Control", "no-store, max-age=0")
+		_, _ = w.Write(transparentGIF)
+	})
+}
+
+type clickRecorder interface {
+	RecordDeliveryClick(ctx context.Context, id int) (bool, error)
+}
+
+// TrackClick of the delivery with the signed delivery ID and target URL in the path, from a link in campaign emails,
+// and redirect to the target URL. Only the first click of a delivery is recorded, see model.ClickTarget.
+// Links without a valid signature are rejected without redirecting, so they cannot be used as an open redirect.
+// Link scanners are redirected like anyone else, but their clicks are not recorded.
+func TrackClick(mux chi.Router, c clickRecorder, v verifier, log *zap.Logger) {
+	mux.Get("/t/c/{token}", func(w http.ResponseWriter, r *http.Request) {
+		value, ok := v.Verify(signing.Click, chi.URLParam(r, "token"))
+		if !ok {
+			http.Error(w, "invalid link", http.StatusBadRequest)
+			return
+		}
+		id, target, ok := model.ParseClickTarget(value)
+		if !ok {
+			http.Error(w, "invalid link", http.StatusBadRequest)
+			return
+		}
+
+		if !isImageProxyPrefetch(r) {
+			if _, err := c.RecordDeliveryClick(r.Context(), id); err != nil {
+				log.Info("Error recording delivery click", zap.Error(err))
+			}
+		}
+
+		w.Header().Set("Cache-Control", "no-store, max-age=0")
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+}
+
+// isImageProxyPrefetch if the request comes from a known proxy or scanner that loads images or follows links
+// ahead of time.
+// Apple Mail Privacy Protection uses a plain Mozilla/5.0 user agent from Apple's network.
+func isImageProxyPrefetch(r *http.Request) bool {
+	userAgent := strings.ToLower(r.UserAgent())
+	for _, proxy := range imageProxyUserAgents {
+		if strings.Contains(userAgent, proxy) {
+			return true
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return r.UserAgent() == "Mozilla/5.0" && ip != nil && appleMailProxyNetwork.Contains(ip)
+}
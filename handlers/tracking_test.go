@@ -0,0 +1,149 @@
+package handlers_test
+
+import (
+	"Goo/handlers"
+	"Goo/model"
+	"Goo/signing"
+	"bytes"
+	"context"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type openRecorderMock struct {
+	opened []int
+}
+
+func (o *openRecorderMock) RecordDeliveryOpen(_ context.Context, id int) (bool, error) {
+	o.opened = append(o.opened, id)
+	return true, nil
+}
+
+func TestTrackOpen(t *testing.T) {
+	signer := signing.NewSigner("secret")
+
+	makeOpenRequest := func(handler http.Handler, target, userAgent, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.RemoteAddr = remoteAddr
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	t.Run("records an open of the signed delivery and returns a transparent GIF", func(t *testing.T) {
+		mux := chi.NewMux()
+		o := &openRecorderMock{}
+		handlers.TrackOpen(mux, o, signer, zap.NewNop())
+
+		res := makeOpenRequest(mux, "/t/o/"+signer.Sign(signing.Open, "123")+".gif", "Mozilla/5.0 (Macintosh)", "192.0.2.1:1234")
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Equal(t, "image/gif", res.Header().Get("Content-Type"))
+		require.Equal(t, []int{123}, o.opened)
+
+		image, err := gif.Decode(bytes.NewReader(res.Body.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, 1, image.Bounds().Dx())
+		require.Equal(t, 1, image.Bounds().Dy())
+	})
+
+	t.Run("does not record opens with a bad signature, but still returns the GIF", func(t *testing.T) {
+		mux := chi.NewMux()
+		o := &openRecorderMock{}
+		handlers.TrackOpen(mux, o, signer, zap.NewNop())
+
+		for _, token := range []string{signing.NewSigner("other").Sign(signing.Open, "123"), signer.Sign(signing.Click, "123"), "123", signer.Sign(signing.Open, "abc")} {
+			res := makeOpenRequest(mux, "/t/o/"+token+".gif", "Mozilla/5.0 (Macintosh)", "192.0.2.1:1234")
+			require.Equal(t, http.StatusOK, res.Code, token)
+			require.Equal(t, "image/gif", res.Header().Get("Content-Type"))
+		}
+		require.Empty(t, o.opened)
+	})
+
+	t.Run("does not record prefetches by image proxies", func(t *testing.T) {
+		mux := chi.NewMux()
+		o := &openRecorderMock{}
+		handlers.TrackOpen(mux, o, signer, zap.NewNop())
+
+		target := "/t/o/" + signer.Sign(signing.Open, "123") + ".gif"
+		makeOpenRequest(mux, target, "YahooMailProxy; https://help.yahoo.com/kb/yahoo-mail-proxy-SLN28749.html", "192.0.2.1:1234")
+		makeOpenRequest(mux, target, "Mozilla/5.0", "17.58.1.2:1234")
+		require.Empty(t, o.opened)
+
+		makeOpenRequest(mux, target, "Mozilla/5.0", "192.0.2.1:1234")
+		require.Equal(t, []int{123}, o.opened)
+	})
+
+	t.Run("returns 404 for other paths", func(t *testing.T) {
+		mux := chi.NewMux()
+		handlers.TrackOpen(mux, &openRecorderMock{}, signer, zap.NewNop())
+
+		res := makeOpenRequest(mux, "/t/o/"+signer.Sign(signing.Open, "123"), "Mozilla/5.0", "192.0.2.1:1234")
+		require.Equal(t, http.StatusNotFound, res.Code)
+	})
+}
+
+type clickRecorderMock struct {
+	clicked []int
+}
+
+func (c *clickRecorderMock) RecordDeliveryClick(_ context.Context, id int) (bool, error) {
+	c.clicked = append(c.clicked, id)
+	return true, nil
+}
+
+func TestTrackClick(t *testing.T) {
+	signer := signing.NewSigner("secret")
+
+	t.Run("records a click of the signed delivery and redirects to the target", func(t *testing.T) {
+		mux := chi.NewMux()
+		c := &clickRecorderMock{}
+		handlers.TrackClick(mux, c, signer, zap.NewNop())
+
+		code, header, _ := makeGetRequest(mux, "/t/c/"+signer.Sign(signing.Click, model.ClickTarget(123, "https://example.com/a?b=c&d=e")))
+		require.Equal(t, http.StatusFound, code)
+		require.Equal(t, "https://example.com/a?b=c&d=e", header.Get("Location"))
+		require.Equal(t, []int{123}, c.clicked)
+	})
+
+	t.Run("does not redirect with a bad signature", func(t *testing.T) {
+		mux := chi.NewMux()
+		c := &clickRecorderMock{}
+		handlers.TrackClick(mux, c, signer, zap.NewNop())
+
+		tokens := []string{
+			signing.NewSigner("other").Sign(signing.Click, model.ClickTarget(123, "https://evil.example.com")),
+			signer.Sign(signing.Open, model.ClickTarget(123, "https://evil.example.com")),
+			signer.Sign(signing.Unsubscribe, model.ClickTarget(123, "https://evil.example.com")),
+			model.ClickTarget(123, "https://evil.example.com"),
+			strings.Replace(signer.Sign(signing.Click, model.ClickTarget(123, "https://example.com")), ".", "x.", 1),
+		}
+		for _, token := range tokens {
+			code, header, _ := makeGetRequest(mux, "/t/c/"+url.PathEscape(token))
+			require.Equal(t, http.StatusBadRequest, code, token)
+			require.Empty(t, header.Get("Location"))
+		}
+		require.Empty(t, c.clicked)
+	})
+
+	t.Run("does not redirect to signed targets that are not http urls", func(t *testing.T) {
+		mux := chi.NewMux()
+		c := &clickRecorderMock{}
+		handlers.TrackClick(mux, c, signer, zap.NewNop())
+
+		for _, value := range []string{"123", "abc:https://example.com", model.ClickTarget(123, "javascript:alert(1)")} {
+			code, header, _ := makeGetRequest(mux, "/t/c/"+signer.Sign(signing.Click, value))
+			require.Equal(t, http.StatusBadRequest, code, value)
+			require.Empty(t, header.Get("Location"))
+		}
+		require.Empty(t, c.clicked)
+	})
+}
@@ -1,19 +1,27 @@
 package handlers
 
 import (
+	"Goo/model"
 	"Goo/views"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 	"net/http"
 )
 
-func FrontPage(mux chi.Router) {
+// FrontPage with the signup form and the latest issues from the archive of the default list.
+// The page is shown without issues if they cannot be fetched.
+func FrontPage(mux chi.Router, g sentCampaignGetter, p publicEmailRenderer, log *zap.Logger) {
 	mux.Get("/", func(w http.ResponseWriter, request *http.Request) {
 		tmpl, err := views.LoadTemplate()
 		if err != nil {
 			fmt.Printf("Error loading template: %v \n", err)
 			return
 		}
-		_ = tmpl.Execute(w, nil)
+		issues, err := getIssues(request.Context(), g, p, model.DefaultListID, maxFrontPageIssues)
+		if err != nil {
+			log.Info("Error getting archive issues", zap.Error(err))
+		}
+		_ = tmpl.Execute(w, map[string]interface{}{"consent_version": model.ConsentTextVersion, "issues": issues})
 	})
 }
@@ -88,6 +88,7 @@ func connect(name string) (*storage.Database, func()) {
 		MaxOpenConnections: 10,
 		MaxIdleConnections: 10,
 		Log:                nil,
+		EmailHashSalt:      "salt",
 	})
 	if err := db.Connect(); err != nil {
 		panic(err)
@@ -2,6 +2,7 @@ package integrationtest
 
 import (
 	"Goo/server"
+	"Goo/signing"
 	"net/http"
 	"testing"
 	"time"
@@ -20,6 +21,7 @@ func CreateServer() func() {
 		Port:     8080,
 		Database: db,
 		Queue:    queue,
+		Signer:   signing.NewSigner("secret"),
 	})
 
 	go func() {
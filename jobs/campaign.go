@@ -0,0 +1,319 @@
+package jobs
+
+import (
+	"Goo/model"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// campaignBatchSize is how many recipients are added and queued at a time when sending a campaign.
+const campaignBatchSize = 500
+
+type campaignFanOuter interface {
+	GetCampaign(ctx context.Context, id int) (*model.Campaign, error)
+	AddCampaignRecipients(ctx context.Context, c model.Campaign, after model.Email, limit int) (model.Email, error)
+	FinishAddingCampaignRecipients(ctx context.Context, id int) error
+	AssignCampaignVariants(ctx context.Context, c model.Campaign) error
+	GetUnqueuedCampaignRecipients(ctx context.Context, campaignID int, variantsOnly bool, limit int) ([]model.Email, error)
+	MarkCampaignRecipientsQueued(ctx context.Context, campaignID int, emails []model.Email) error
+	StartABTestWait(ctx context.Context, id int, wait time.Duration) error
+	GetCampaignRecipientTimezones(ctx context.Context, campaignID int) ([]string, error)
+	ScheduleCampaignRecipients(ctx context.Context, campaignID int, timezone string, sendAt time.Time) error
+	HasScheduledCampaignRecipients(ctx context.Context, campaignID int) (bool, error)
+	FinishSendingCampaign(ctx context.Context, id int) error
+}
+
+type sender interface {
+	Send(ctx context.Context, m model.Message) error
+}
+
+// SendCampaign to all confirmed subscribers on its list who have not paused email,
+// by queueing a campaign_email message per recipient.
+// First, all recipients are added in batches, then messages are queued in batches for those not queued yet.
+// Both steps pick up where they left off if the job is repeated after a crash. Once all recipients are added,
+// the audience is fixed: later runs of this job only queue the recipients that are not queued yet. Messages that were queued
+// but not marked as queued before a crash are queued again, which is fine, see SendCampaignEmail.
+// Campaigns with an A/B test are sent in two rounds: first only the sample that is assigned variants is queued,
+// then, once the winner is picked by PickABTestWinners, this job runs again and queues the rest with the winner.
+// Campaigns with a local send time are sent in timezone waves: recipients are scheduled for the next local send time
+// in their timezone, and only those whose time has come are queued. SendCampaignWaves runs this job again
+// for each wave, and the campaign is finished once no recipients are left waiting.
+func SendCampaign(r registry, db campaignFanOuter, q sender) {
+	r.Register("send_campaign", func(ctx context.Context, m model.Message) error {
+		id, err := model.GetCampaignID(m)
+		if err != nil {
+			return err
+		}
+
+		c, err := db.GetCampaign(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error getting campaign: %w", err)
+		}
+		if c == nil {
+			return errors.New("no such campaign")
+		}
+		// Scheduled campaigns are started in a transaction that queues this message before committing,
+		// so the message can arrive before the status changes. Erroring repeats the job later.
+		if c.Status == model.CampaignScheduled {
+			return errors.New("scheduled campaign has not started yet")
+		}
+		// The campaign may have been sent by an earlier run of this job
+		if c.Status != model.CampaignSending {
+			return nil
+		}
+		// Like scheduled campaigns, winners are picked in a transaction that queues this message before committing
+		if c.ABTest != nil && c.ABWinner == "" && c.ABTestEnds != nil && !c.ABTestEnds.After(time.Now()) {
+			return errors.New("A/B test winner has not been picked yet")
+		}
+
+		// The audience is fixed once all recipients are added, so later runs for the A/B test winner,
+		// timezone waves, or resuming don't add subscribers who confirmed after the campaign started
+		if c.RecipientsAdded == nil {
+			var after model.Email
+			for {
+				after, err = db.AddCampaignRecipients(ctx, *c, after, campaignBatchSize)
+				if err != nil {
+					return fmt.Errorf("error adding campaign recipients: %w", err)
+				}
+				if after == "" {
+					break
+				}
+			}
+			if err := db.FinishAddingCampaignRecipients(ctx, id); err != nil {
+				return fmt.Errorf("error finishing adding campaign recipients: %w", err)
+			}
+		}
+
+		if err := db.AssignCampaignVariants(ctx, *c); err != nil {
+			return fmt.Errorf("error assigning campaign variants: %w", err)
+		}
+
+		if c.LocalSendTime != "" {
+			timezones, err := db.GetCampaignRecipientTimezones(ctx, id)
+			if err != nil {
+				return fmt.Errorf("error getting campaign recipient timezones: %w", err)
+			}
+			now := time.Now()
+			for _, timezone := range timezones {
+				if err := db.ScheduleCampaignRecipients(ctx, id, timezone, c.NextLocalSendTime(timezone, now)); err != nil {
+					return fmt.Errorf("error scheduling campaign recipients: %w", err)
+				}
+			}
+		}
+
+		for {
+			emails, err := db.GetUnqueuedCampaignRecipients(ctx, id, c.ABTest != nil, campaignBatchSize)
+			if err != nil {
+				return fmt.Errorf("error getting campaign recipients: %w", err)
+			}
+			if len(emails) == 0 {
+				break
+			}
+
+			for _, email := range emails {
+				recipientMessage := model.NewCampaignMessage("campaign_email", id)
+				recipientMessage["email"] = email.String()
+				if err := q.Send(ctx, recipientMessage); err != nil {
+					return fmt.Errorf("error queueing campaign email: %w", err)
+				}
+			}
+
+			if err := db.MarkCampaignRecipientsQueued(ctx, id, emails); err != nil {
+				return fmt.Errorf("error marking campaign recipients as queued: %w", err)
+			}
+		}
+
+		if c.ABTest != nil && c.ABWinner == "" {
+			wait := time.Duration(c.ABTest.WaitMinutes) * time.Minute
+			if err := db.StartABTestWait(ctx, id, wait); err != nil {
+				return fmt.Errorf("error starting to wait for A/B test results: %w", err)
+			}
+			return nil
+		}
+
+		if c.LocalSendTime != "" {
+			scheduled, err := db.HasScheduledCampaignRecipients(ctx, id)
+			if err != nil {
+				return fmt.Errorf("error checking for scheduled campaign recipients: %w", err)
+			}
+			if scheduled {
+				return nil
+			}
+		}
+
+		if err := db.FinishSendingCampaign(ctx, id); err != nil {
+			return fmt.Errorf("error finishing campaign: %w", err)
+		}
+		return nil
+	})
+}
+
+type abTestWinnerPicker interface {
+	PickDueABTestWinner(ctx context.Context, start func(c model.Campaign) error) (bool, error)
+}
+
+// PickABTestWinners every minute for campaigns whose A/B test wait has ended, queueing a send_campaign message
+// for each, which sends the winning variant to the rest of the recipients.
+// Campaigns are claimed in storage, so each winner is picked once even with several instances.
+func PickABTestWinners(r periodicRegistry, db abTestWinnerPicker, q sender) {
+	r.RegisterPeriodic("pick_ab_test_winners", time.Minute, func(ctx context.Context, _ model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+
+		for {
+			picked, err := db.PickDueABTestWinner(ctx, func(c model.Campaign) error {
+				return q.Send(ctx, model.NewCampaignMessage("send_campaign", c.ID))
+			})
+			if err != nil {
+				return fmt.Errorf("error picking A/B test winner: %w", err)
+			}
+			if !picked {
+				return nil
+			}
+		}
+	})
+}
+
+type dueRecipientsGetter interface {
+	GetCampaignsWithDueRecipients(ctx context.Context) ([]int, error)
+}
+
+// SendCampaignWaves every minute, queueing a send_campaign message for each campaign being sent at a local send time
+// that has recipients whose time has come, which queues the next timezone wave.
+// If this runs on several instances at the same time, the message may be queued more than once,
+// which is fine, see SendCampaign.
+func SendCampaignWaves(r periodicRegistry, db dueRecipientsGetter, q sender) {
+	r.RegisterPeriodic("send_campaign_waves", time.Minute, func(ctx context.Context, _ model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+
+		ids, err := db.GetCampaignsWithDueRecipients(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting campaigns with due recipients: %w", err)
+		}
+		for _, id := range ids {
+			if err := q.Send(ctx, model.NewCampaignMessage("send_campaign", id)); err != nil {
+				return fmt.Errorf("error queueing campaign wave: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+type dueCampaignStarter interface {
+	StartDueCampaign(ctx context.Context, start func(c model.Campaign) error) (bool, error)
+}
+
+// SendScheduledCampaigns every minute, starting each scheduled campaign that is due by queueing a send_campaign message.
+// Campaigns are claimed in storage, so each is started once even if this runs on several instances at the same time.
+func SendScheduledCampaigns(r periodicRegistry, db dueCampaignStarter, q sender) {
+	r.RegisterPeriodic("send_scheduled_campaigns", time.Minute, func(ctx context.Context, _ model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+
+		for {
+			started, err := db.StartDueCampaign(ctx, func(c model.Campaign) error {
+				return q.Send(ctx, model.NewCampaignMessage("send_campaign", c.ID))
+			})
+			if err != nil {
+				return fmt.Errorf("error starting scheduled campaign: %w", err)
+			}
+			if !started {
+				return nil
+			}
+		}
+	})
+}
+
+type campaignRecipientClaimer interface {
+	ClaimCampaignRecipient(ctx context.Context, campaignID int, email model.Email) (*model.Campaign, *model.Subscriber, error)
+	ReleaseCampaignRecipient(ctx context.Context, campaignID int, email model.Email) error
+}
+
+type campaignEmailSender interface {
+	SendCampaignEmail(ctx context.Context, c model.Campaign, to model.Subscriber, deliveryID int) error
+}
+
+// SendCampaignEmail to one recipient. The recipient is claimed before sending, so it's sent at most once,
+// even if the message is queued or received more than once. If sending fails, the claim is released,
+// so the job can be repeated, except for suppressed recipients, which are skipped.
+// The campaign status is checked when claiming: recipients of paused and cancelled campaigns are skipped.
+// Paused recipients are not lost, as resuming queues them again, see storage.Database.ResumeCampaign.
+// Each attempt is recorded on the delivery for the campaign and recipient.
+func SendCampaignEmail(r registry, db campaignRecipientClaimer, es campaignEmailSender, d deliveryRecorder) {
+	r.Register("campaign_email", func(_ context.Context, m model.Message) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		id, err := model.GetCampaignID(m)
+		if err != nil {
+			return err
+		}
+		email, ok := m["email"]
+		if !ok {
+			return errors.New("no email address in message")
+		}
+
+		c, to, err := db.ClaimCampaignRecipient(ctx, id, model.Email(email))
+		if err != nil {
+			return fmt.Errorf("error claiming campaign recipient: %w", err)
+		}
+		if c == nil {
+			return nil
+		}
+
+		delivery := model.Delivery{CampaignID: &c.ID, ListID: to.ListID, Email: to.Email}
+		err = deliver(ctx, d, delivery, func(deliveryID int) error {
+			return es.SendCampaignEmail(ctx, *c, *to, deliveryID)
+		})
+		if err != nil {
+			if !errors.Is(err, model.ErrSuppressed) {
+				if err := db.ReleaseCampaignRecipient(ctx, id, model.Email(email)); err != nil {
+					return fmt.Errorf("error releasing campaign recipient: %w", err)
+				}
+			}
+			return fmt.Errorf("error sending campaign email: %w", err)
+		}
+
+		return nil
+	})
+}
+
+type campaignGetter interface {
+	GetCampaign(ctx context.Context, id int) (*model.Campaign, error)
+}
+
+// SendCampaignTestEmail of the campaign as it is now to one seed address, with model.TestSubjectMarker in front
+// of the subject. Test emails are sent like real campaign emails, but are not claimed or recorded as deliveries.
+func SendCampaignTestEmail(r registry, db campaignGetter, es campaignEmailSender) {
+	r.Register("campaign_test_email", func(_ context.Context, m model.Message) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		id, err := model.GetCampaignID(m)
+		if err != nil {
+			return err
+		}
+		email, ok := m["email"]
+		if !ok {
+			return errors.New("no email address in message")
+		}
+
+		c, err := db.GetCampaign(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error getting campaign: %w", err)
+		}
+		if c == nil {
+			return errors.New("no such campaign")
+		}
+
+		to := model.Subscriber{ListID: c.ListID, Email: model.Email(email)}
+		// Without a delivery, opens and clicks of test emails are not tracked
+		if err := es.SendCampaignEmail(ctx, c.AsTest(), to, 0); err != nil {
+			return fmt.Errorf("error sending campaign test email: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,605 @@
+package jobs_test
+
+import (
+	"Goo/jobs"
+	"Goo/model"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// campaignDatabaseMock keeps campaign recipients in memory, like the database.
+type campaignDatabaseMock struct {
+	campaign    model.Campaign
+	subscribers []model.Email
+	recipients  map[model.Email]bool // queued or not
+	variants    map[model.Email]string
+	timezones   map[model.Email]string
+	sendAt      map[model.Email]time.Time
+	claimed     map[model.Email]bool
+	finished    bool
+}
+
+func newCampaignDatabaseMock(count int) *campaignDatabaseMock {
+	db := &campaignDatabaseMock{
+		campaign:   model.Campaign{ID: 1, ListID: "newsletter", Status: model.CampaignSending},
+		recipients: map[model.Email]bool{},
+		variants:   map[model.Email]string{},
+		timezones:  map[model.Email]string{},
+		sendAt:     map[model.Email]time.Time{},
+		claimed:    map[model.Email]bool{},
+	}
+	for i := 0; i < count; i++ {
+		db.subscribers = append(db.subscribers, model.Email(fmt.Sprintf("%04d@example.com", i)))
+	}
+	return db
+}
+
+func (m *campaignDatabaseMock) GetCampaign(_ context.Context, id int) (*model.Campaign, error) {
+	if id != m.campaign.ID {
+		return nil, nil
+	}
+	c := m.campaign
+	return &c, nil
+}
+
+func (m *campaignDatabaseMock) AddCampaignRecipients(_ context.Context, _ model.Campaign, after model.Email, limit int) (model.Email, error) {
+	var last model.Email
+	for _, email := range m.subscribers {
+		if email <= after || limit == 0 {
+			continue
+		}
+		if _, ok := m.recipients[email]; !ok {
+			m.recipients[email] = false
+		}
+		last = email
+		limit--
+	}
+	return last, nil
+}
+
+func (m *campaignDatabaseMock) FinishAddingCampaignRecipients(_ context.Context, _ int) error {
+	if m.campaign.RecipientsAdded == nil {
+		added := time.Now()
+		m.campaign.RecipientsAdded = &added
+	}
+	return nil
+}
+
+// AssignCampaignVariants to the first recipients by email for the sample, instead of random ones.
+func (m *campaignDatabaseMock) AssignCampaignVariants(_ context.Context, c model.Campaign) error {
+	if c.ABTest == nil {
+		return nil
+	}
+	var emails []model.Email
+	for email := range m.recipients {
+		emails = append(emails, email)
+	}
+	sort.Slice(emails, func(i, j int) bool { return emails[i] < emails[j] })
+
+	if c.ABWinner != "" {
+		for _, email := range emails {
+			if m.variants[email] == "" {
+				m.variants[email] = c.ABWinner
+			}
+		}
+		return nil
+	}
+	if len(m.variants) > 0 {
+		return nil
+	}
+	names := c.ABTest.VariantNames()
+	sample := (len(emails)*c.ABTest.SamplePercent + 99) / 100
+	for i, email := range emails[:sample] {
+		m.variants[email] = names[i%len(names)]
+	}
+	return nil
+}
+
+func (m *campaignDatabaseMock) GetUnqueuedCampaignRecipients(_ context.Context, _ int, variantsOnly bool, limit int) ([]model.Email, error) {
+	var emails []model.Email
+	for email, queued := range m.recipients {
+		sendAt, scheduled := m.sendAt[email]
+		if m.campaign.LocalSendTime != "" && (!scheduled || sendAt.After(time.Now())) {
+			continue
+		}
+		if !queued && (!variantsOnly || m.variants[email] != "") {
+			emails = append(emails, email)
+		}
+	}
+	sort.Slice(emails, func(i, j int) bool { return emails[i] < emails[j] })
+	if len(emails) > limit {
+		emails = emails[:limit]
+	}
+	return emails, nil
+}
+
+func (m *campaignDatabaseMock) MarkCampaignRecipientsQueued(_ context.Context, _ int, emails []model.Email) error {
+	for _, email := range emails {
+		m.recipients[email] = true
+	}
+	return nil
+}
+
+func (m *campaignDatabaseMock) StartABTestWait(_ context.Context, _ int, wait time.Duration) error {
+	if m.campaign.ABTestEnds == nil {
+		ends := time.Now().Add(wait)
+		m.campaign.ABTestEnds = &ends
+	}
+	return nil
+}
+
+func (m *campaignDatabaseMock) GetCampaignRecipientTimezones(_ context.Context, _ int) ([]string, error) {
+	var timezones []string
+	seen := map[string]bool{}
+	for email, queued := range m.recipients {
+		if _, scheduled := m.sendAt[email]; queued || scheduled || seen[m.timezones[email]] {
+			continue
+		}
+		seen[m.timezones[email]] = true
+		timezones = append(timezones, m.timezones[email])
+	}
+	return timezones, nil
+}
+
+func (m *campaignDatabaseMock) ScheduleCampaignRecipients(_ context.Context, _ int, timezone string, sendAt time.Time) error {
+	for email, queued := range m.recipients {
+		if _, scheduled := m.sendAt[email]; !queued && !scheduled && m.timezones[email] == timezone {
+			m.sendAt[email] = sendAt
+		}
+	}
+	return nil
+}
+
+func (m *campaignDatabaseMock) HasScheduledCampaignRecipients(_ context.Context, _ int) (bool, error) {
+	for email, queued := range m.recipients {
+		if !queued && m.sendAt[email].After(time.Now()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *campaignDatabaseMock) FinishSendingCampaign(_ context.Context, _ int) error {
+	m.finished = true
+	m.campaign.Status = model.CampaignSent
+	return nil
+}
+
+func (m *campaignDatabaseMock) ClaimCampaignRecipient(_ context.Context, _ int, email model.Email) (*model.Campaign, *model.Subscriber, error) {
+	if m.campaign.Status == model.CampaignPaused {
+		return nil, nil, model.ErrCampaignPaused
+	}
+	if _, ok := m.recipients[email]; !ok || m.claimed[email] {
+		return nil, nil, nil
+	}
+	m.claimed[email] = true
+	if m.campaign.Status == model.CampaignCancelled {
+		return nil, nil, model.ErrCampaignCancelled
+	}
+	c := m.campaign.ForVariant(m.variants[email])
+	return &c, &model.Subscriber{ListID: c.ListID, Email: email}, nil
+}
+
+func (m *campaignDatabaseMock) ReleaseCampaignRecipient(_ context.Context, _ int, email model.Email) error {
+	m.claimed[email] = false
+	return nil
+}
+
+type queueMock struct {
+	messages []model.Message
+	failAt   int
+}
+
+func (q *queueMock) Send(_ context.Context, m model.Message) error {
+	if q.failAt > 0 && len(q.messages) == q.failAt {
+		q.failAt = 0
+		return errors.New("queue is down")
+	}
+	q.messages = append(q.messages, m)
+	return nil
+}
+
+type mockCampaignEmailer struct {
+	err         error
+	sent        []model.Email
+	deliveryIDs []int
+	subject     string
+}
+
+func (m *mockCampaignEmailer) SendCampaignEmail(_ context.Context, c model.Campaign, to model.Subscriber, deliveryID int) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, to.Email)
+	m.deliveryIDs = append(m.deliveryIDs, deliveryID)
+	m.subject = c.Subject
+	return nil
+}
+
+func TestSendCampaign(t *testing.T) {
+	t.Run("queues a message for each recipient in batches and finishes the campaign", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(1234)
+		q := &queueMock{}
+		jobs.SendCampaign(r, db, q)
+
+		err := r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.Equal(t, 1234, len(q.messages))
+		require.Equal(t, model.Message{"job": "campaign_email", "campaign_id": "1", "email": "0000@example.com"}, q.messages[0])
+		require.True(t, db.finished)
+	})
+
+	t.Run("resumes after an error, and every recipient gets the email once", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(1234)
+		q := &queueMock{failAt: 700}
+		jobs.SendCampaign(r, db, q)
+		emailer := &mockCampaignEmailer{}
+		jobs.SendCampaignEmail(r, db, emailer, &deliveryRecorderMock{})
+
+		err := r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.Error(t, err)
+		require.False(t, db.finished)
+
+		err = r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.True(t, db.finished)
+		// The batch that failed halfway is queued again
+		require.Equal(t, 1234+200, len(q.messages))
+
+		for _, m := range q.messages {
+			err := r["campaign_email"](context.Background(), m)
+			require.NoError(t, err)
+		}
+		require.Equal(t, 1234, len(emailer.sent))
+	})
+
+	t.Run("does not add subscribers who confirmed after all recipients were added", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(1234)
+		q := &queueMock{failAt: 700}
+		jobs.SendCampaign(r, db, q)
+
+		err := r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.Error(t, err)
+		require.NotNil(t, db.campaign.RecipientsAdded)
+
+		db.subscribers = append(db.subscribers, "9999@example.com")
+		err = r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.True(t, db.finished)
+		require.Equal(t, 1234, len(db.recipients))
+		for _, m := range q.messages {
+			require.NotEqual(t, "9999@example.com", m["email"])
+		}
+	})
+
+	t.Run("sends A/B test variants to the sample first, and the winner to the rest after", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(100)
+		db.campaign.Subject = "Hello"
+		db.campaign.ABTest = &model.ABTest{
+			Variants:      []model.CampaignVariant{{Name: "a", Subject: "Hi"}, {Name: "b", Subject: "Hey"}},
+			SamplePercent: 20,
+			WaitMinutes:   60,
+			Metric:        model.ABTestOpens,
+		}
+		q := &queueMock{}
+		jobs.SendCampaign(r, db, q)
+		emailer := &mockCampaignEmailer{}
+		jobs.SendCampaignEmail(r, db, emailer, &deliveryRecorderMock{})
+
+		err := r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.Equal(t, 20, len(q.messages))
+		require.False(t, db.finished)
+		require.NotNil(t, db.campaign.ABTestEnds)
+
+		err = r["campaign_email"](context.Background(), q.messages[0])
+		require.NoError(t, err)
+		require.Equal(t, "Hi", emailer.subject)
+		err = r["campaign_email"](context.Background(), q.messages[1])
+		require.NoError(t, err)
+		require.Equal(t, "Hey", emailer.subject)
+
+		// Running again during the wait does nothing
+		err = r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.Equal(t, 20, len(q.messages))
+
+		db.campaign.ABWinner = "b"
+		err = r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.Equal(t, 100, len(q.messages))
+		require.True(t, db.finished)
+
+		err = r["campaign_email"](context.Background(), q.messages[99])
+		require.NoError(t, err)
+		require.Equal(t, "Hey", emailer.subject)
+	})
+
+	t.Run("errors if the A/B test wait is over but the winner is not picked yet, so it's tried again", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(10)
+		db.campaign.ABTest = &model.ABTest{
+			Variants:      []model.CampaignVariant{{Name: "a", Subject: "Hi"}, {Name: "b", Subject: "Hey"}},
+			SamplePercent: 20,
+			WaitMinutes:   60,
+			Metric:        model.ABTestOpens,
+		}
+		ends := time.Now().Add(-time.Minute)
+		db.campaign.ABTestEnds = &ends
+		q := &queueMock{}
+		jobs.SendCampaign(r, db, q)
+
+		err := r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.Error(t, err)
+		require.Equal(t, 0, len(q.messages))
+	})
+
+	t.Run("sends campaigns with a local send time in timezone waves", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(3)
+		// The next 00:00 is always in the future, so no wave is due at first
+		db.campaign.LocalSendTime = "00:00"
+		db.timezones["0000@example.com"] = "Pacific/Kiritimati"
+		db.timezones["0001@example.com"] = "Pacific/Kiritimati"
+		db.timezones["0002@example.com"] = "Pacific/Pago_Pago"
+		q := &queueMock{}
+		jobs.SendCampaign(r, db, q)
+
+		err := r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.Equal(t, 0, len(q.messages))
+		require.False(t, db.finished)
+		require.Equal(t, 3, len(db.sendAt))
+
+		// The first wave comes due
+		db.sendAt["0000@example.com"] = time.Now().Add(-time.Minute)
+		db.sendAt["0001@example.com"] = time.Now().Add(-time.Minute)
+		err = r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.Equal(t, 2, len(q.messages))
+		require.False(t, db.finished)
+
+		db.sendAt["0002@example.com"] = time.Now().Add(-time.Minute)
+		err = r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.Equal(t, 3, len(q.messages))
+		require.True(t, db.finished)
+	})
+
+	t.Run("errors if the campaign is still scheduled, so it's tried again", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(10)
+		db.campaign.Status = model.CampaignScheduled
+		q := &queueMock{}
+		jobs.SendCampaign(r, db, q)
+
+		err := r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.Error(t, err)
+		require.Equal(t, 0, len(q.messages))
+	})
+
+	t.Run("does nothing if the campaign is not being sent", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(10)
+		db.campaign.Status = model.CampaignSent
+		q := &queueMock{}
+		jobs.SendCampaign(r, db, q)
+
+		err := r["send_campaign"](context.Background(), model.NewCampaignMessage("send_campaign", 1))
+		require.NoError(t, err)
+		require.Equal(t, 0, len(q.messages))
+	})
+}
+
+func TestSendCampaignEmail(t *testing.T) {
+	t.Run("releases the recipient if sending fails, so it can be tried again", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(1)
+		db.recipients["0000@example.com"] = true
+		emailer := &mockCampaignEmailer{err: errors.New("no connection")}
+		jobs.SendCampaignEmail(r, db, emailer, &deliveryRecorderMock{})
+
+		m := model.NewCampaignMessage("campaign_email", 1)
+		m["email"] = "0000@example.com"
+		err := r["campaign_email"](context.Background(), m)
+		require.Error(t, err)
+		require.False(t, db.claimed["0000@example.com"])
+
+		emailer.err = nil
+		err = r["campaign_email"](context.Background(), m)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(emailer.sent))
+		require.Equal(t, []int{1}, emailer.deliveryIDs)
+	})
+
+	t.Run("skips recipients while the campaign is paused, and sends once they are queued again", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(1)
+		db.recipients["0000@example.com"] = true
+		db.campaign.Status = model.CampaignPaused
+		emailer := &mockCampaignEmailer{}
+		jobs.SendCampaignEmail(r, db, emailer, &deliveryRecorderMock{})
+
+		m := model.NewCampaignMessage("campaign_email", 1)
+		m["email"] = "0000@example.com"
+		err := r["campaign_email"](context.Background(), m)
+		require.ErrorIs(t, err, model.ErrCampaignPaused)
+		require.False(t, db.claimed["0000@example.com"])
+
+		db.campaign.Status = model.CampaignSending
+		err = r["campaign_email"](context.Background(), m)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(emailer.sent))
+	})
+
+	t.Run("skips recipients of cancelled campaigns", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(1)
+		db.recipients["0000@example.com"] = true
+		db.campaign.Status = model.CampaignCancelled
+		emailer := &mockCampaignEmailer{}
+		jobs.SendCampaignEmail(r, db, emailer, &deliveryRecorderMock{})
+
+		m := model.NewCampaignMessage("campaign_email", 1)
+		m["email"] = "0000@example.com"
+		err := r["campaign_email"](context.Background(), m)
+		require.ErrorIs(t, err, model.ErrCampaignCancelled)
+		require.True(t, db.claimed["0000@example.com"])
+		require.Equal(t, 0, len(emailer.sent))
+	})
+
+	t.Run("keeps suppressed recipients claimed", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(1)
+		db.recipients["0000@example.com"] = true
+		emailer := &mockCampaignEmailer{err: model.ErrSuppressed}
+		jobs.SendCampaignEmail(r, db, emailer, &deliveryRecorderMock{})
+
+		m := model.NewCampaignMessage("campaign_email", 1)
+		m["email"] = "0000@example.com"
+		err := r["campaign_email"](context.Background(), m)
+		require.ErrorIs(t, err, model.ErrSuppressed)
+		require.True(t, db.claimed["0000@example.com"])
+	})
+}
+
+// dueCampaignStarterMock has due campaigns that are started in order.
+type dueCampaignStarterMock struct {
+	due     []model.Campaign
+	started []int
+}
+
+func (m *dueCampaignStarterMock) StartDueCampaign(_ context.Context, start func(c model.Campaign) error) (bool, error) {
+	if len(m.due) == 0 {
+		return false, nil
+	}
+	if err := start(m.due[0]); err != nil {
+		return false, err
+	}
+	m.started = append(m.started, m.due[0].ID)
+	m.due = m.due[1:]
+	return true, nil
+}
+
+func TestSendScheduledCampaigns(t *testing.T) {
+	t.Run("starts all due campaigns and queues a message for each", func(t *testing.T) {
+		r := testRegistry{}
+		db := &dueCampaignStarterMock{due: []model.Campaign{{ID: 1}, {ID: 2}}}
+		q := &queueMock{}
+		jobs.SendScheduledCampaigns(r, db, q)
+
+		err := r["send_scheduled_campaigns"](context.Background(), model.Message{"job": "send_scheduled_campaigns"})
+		require.NoError(t, err)
+		require.Equal(t, []int{1, 2}, db.started)
+		require.Equal(t, []model.Message{
+			{"job": "send_campaign", "campaign_id": "1"},
+			{"job": "send_campaign", "campaign_id": "2"},
+		}, q.messages)
+	})
+
+	t.Run("leaves the campaign scheduled if queueing fails", func(t *testing.T) {
+		r := testRegistry{}
+		db := &dueCampaignStarterMock{due: []model.Campaign{{ID: 1}, {ID: 2}}}
+		q := &queueMock{failAt: 1}
+		jobs.SendScheduledCampaigns(r, db, q)
+
+		err := r["send_scheduled_campaigns"](context.Background(), model.Message{"job": "send_scheduled_campaigns"})
+		require.Error(t, err)
+		require.Equal(t, []int{1}, db.started)
+		require.Equal(t, 1, len(db.due))
+	})
+}
+
+func TestSendCampaignTestEmail(t *testing.T) {
+	t.Run("sends the campaign with a test subject without claiming or recording a delivery", func(t *testing.T) {
+		r := testRegistry{}
+		db := newCampaignDatabaseMock(0)
+		db.campaign.Subject = "Hello"
+		emailer := &mockCampaignEmailer{}
+		jobs.SendCampaignTestEmail(r, db, emailer)
+
+		m := model.NewCampaignMessage("campaign_test_email", 1)
+		m["email"] = "editor@example.com"
+		err := r["campaign_test_email"](context.Background(), m)
+		require.NoError(t, err)
+		require.Equal(t, []model.Email{"editor@example.com"}, emailer.sent)
+		require.Equal(t, "[TEST] Hello", emailer.subject)
+		require.Equal(t, []int{0}, emailer.deliveryIDs)
+		require.Equal(t, 0, len(db.claimed))
+	})
+
+	t.Run("errors if there is no such campaign", func(t *testing.T) {
+		r := testRegistry{}
+		jobs.SendCampaignTestEmail(r, newCampaignDatabaseMock(0), &mockCampaignEmailer{})
+
+		m := model.NewCampaignMessage("campaign_test_email", 2)
+		m["email"] = "editor@example.com"
+		err := r["campaign_test_email"](context.Background(), m)
+		require.Error(t, err)
+	})
+}
+
+type abTestWinnerPickerMock struct {
+	due []model.Campaign
+}
+
+func (m *abTestWinnerPickerMock) PickDueABTestWinner(_ context.Context, start func(c model.Campaign) error) (bool, error) {
+	if len(m.due) == 0 {
+		return false, nil
+	}
+	if err := start(m.due[0]); err != nil {
+		return false, err
+	}
+	m.due = m.due[1:]
+	return true, nil
+}
+
+func TestPickABTestWinners(t *testing.T) {
+	t.Run("picks winners of all due A/B tests and queues a message for each", func(t *testing.T) {
+		r := testRegistry{}
+		db := &abTestWinnerPickerMock{due: []model.Campaign{{ID: 1}, {ID: 2}}}
+		q := &queueMock{}
+		jobs.PickABTestWinners(r, db, q)
+
+		err := r["pick_ab_test_winners"](context.Background(), model.Message{"job": "pick_ab_test_winners"})
+		require.NoError(t, err)
+		require.Equal(t, 0, len(db.due))
+		require.Equal(t, []model.Message{
+			{"job": "send_campaign", "campaign_id": "1"},
+			{"job": "send_campaign", "campaign_id": "2"},
+		}, q.messages)
+	})
+}
+
+type dueRecipientsGetterMock struct {
+	ids []int
+}
+
+func (m *dueRecipientsGetterMock) GetCampaignsWithDueRecipients(_ context.Context) ([]int, error) {
+	return m.ids, nil
+}
+
+func TestSendCampaignWaves(t *testing.T) {
+	t.Run("queues a message for each campaign with due recipients", func(t *testing.T) {
+		r := testRegistry{}
+		q := &queueMock{}
+		jobs.SendCampaignWaves(r, &dueRecipientsGetterMock{ids: []int{1, 2}}, q)
+
+		err := r["send_campaign_waves"](context.Background(), model.Message{"job": "send_campaign_waves"})
+		require.NoError(t, err)
+		require.Equal(t, []model.Message{
+			{"job": "send_campaign", "campaign_id": "1"},
+			{"job": "send_campaign", "campaign_id": "2"},
+		}, q.messages)
+	})
+}
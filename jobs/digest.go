@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"Goo/model"
+	"Goo/views"
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxDigestItems is how many feed items a digest campaign has at most. Items left over go in the next digest.
+const maxDigestItems = 20
+
+// DigestOptions for SendFeedDigests.
+type DigestOptions struct {
+	// FeedURLs of RSS or Atom feeds to poll. Without any, no digests are made.
+	FeedURLs []string
+	// ListID the digest campaigns are for.
+	ListID string
+	// Subject of the digest campaigns.
+	Subject string
+	// AutoSend digest campaigns right away, instead of leaving them as drafts, see SendScheduledCampaigns.
+	AutoSend bool
+	// Interval between polls.
+	Interval time.Duration
+}
+
+type feedReader interface {
+	Read(ctx context.Context, url string) ([]model.FeedItem, error)
+}
+
+type digestCreator interface {
+	AddFeedItems(ctx context.Context, feedURL string, items []model.FeedItem) (int, error)
+	CreateDigestCampaign(ctx context.Context, feedURLs []string, limit int,
+		build func(items []model.FeedItem) (model.Campaign, error), autoSend bool) (*model.Campaign, error)
+}
+
+// SendFeedDigests polls the feeds periodically, stores items not seen before, and builds a digest campaign
+// of the items that have not been in a digest yet, see views.DigestCampaign. The digest is either scheduled right away,
+// so SendScheduledCampaigns starts sending it, or left as a draft.
+// A feed that fails to be read is skipped until the next poll, so the other feeds still get their digest.
+func SendFeedDigests(r periodicRegistry, f feedReader, db digestCreator, opts DigestOptions) {
+	if len(opts.FeedURLs) == 0 {
+		return
+	}
+
+	r.RegisterPeriodic("feed_digest", opts.Interval, func(ctx context.Context, _ model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+
+		var readErr error
+		for _, url := range opts.FeedURLs {
+			items, err := f.Read(ctx, url)
+			if err != nil {
+				readErr = fmt.Errorf("error reading feed %v: %w", url, err)
+				continue
+			}
+			if _, err := db.AddFeedItems(ctx, url, items); err != nil {
+				return fmt.Errorf("error adding feed items: %w", err)
+			}
+		}
+
+		build := func(items []model.FeedItem) (model.Campaign, error) {
+			html, text, err := views.DigestCampaign(opts.Subject, items)
+			if err != nil {
+				return model.Campaign{}, err
+			}
+			return model.Campaign{ListID: opts.ListID, Subject: opts.Subject, HTML: html, Text: text}, nil
+		}
+		if _, err := db.CreateDigestCampaign(ctx, opts.FeedURLs, maxDigestItems, build, opts.AutoSend); err != nil {
+			return fmt.Errorf("error creating digest campaign: %w", err)
+		}
+		return readErr
+	})
+}
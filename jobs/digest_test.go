@@ -0,0 +1,214 @@
+package jobs_test
+
+import (
+	"Goo/feeds"
+	"Goo/jobs"
+	"Goo/model"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// digestCreatorMock keeps feed items in memory, like the database, including marking new feeds as digested.
+type digestCreatorMock struct {
+	items     []model.FeedItem
+	digested  map[string]bool
+	campaigns []model.Campaign
+}
+
+func (m *digestCreatorMock) AddFeedItems(_ context.Context, feedURL string, items []model.FeedItem) (int, error) {
+	known := false
+	for _, item := range m.items {
+		known = known || item.FeedURL == feedURL
+	}
+	var added int
+	for _, item := range items {
+		if _, ok := m.digested[item.GUID]; ok {
+			continue
+		}
+		m.items = append(m.items, item)
+		m.digested[item.GUID] = !known
+		added++
+	}
+	return added, nil
+}
+
+func (m *digestCreatorMock) CreateDigestCampaign(_ context.Context, _ []string, limit int,
+	build func(items []model.FeedItem) (model.Campaign, error), autoSend bool) (*model.Campaign, error) {
+	var items []model.FeedItem
+	for _, item := range m.items {
+		if !m.digested[item.GUID] && len(items) < limit {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	c, err := build(items)
+	if err != nil {
+		return nil, err
+	}
+	c.ID = len(m.campaigns) + 1
+	c.Status = model.CampaignDraft
+	if autoSend {
+		c.Status = model.CampaignScheduled
+	}
+	for _, item := range items {
+		m.digested[item.GUID] = true
+	}
+	m.campaigns = append(m.campaigns, c)
+	return &c, nil
+}
+
+// feedServer serves an RSS feed at / with the given number of items, which can be changed.
+// Items get the suffix in their title and description.
+type feedServer struct {
+	*httptest.Server
+	count  int
+	suffix string
+}
+
+func newFeedServer(count int) *feedServer {
+	s := &feedServer{count: count}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		var items strings.Builder
+		for i := s.count; i > 0; i-- {
+			items.WriteString(fmt.Sprintf(`<item><title>Post %v%v</title><link>https://example.com/%v</link><guid>%v</guid>`+
+				`<description>About &lt;b&gt;post %v&lt;/b&gt;%v</description></item>`, i, s.suffix, i, i, i, s.suffix))
+		}
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Blog</title>` + items.String() + `</channel></rss>`))
+	}))
+	return s
+}
+
+func TestSendFeedDigests(t *testing.T) {
+	t.Run("creates a draft digest of items that have not been sent yet", func(t *testing.T) {
+		server := newFeedServer(2)
+		defer server.Close()
+
+		r := testRegistry{}
+		db := &digestCreatorMock{digested: map[string]bool{}}
+		jobs.SendFeedDigests(r, feeds.NewReader(feeds.NewReaderOptions{}), db, jobs.DigestOptions{
+			FeedURLs: []string{server.URL},
+			ListID:   "newsletter",
+			Subject:  "New on the blog",
+		})
+		job := r["feed_digest"]
+
+		// The items that are there when the feed is first polled have been published already
+		err := job(context.Background(), model.Message{"job": "feed_digest"})
+		require.NoError(t, err)
+		require.Empty(t, db.campaigns)
+
+		server.count = 4
+		err = job(context.Background(), model.Message{"job": "feed_digest"})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(db.campaigns))
+		c := db.campaigns[0]
+		require.Equal(t, model.CampaignDraft, c.Status)
+		require.Equal(t, "newsletter", c.ListID)
+		require.Equal(t, "New on the blog", c.Subject)
+		require.True(t, c.IsValid())
+		require.Contains(t, c.HTML, `<a href="https://example.com/4" style="color: #3869D4;">Post 4</a>`)
+		require.Contains(t, c.HTML, `About post 3`)
+		require.NotContains(t, c.HTML, `Post 2`)
+		require.Contains(t, c.HTML, `{{unsubscribe_url}}`)
+		require.Contains(t, c.Text, "Post 4\nhttps://example.com/4\nAbout post 4")
+		require.Contains(t, c.Text, "Unsubscribe: {{unsubscribe_url}}")
+
+		// Nothing new, so no digest
+		err = job(context.Background(), model.Message{"job": "feed_digest"})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(db.campaigns))
+	})
+
+	t.Run("schedules the digest right away with auto-send", func(t *testing.T) {
+		server := newFeedServer(1)
+		defer server.Close()
+
+		r := testRegistry{}
+		db := &digestCreatorMock{digested: map[string]bool{}}
+		jobs.SendFeedDigests(r, feeds.NewReader(feeds.NewReaderOptions{}), db, jobs.DigestOptions{
+			FeedURLs: []string{server.URL},
+			ListID:   "newsletter",
+			Subject:  "New on the blog",
+			AutoSend: true,
+		})
+		job := r["feed_digest"]
+
+		err := job(context.Background(), model.Message{"job": "feed_digest"})
+		require.NoError(t, err)
+		server.count = 2
+		err = job(context.Background(), model.Message{"job": "feed_digest"})
+		require.NoError(t, err)
+
+		require.Equal(t, 1, len(db.campaigns))
+		require.Equal(t, model.CampaignScheduled, db.campaigns[0].Status)
+	})
+
+	t.Run("does not let keywords in feed items be replaced", func(t *testing.T) {
+		server := newFeedServer(1)
+		defer server.Close()
+
+		r := testRegistry{}
+		db := &digestCreatorMock{digested: map[string]bool{}}
+		jobs.SendFeedDigests(r, feeds.NewReader(feeds.NewReaderOptions{}), db, jobs.DigestOptions{
+			FeedURLs: []string{server.URL},
+			ListID:   "newsletter",
+			Subject:  "New on the blog",
+		})
+		job := r["feed_digest"]
+
+		err := job(context.Background(), model.Message{"job": "feed_digest"})
+		require.NoError(t, err)
+		server.count = 2
+		server.suffix = " {{unsubscribe_url}} {{{preferences_url}}}"
+		err = job(context.Background(), model.Message{"job": "feed_digest"})
+		require.NoError(t, err)
+
+		require.Equal(t, 1, len(db.campaigns))
+		c := db.campaigns[0]
+		// Only the keywords in the footer are left
+		require.Equal(t, 1, strings.Count(c.HTML, "{{unsubscribe_url}}"))
+		require.Equal(t, 1, strings.Count(c.HTML, "{{preferences_url}}"))
+		require.Equal(t, 1, strings.Count(c.Text, "{{unsubscribe_url}}"))
+		require.Equal(t, 1, strings.Count(c.Text, "{{preferences_url}}"))
+		require.Contains(t, c.Text, "Post 2 {\u200b{\u200bunsubscribe_url}}")
+	})
+
+	t.Run("still digests the other feeds if one cannot be read, and errors", func(t *testing.T) {
+		server := newFeedServer(1)
+		defer server.Close()
+
+		r := testRegistry{}
+		db := &digestCreatorMock{digested: map[string]bool{}}
+		jobs.SendFeedDigests(r, feeds.NewReader(feeds.NewReaderOptions{}), db, jobs.DigestOptions{
+			FeedURLs: []string{server.URL + "/missing", server.URL + "/"},
+			ListID:   "newsletter",
+			Subject:  "New on the blog",
+		})
+		job := r["feed_digest"]
+
+		err := job(context.Background(), model.Message{"job": "feed_digest"})
+		require.Error(t, err)
+		server.count = 2
+		err = job(context.Background(), model.Message{"job": "feed_digest"})
+		require.Error(t, err)
+		require.Equal(t, 1, len(db.campaigns))
+	})
+
+	t.Run("is not registered without feeds", func(t *testing.T) {
+		r := testRegistry{}
+		jobs.SendFeedDigests(r, feeds.NewReader(feeds.NewReaderOptions{}), &digestCreatorMock{}, jobs.DigestOptions{})
+		require.Empty(t, r)
+	})
+}
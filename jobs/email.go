@@ -8,20 +8,41 @@ import (
 	"time"
 )
 
+type deliveryRecorder interface {
+	StartDelivery(ctx context.Context, d model.Delivery) (int, error)
+	FinishDelivery(ctx context.Context, id int, sendErr error) error
+}
+
+// deliver an email with the send function, recording the delivery before and after sending.
+// The send function gets the delivery ID, for links in the email that refer to it.
+func deliver(ctx context.Context, d deliveryRecorder, delivery model.Delivery, send func(deliveryID int) error) error {
+	id, err := d.StartDelivery(ctx, delivery)
+	if err != nil {
+		return fmt.Errorf("error starting delivery: %w", err)
+	}
+
+	sendErr := send(id)
+	// If the email was sent, don't repeat the job just because the delivery could not be updated
+	if err := d.FinishDelivery(ctx, id, sendErr); err != nil && sendErr == nil {
+		return nil
+	}
+	return sendErr
+}
+
 type newsletterConfirmationEmailSender interface {
-	SendNewsletterConfirmationEmail(ctx context.Context, to model.Email, token string) error
+	SendNewsletterConfirmationEmail(ctx context.Context, to model.Subscriber, token string) error
 }
 
-func SendNewsletterConfirmationEmail(r registry, es newsletterConfirmationEmailSender) {
+func SendNewsletterConfirmationEmail(r registry, es newsletterConfirmationEmailSender, d deliveryRecorder) {
 	// We want to finish sending this email even though the Runner is supposed to stop -> omit context from runner.
 	// Local context should only take a maximum of 10 seconds. If the job were larger, we would check for cancellation from runner.
 	r.Register("confirmation_email", func(_ context.Context, message model.Message) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		to, ok := message["email"]
-		if !ok {
-			return errors.New("no email address in message")
+		to, err := model.GetSubscriber(message)
+		if err != nil {
+			return err
 		}
 
 		token, ok := message["token"]
@@ -29,7 +50,11 @@ func SendNewsletterConfirmationEmail(r registry, es newsletterConfirmationEmailS
 			return errors.New("no token in message")
 		}
 
-		if err := es.SendNewsletterConfirmationEmail(ctx, model.Email(to), token); err != nil {
+		delivery := newTemplateDelivery("confirmation_email", message, to)
+		err = deliver(ctx, d, delivery, func(int) error {
+			return es.SendNewsletterConfirmationEmail(ctx, to, token)
+		})
+		if err != nil {
 			return fmt.Errorf("error sending newsletter confirmation email: %w", err)
 		}
 
@@ -38,23 +63,41 @@ func SendNewsletterConfirmationEmail(r registry, es newsletterConfirmationEmailS
 }
 
 type newsletterWelcomeEmailSender interface {
-	SendNewsletterWelcomeEmail(ctx context.Context, to model.Email) error
+	SendNewsletterWelcomeEmail(ctx context.Context, to model.Subscriber) error
 }
 
-func SendNewsletterWelcomeEmail(r registry, es newsletterWelcomeEmailSender) {
+func SendNewsletterWelcomeEmail(r registry, es newsletterWelcomeEmailSender, d deliveryRecorder) {
 	r.Register("welcome_email", func(_ context.Context, m model.Message) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		to, ok := m["email"]
-		if !ok {
-			return errors.New("no email address in message")
+		to, err := model.GetSubscriber(m)
+		if err != nil {
+			return err
+		}
+
+		if to.PreferencesToken == "" {
+			return errors.New("no preferences token in message")
 		}
 
-		if err := es.SendNewsletterWelcomeEmail(ctx, model.Email(to)); err != nil {
+		delivery := newTemplateDelivery("welcome_email", m, to)
+		err = deliver(ctx, d, delivery, func(int) error {
+			return es.SendNewsletterWelcomeEmail(ctx, to)
+		})
+		if err != nil {
 			return fmt.Errorf("error sending newsletter welcome email: %w", err)
 		}
 
 		return nil
 	})
 }
+
+// newTemplateDelivery for the template email to the subscriber, with the delivery ID from the message if there is one.
+func newTemplateDelivery(template string, m model.Message, to model.Subscriber) model.Delivery {
+	return model.Delivery{
+		ID:       model.GetDeliveryID(m),
+		Template: template,
+		ListID:   to.ListID,
+		Email:    to.Email,
+	}
+}
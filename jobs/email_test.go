@@ -11,11 +11,11 @@ import (
 
 type mockConfirmationEmailer struct {
 	err   error
-	to    model.Email
+	to    model.Subscriber
 	token string
 }
 
-func (m *mockConfirmationEmailer) SendNewsletterConfirmationEmail(_ context.Context, to model.Email, token string) error {
+func (m *mockConfirmationEmailer) SendNewsletterConfirmationEmail(_ context.Context, to model.Subscriber, token string) error {
 	m.to = to
 	m.token = token
 	return m.err
@@ -23,35 +23,108 @@ func (m *mockConfirmationEmailer) SendNewsletterConfirmationEmail(_ context.Cont
 
 type mockWelcomeEmailer struct {
 	err error
-	to  model.Email
+	to  model.Subscriber
 }
 
-func (m *mockWelcomeEmailer) SendNewsletterWelcomeEmail(_ context.Context, to model.Email) error {
+func (m *mockWelcomeEmailer) SendNewsletterWelcomeEmail(_ context.Context, to model.Subscriber) error {
 	m.to = to
 	return m.err
 }
 
+// deliveryRecorderMock keeps deliveries in memory, like the database.
+type deliveryRecorderMock struct {
+	deliveries []model.Delivery
+}
+
+func (m *deliveryRecorderMock) StartDelivery(_ context.Context, d model.Delivery) (int, error) {
+	for i, existing := range m.deliveries {
+		if (d.ID != 0 && existing.ID == d.ID) ||
+			(d.CampaignID != nil && existing.CampaignID != nil && *existing.CampaignID == *d.CampaignID && existing.Email == d.Email) {
+			m.deliveries[i].State = model.DeliverySending
+			m.deliveries[i].Attempts++
+			return existing.ID, nil
+		}
+	}
+	d.ID = len(m.deliveries) + 1
+	d.State = model.DeliverySending
+	d.Attempts = 1
+	m.deliveries = append(m.deliveries, d)
+	return d.ID, nil
+}
+
+func (m *deliveryRecorderMock) FinishDelivery(_ context.Context, id int, sendErr error) error {
+	d := &m.deliveries[id-1]
+	d.State = model.DeliverySent
+	d.SMTPResponse = ""
+	if sendErr != nil {
+		d.State = model.DeliveryFailed
+		d.SMTPResponse = sendErr.Error()
+	}
+	return nil
+}
+
 func TestSendNewsletterConfirmationEmail(t *testing.T) {
 	r := testRegistry{}
 
-	t.Run("passes the recipient email and token to the email sender", func(t *testing.T) {
+	t.Run("passes the recipient and token to the email sender", func(t *testing.T) {
 
 		emailer := &mockConfirmationEmailer{}
-		jobs.SendNewsletterConfirmationEmail(r, emailer)
+		jobs.SendNewsletterConfirmationEmail(r, emailer, &deliveryRecorderMock{})
 
 		job, ok := r["confirmation_email"]
 		require.True(t, ok)
 
-		err := job(context.Background(), model.Message{"email": "you@example.com", "token": "123"})
+		err := job(context.Background(), model.Message{"list": "golang", "email": "you@example.com", "first_name": "You", "token": "123"})
 		require.NoError(t, err)
 
-		require.Equal(t, "you@example.com", emailer.to.String())
+		require.Equal(t, "golang", emailer.to.ListID)
+		require.Equal(t, "you@example.com", emailer.to.Email.String())
+		require.Equal(t, "You", emailer.to.FirstName)
 		require.Equal(t, "123", emailer.token)
 	})
 
+	t.Run("records the delivery and its attempts", func(t *testing.T) {
+		emailer := &mockConfirmationEmailer{err: errors.New("wire is cut")}
+		d := &deliveryRecorderMock{}
+		jobs.SendNewsletterConfirmationEmail(r, emailer, d)
+		job := r["confirmation_email"]
+
+		m := model.Message{"email": "you@example.com", "token": "123"}
+		err := job(context.Background(), m)
+		require.Error(t, err)
+		require.Equal(t, 1, len(d.deliveries))
+		require.Equal(t, model.DeliveryFailed, d.deliveries[0].State)
+		require.Equal(t, "wire is cut", d.deliveries[0].SMTPResponse)
+
+		emailer.err = nil
+		m["delivery_id"] = "1"
+		err = job(context.Background(), m)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(d.deliveries))
+		require.Equal(t, model.Delivery{
+			ID:       1,
+			Template: "confirmation_email",
+			ListID:   "newsletter",
+			Email:    "you@example.com",
+			State:    model.DeliverySent,
+			Attempts: 2,
+		}, d.deliveries[0])
+	})
+
+	t.Run("uses the default list for messages without one", func(t *testing.T) {
+		emailer := &mockConfirmationEmailer{}
+		jobs.SendNewsletterConfirmationEmail(r, emailer, &deliveryRecorderMock{})
+		job := r["confirmation_email"]
+
+		err := job(context.Background(), model.Message{"email": "you@example.com", "token": "123"})
+		require.NoError(t, err)
+
+		require.Equal(t, "newsletter", emailer.to.ListID)
+	})
+
 	t.Run("errors on email sending failure", func(t *testing.T) {
 		emailer := &mockConfirmationEmailer{err: errors.New("wire is cut")}
-		jobs.SendNewsletterConfirmationEmail(r, emailer)
+		jobs.SendNewsletterConfirmationEmail(r, emailer, &deliveryRecorderMock{})
 		job := r["confirmation_email"]
 
 		err := job(context.Background(), model.Message{"email": "you@example.com", "token": "123"})
@@ -63,27 +136,38 @@ func TestSendNewsletterConfirmationEmail(t *testing.T) {
 func TestSendNewsletterWelcomeEmail(t *testing.T) {
 	r := testRegistry{}
 
-	t.Run("passes the recipient email to the email sender", func(t *testing.T) {
+	t.Run("passes the recipient with preferences token to the email sender", func(t *testing.T) {
 		emailer := &mockWelcomeEmailer{}
-		jobs.SendNewsletterWelcomeEmail(r, emailer)
+		jobs.SendNewsletterWelcomeEmail(r, emailer, &deliveryRecorderMock{})
 
 		job, ok := r["welcome_email"]
 		require.True(t, ok)
 
-		err := job(context.Background(), model.Message{"email": "you@example.com"})
+		err := job(context.Background(), model.Message{"list": "golang", "email": "you@example.com", "preferences_token": "456"})
 		require.NoError(t, err)
 
-		require.Equal(t, "you@example.com", emailer.to.String())
+		require.Equal(t, "golang", emailer.to.ListID)
+		require.Equal(t, "you@example.com", emailer.to.Email.String())
+		require.Equal(t, "456", emailer.to.PreferencesToken)
+	})
+
+	t.Run("errors without a preferences token", func(t *testing.T) {
+		emailer := &mockWelcomeEmailer{}
+		jobs.SendNewsletterWelcomeEmail(r, emailer, &deliveryRecorderMock{})
+		job := r["welcome_email"]
+
+		err := job(context.Background(), model.Message{"email": "you@example.com"})
+		require.Error(t, err)
 	})
 
 	t.Run("errors on email sending failure", func(t *testing.T) {
 		emailer := &mockWelcomeEmailer{err: errors.New("welcome service down")}
-		jobs.SendNewsletterWelcomeEmail(r, emailer)
+		jobs.SendNewsletterWelcomeEmail(r, emailer, &deliveryRecorderMock{})
 
 		job, ok := r["welcome_email"]
 		require.True(t, ok)
 
-		err := job(context.Background(), model.Message{"email": "you@example.com"})
+		err := job(context.Background(), model.Message{"email": "you@example.com", "preferences_token": "456"})
 		require.Error(t, err)
 	})
 }
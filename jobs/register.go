@@ -1,6 +1,15 @@
 package jobs
 
 func (r *Runner) registerJobs() {
-	SendNewsletterConfirmationEmail(r, r.emailer)
-	SendNewsletterWelcomeEmail(r, r.emailer)
+	SendNewsletterConfirmationEmail(r, r.emailer, r.database)
+	SendNewsletterWelcomeEmail(r, r.emailer, r.database)
+	SendCampaign(r, r.database, r.queue)
+	SendScheduledCampaigns(r, r.database, r.queue)
+	PickABTestWinners(r, r.database, r.queue)
+	SendCampaignWaves(r, r.database, r.queue)
+	SendCampaignEmail(r, r.database, r.emailer, r.database)
+	SendCampaignTestEmail(r, r.database, r.emailer)
+	SendFeedDigests(r, r.feeds, r.database, r.digest)
+
+	PurgeUnconfirmedSignups(r, r.database, r.unconfirmedSignupRetention, r.signupsPurged)
 }
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"Goo/model"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type unconfirmedSignupPurger interface {
+	PurgeUnconfirmedSignups(ctx context.Context, olderThan time.Duration) (int, error)
+}
+
+// PurgeUnconfirmedSignups every hour, deleting unconfirmed signups and their tokens older than the retention,
+// and adding the number of deleted signups to the counter.
+func PurgeUnconfirmedSignups(r periodicRegistry, p unconfirmedSignupPurger, retention time.Duration, purged prometheus.Counter) {
+	r.RegisterPeriodic("purge_unconfirmed_signups", time.Hour, func(ctx context.Context, _ model.Message) error {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+
+		count, err := p.PurgeUnconfirmedSignups(ctx, retention)
+		if err != nil {
+			return fmt.Errorf("error purging unconfirmed signups: %w", err)
+		}
+		purged.Add(float64(count))
+
+		return nil
+	})
+}
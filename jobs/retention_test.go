@@ -0,0 +1,39 @@
+package jobs_test
+
+import (
+	"Goo/jobs"
+	"Goo/model"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type mockUnconfirmedSignupPurger struct {
+	olderThan time.Duration
+}
+
+func (m *mockUnconfirmedSignupPurger) PurgeUnconfirmedSignups(_ context.Context, olderThan time.Duration) (int, error) {
+	m.olderThan = olderThan
+	return 3, nil
+}
+
+func TestPurgeUnconfirmedSignups(t *testing.T) {
+	t.Run("purges signups older than the retention and counts them", func(t *testing.T) {
+		r := testRegistry{}
+		p := &mockUnconfirmedSignupPurger{}
+		purged := prometheus.NewCounter(prometheus.CounterOpts{Name: "purged"})
+		jobs.PurgeUnconfirmedSignups(r, p, 48*time.Hour, purged)
+
+		job, ok := r["purge_unconfirmed_signups"]
+		require.True(t, ok)
+
+		err := job(context.Background(), model.Message{"job": "purge_unconfirmed_signups"})
+		require.NoError(t, err)
+		require.Equal(t, 48*time.Hour, p.olderThan)
+		require.Equal(t, float64(3), testutil.ToFloat64(purged))
+	})
+}
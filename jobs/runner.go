@@ -2,9 +2,12 @@
 package jobs
 
 import (
+	"Goo/feeds"
 	"Goo/messaging"
 	"Goo/model"
+	"Goo/storage"
 	"context"
+	"errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.uber.org/zap"
@@ -14,20 +17,35 @@ import (
 )
 
 type Runner struct {
+	database       *storage.Database
+	digest         DigestOptions
 	emailer        *messaging.Emailer
+	feeds          *feeds.Reader
 	jobCount       *prometheus.CounterVec
 	jobDurations   *prometheus.CounterVec
+	jobSkips       *prometheus.CounterVec
 	jobs           map[string]Func
 	log            *zap.Logger
+	periodicJobs   []periodicJob
 	queue          *messaging.Queue
 	runnerReceives *prometheus.CounterVec
+	signupsPurged  prometheus.Counter
+
+	unconfirmedSignupRetention time.Duration
 }
 
 type NewRunnerOptions struct {
+	Database *storage.Database
+	// Digest of feed items, see SendFeedDigests. The list defaults to the default list,
+	// the subject to "New on the blog", and the interval to an hour.
+	Digest  DigestOptions
 	Emailer *messaging.Emailer
 	Log     *zap.Logger
 	Metrics *prometheus.Registry
 	Queue   *messaging.Queue
+	// UnconfirmedSignupRetentionDays is how long unconfirmed signups are kept before they are purged. Defaults to 30.
+	// Negative values are not valid, and make the purge job fail.
+	UnconfirmedSignupRetentionDays int
 }
 
 func NewRunner(opts NewRunnerOptions) *Runner {
@@ -39,6 +57,22 @@ func NewRunner(opts NewRunnerOptions) *Runner {
 		opts.Metrics = prometheus.NewRegistry()
 	}
 
+	if opts.Digest.ListID == "" {
+		opts.Digest.ListID = model.DefaultListID
+	}
+
+	if opts.Digest.Subject == "" {
+		opts.Digest.Subject = "New on the blog"
+	}
+
+	if opts.Digest.Interval == 0 {
+		opts.Digest.Interval = time.Hour
+	}
+
+	if opts.UnconfirmedSignupRetentionDays == 0 {
+		opts.UnconfirmedSignupRetentionDays = 30
+	}
+
 	jobCount := promauto.With(opts.Metrics).NewCounterVec(prometheus.CounterOpts{
 		Name: "app_jobs_total",
 	}, []string{"name", "success"})
@@ -47,18 +81,33 @@ func NewRunner(opts NewRunnerOptions) *Runner {
 		Name: "app_job_duration_seconds_total",
 	}, []string{"name", "success"})
 
+	jobSkips := promauto.With(opts.Metrics).NewCounterVec(prometheus.CounterOpts{
+		Name: "app_jobs_skipped_total",
+	}, []string{"name"})
+
 	runnerReceives := promauto.With(opts.Metrics).NewCounterVec(prometheus.CounterOpts{
 		Name: "app_job_runner_receives_total",
 	}, []string{"success"})
 
+	signupsPurged := promauto.With(opts.Metrics).NewCounter(prometheus.CounterOpts{
+		Name: "app_unconfirmed_signups_purged_total",
+	})
+
 	return &Runner{
+		database:       opts.Database,
+		digest:         opts.Digest,
+		feeds:          feeds.NewReader(feeds.NewReaderOptions{}),
 		jobs:           map[string]Func{},
 		jobCount:       jobCount,
 		jobDurations:   jobDurations,
+		jobSkips:       jobSkips,
 		log:            opts.Log,
 		emailer:        opts.Emailer,
 		queue:          opts.Queue,
 		runnerReceives: runnerReceives,
+		signupsPurged:  signupsPurged,
+
+		unconfirmedSignupRetention: time.Duration(opts.UnconfirmedSignupRetentionDays) * 24 * time.Hour,
 	}
 }
 
@@ -72,6 +121,14 @@ func (r *Runner) Start(ctx context.Context) {
 	r.registerJobs()
 	var wg sync.WaitGroup
 
+	for _, p := range r.periodicJobs {
+		wg.Add(1)
+		go func(p periodicJob) {
+			defer wg.Done()
+			r.runPeriodically(ctx, p)
+		}(p)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -121,37 +178,76 @@ func (r *Runner) receiveAndRun(ctx context.Context, wg *sync.WaitGroup) {
 	go func() {
 		defer wg.Done()
 
-		log := r.log.With(zap.String("name", name))
-
-		defer func() {
-			if rec := recover(); rec != nil {
-				r.runnerReceives.WithLabelValues("false").Inc()
-				log.Info("Recovered from panic in job", zap.Any("recover", rec))
-			}
-		}()
-
-		before := time.Now()
-		err = job(ctx, *m)
-		duration := time.Since(before)
-
-		success := strconv.FormatBool(err == nil)
-		r.jobCount.WithLabelValues(name, success).Inc()
-		r.jobDurations.WithLabelValues(name, success).Add(duration.Seconds())
-
-		if err != nil {
-			log.Info("Error running job", zap.Error(err))
+		if !r.runJob(ctx, name, job, *m) {
 			return
 		}
-		log.Info("Successfully ran job", zap.Duration("duration", duration))
 
 		// We use context.Background as the parent context instead of the existing ctx, because if we've come
 		// this far we don't want the deletion to be cancelled.
 		deleteCtx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
 		if err = r.queue.Delete(deleteCtx, receiptID); err != nil {
-			log.Info("Error deleting message, job will be repeated", zap.Error(err))
+			r.log.Info("Error deleting message, job will be repeated", zap.String("name", name), zap.Error(err))
+		}
+	}()
+}
+
+// runJob with metrics and logging. Returns true if the job is done, which is the case if it succeeded or was skipped.
+func (r *Runner) runJob(ctx context.Context, name string, job Func, m model.Message) (done bool) {
+	log := r.log.With(zap.String("name", name))
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.runnerReceives.WithLabelValues("false").Inc()
+			log.Info("Recovered from panic in job", zap.Any("recover", rec))
+			done = false
 		}
 	}()
+
+	before := time.Now()
+	err := job(ctx, m)
+	duration := time.Since(before)
+
+	skipped := isSkipped(err)
+	success := strconv.FormatBool(err == nil || skipped)
+	r.jobCount.WithLabelValues(name, success).Inc()
+	r.jobDurations.WithLabelValues(name, success).Add(duration.Seconds())
+
+	switch {
+	case skipped:
+		r.jobSkips.WithLabelValues(name).Inc()
+		log.Info("Skipped job", zap.Error(err))
+	case err != nil:
+		log.Info("Error running job", zap.Error(err))
+		return false
+	default:
+		log.Info("Successfully ran job", zap.Duration("duration", duration))
+	}
+	return true
+}
+
+// runPeriodically runs the job every interval until the context is cancelled.
+// The message has only the job name.
+func (r *Runner) runPeriodically(ctx context.Context, p periodicJob) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.runJob(ctx, p.name, p.job, model.Message{"job": p.name})
+		}
+	}
+}
+
+// isSkipped if the job ended without doing its work, but should not be repeated either,
+// such as when sending marketing email to a suppressed recipient, or sending a cancelled campaign.
+// Recipients of a paused campaign are skipped too, as they are queued again when the campaign is resumed.
+func isSkipped(err error) bool {
+	return errors.Is(err, model.ErrSuppressed) || errors.Is(err, model.ErrCampaignCancelled) ||
+		errors.Is(err, model.ErrCampaignPaused)
 }
 
 // registry provides a way to Register a jobs by name.
@@ -163,3 +259,20 @@ type registry interface {
 func (r *Runner) Register(name string, j Func) {
 	r.jobs[name] = j
 }
+
+// periodicRegistry provides a way to RegisterPeriodic jobs by name.
+type periodicRegistry interface {
+	RegisterPeriodic(name string, interval time.Duration, fn Func)
+}
+
+type periodicJob struct {
+	name     string
+	interval time.Duration
+	job      Func
+}
+
+// RegisterPeriodic implements periodicRegistry. The job runs every interval on every Runner,
+// starting one interval after the Runner is started, so it should be safe to run concurrently.
+func (r *Runner) RegisterPeriodic(name string, interval time.Duration, j Func) {
+	r.periodicJobs = append(r.periodicJobs, periodicJob{name: name, interval: interval, job: j})
+}
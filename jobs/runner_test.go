@@ -5,12 +5,14 @@ import (
 	"Goo/jobs"
 	"Goo/model"
 	"context"
+	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
 	"testing"
+	"time"
 )
 
 type testRegistry map[string]jobs.Func
@@ -19,6 +21,10 @@ func (r testRegistry) Register(name string, fn jobs.Func) {
 	r[name] = fn
 }
 
+func (r testRegistry) RegisterPeriodic(name string, _ time.Duration, fn jobs.Func) {
+	r[name] = fn
+}
+
 func TestRunner_Start(t *testing.T) {
 	integrationtest.SkipIfShort(t)
 
@@ -56,6 +62,84 @@ func TestRunner_Start(t *testing.T) {
 		require.Equal(t, "Stopping", logs.All()[2].Message)
 	})
 
+	t.Run("skips jobs for suppressed recipients instead of failing them", func(t *testing.T) {
+		queue, cleanup := integrationtest.CreateQueue()
+		defer cleanup()
+
+		log, logs := newLogger()
+
+		runner := jobs.NewRunner(jobs.NewRunnerOptions{
+			Log:   log,
+			Queue: queue,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		runner.Register("test", func(ctx context.Context, m model.Message) error {
+			cancel()
+			return fmt.Errorf("error sending email: %w", model.ErrSuppressed)
+		})
+
+		err := queue.Send(context.Background(), model.Message{"job": "test"})
+		require.NoError(t, err)
+
+		runner.Start(ctx)
+
+		require.Equal(t, 3, logs.Len())
+		require.Equal(t, "Skipped job", logs.All()[1].Message)
+	})
+
+	t.Run("skips jobs for recipients of paused campaigns instead of failing them", func(t *testing.T) {
+		queue, cleanup := integrationtest.CreateQueue()
+		defer cleanup()
+
+		log, logs := newLogger()
+
+		runner := jobs.NewRunner(jobs.NewRunnerOptions{
+			Log:   log,
+			Queue: queue,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		runner.Register("test", func(ctx context.Context, m model.Message) error {
+			cancel()
+			return fmt.Errorf("error claiming campaign recipient: %w", model.ErrCampaignPaused)
+		})
+
+		err := queue.Send(context.Background(), model.Message{"job": "test"})
+		require.NoError(t, err)
+
+		runner.Start(ctx)
+
+		require.Equal(t, 3, logs.Len())
+		require.Equal(t, "Skipped job", logs.All()[1].Message)
+	})
+
+	t.Run("runs periodic jobs", func(t *testing.T) {
+		queue, cleanup := integrationtest.CreateQueue()
+		defer cleanup()
+
+		log, logs := newLogger()
+
+		runner := jobs.NewRunner(jobs.NewRunnerOptions{
+			Log:   log,
+			Queue: queue,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		runner.RegisterPeriodic("test", time.Millisecond, func(ctx context.Context, m model.Message) error {
+			require.Equal(t, "test", m["job"])
+			cancel()
+			return nil
+		})
+
+		runner.Start(ctx)
+
+		require.Equal(t, "Successfully ran job", logs.All()[1].Message)
+	})
+
 	t.Run("emits job metrics", func(t *testing.T) {
 		queue, cleanup := integrationtest.CreateQueue()
 		defer cleanup()
@@ -81,7 +165,7 @@ func TestRunner_Start(t *testing.T) {
 
 		metrics, err := registry.Gather()
 		require.NoError(t, err)
-		require.Equal(t, 3, len(metrics))
+		require.Equal(t, 4, len(metrics))
 
 		metric := metrics[0]
 		require.Equal(t, "app_job_duration_seconds_total", metric.GetName())
@@ -104,6 +188,9 @@ func TestRunner_Start(t *testing.T) {
 		require.Equal(t, "success", metric.Metric[0].Label[1].GetName())
 		require.Equal(t, "true", metric.Metric[0].Label[1].GetValue())
 		require.Equal(t, float64(1), metric.Metric[0].Counter.GetValue())
+
+		metric = metrics[3]
+		require.Equal(t, "app_unconfirmed_signups_purged_total", metric.GetName())
 	})
 }
 
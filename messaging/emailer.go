@@ -2,10 +2,13 @@ package messaging
 
 import (
 	"Goo/model"
+	"Goo/signing"
 	"context"
 	"embed"
 	"fmt"
 	"go.uber.org/zap"
+	"html"
+	"regexp"
 	"strings"
 )
 import "github.com/go-gomail/gomail"
@@ -18,8 +21,14 @@ type Emailer struct {
 	marketingFrom     string
 	transactionalFrom string
 
-	dialer *gomail.Dialer
-	log    *zap.Logger
+	dialer       *gomail.Dialer
+	log          *zap.Logger
+	signer       *signing.Signer
+	suppressions suppressionChecker
+}
+
+type suppressionChecker interface {
+	IsSuppressed(ctx context.Context, email model.Email) (bool, error)
 }
 
 type NewEmailerOptions struct {
@@ -40,10 +49,17 @@ type NewEmailerOptions struct {
 	TransactionalEmailAddress string
 	TransactionalEmailName    string
 
-	Log *zap.Logger
+	Log    *zap.Logger
+	Signer *signing.Signer
+	// Suppressions are checked before sending marketing email. Optional.
+	Suppressions suppressionChecker
 }
 
 func NewEmailer(opts NewEmailerOptions) *Emailer {
+	if opts.Log == nil {
+		opts.Log = zap.NewNop()
+	}
+
 	return &Emailer{
 		baseURL: opts.BaseURL,
 
@@ -56,7 +72,9 @@ func NewEmailer(opts NewEmailerOptions) *Emailer {
 			Username: opts.TransactionalUsername,
 			Password: opts.TransactionalPassword,
 		}),
-		log: opts.Log,
+		log:          opts.Log,
+		signer:       opts.Signer,
+		suppressions: opts.Suppressions,
 	}
 }
 
@@ -74,39 +92,139 @@ func setupDialer(settings dialerSettings) *gomail.Dialer {
 
 // SendNewsletterConfirmationEmail with a confirmation link.
 // This is a transactional email, because it's a response to a user action.
-func (e *Emailer) SendNewsletterConfirmationEmail(_ context.Context, to model.Email, token string) error {
-	keywords := map[string]string{
-		"base_url":   e.baseURL,
-		"action_url": e.baseURL + "/newsletter/confirm?token=" + token,
-	}
+func (e *Emailer) SendNewsletterConfirmationEmail(ctx context.Context, to model.Subscriber, token string) error {
+	return e.send(ctx, e.newNewsletterConfirmationEmail(to, token))
+}
 
-	return e.send(requestBody{
-		From:      e.transactionalFrom,
-		ToAddress: to.String(),
-		// TODO: change to name
-		ToName:      to.String(),
+// PreviewNewsletterConfirmationEmail as SendNewsletterConfirmationEmail would send it.
+func (e *Emailer) PreviewNewsletterConfirmationEmail(to model.Subscriber, token string) model.EmailPreview {
+	return e.newNewsletterConfirmationEmail(to, token).preview()
+}
+
+func (e *Emailer) newNewsletterConfirmationEmail(to model.Subscriber, token string) requestBody {
+	keywords := e.getSubscriberKeywords(to)
+	keywords["action_url"] = e.baseURL + "/newsletter/" + to.ListID + "/confirm?token=" + token
+	body, text := getEmail("confirmation_email.html", keywords)
+
+	return requestBody{
+		From:        e.transactionalFrom,
+		ToAddress:   to.Email.String(),
+		ToName:      to.Name(),
 		Subject:     "Confirm your subscription to the newsletter",
-		ContentHTML: getEmail("confirmation_email.html", keywords),
-		ContextText: getEmail("confirmation_email.txt", keywords),
-	})
+		ContentHTML: body,
+		ContextText: text,
+	}
 }
 
-// SendNewsletterConfirmationEmail with a confirmation link.
-// This is a transactional email, because it's a response to a user action.
-func (e *Emailer) SendNewsletterWelcomeEmail(ctx context.Context, to model.Email) error {
+// SendNewsletterWelcomeEmail with a link to the preferences page.
+// This is a marketing email, so it has an unsubscribe link.
+func (e *Emailer) SendNewsletterWelcomeEmail(ctx context.Context, to model.Subscriber) error {
+	return e.send(ctx, e.newNewsletterWelcomeEmail(to))
+}
+
+// PreviewNewsletterWelcomeEmail as SendNewsletterWelcomeEmail would send it.
+func (e *Emailer) PreviewNewsletterWelcomeEmail(to model.Subscriber) model.EmailPreview {
+	return e.newNewsletterWelcomeEmail(to).preview()
+}
+
+func (e *Emailer) newNewsletterWelcomeEmail(to model.Subscriber) requestBody {
+	keywords := e.getSubscriberKeywords(to)
+	keywords["preferences_url"] = e.baseURL + "/newsletter/preferences?token=" + to.PreferencesToken
+	keywords["unsubscribe_url"] = e.unsubscribeURL(to.ListID, to.Email)
+	body, text := getEmail("welcome_email.html", keywords)
+
+	return requestBody{
+		From:        e.marketingFrom,
+		ToAddress:   to.Email.String(),
+		ToName:      to.Name(),
+		Subject:     "Welcome to the newsletter",
+		ContentHTML: body,
+		ContextText: text,
+		ListID:      to.ListID,
+	}
+}
+
+// SendCampaignEmail with the campaign subject and bodies, personalized for the subscriber.
+// Besides the subscriber keywords, the campaign can use preferences_url and unsubscribe_url.
+// This is a marketing email, so it has an unsubscribe header and is not sent to suppressed recipients.
+// With a delivery ID, the HTML gets an open tracking pixel and its links go through click tracking,
+// unless the campaign has them disabled.
+func (e *Emailer) SendCampaignEmail(ctx context.Context, c model.Campaign, to model.Subscriber, deliveryID int) error {
+	return e.send(ctx, e.newCampaignEmail(c, to, deliveryID))
+}
+
+// PreviewCampaignEmail as SendCampaignEmail would send it, but without tracking.
+func (e *Emailer) PreviewCampaignEmail(c model.Campaign, to model.Subscriber) model.EmailPreview {
+	return e.newCampaignEmail(c, to, 0).preview()
+}
+
+func (e *Emailer) newCampaignEmail(c model.Campaign, to model.Subscriber, deliveryID int) requestBody {
+	keywords := e.getSubscriberKeywords(to)
+	keywords["preferences_url"] = e.baseURL + "/newsletter/preferences?token=" + to.PreferencesToken
+	keywords["unsubscribe_url"] = e.unsubscribeURL(to.ListID, to.Email)
+
+	from := c.From
+	if from == "" {
+		from = e.marketingFrom
+	}
+
+	content := replaceKeywords(c.HTML, keywords, true)
+	if deliveryID != 0 && !c.DisableClickTracking {
+		content = e.trackLinks(content, deliveryID, keywords["unsubscribe_url"])
+	}
+	if deliveryID != 0 && !c.DisableOpenTracking {
+		content = e.addOpenPixel(content, deliveryID)
+	}
+
+	return requestBody{
+		From:        from,
+		ToAddress:   to.Email.String(),
+		ToName:      to.Name(),
+		Subject:     replaceKeywords(c.Subject, keywords, false),
+		ContentHTML: content,
+		ContextText: replaceKeywords(c.Text, keywords, false),
+		ListID:      to.ListID,
+	}
+}
+
+// PublicCampaignEmail is the campaign for the public archive, with personalization removed.
+// Subscriber keywords are left out, and the preferences and unsubscribe links go to the front page instead.
+// Campaigns with an A/B test show the winning variant.
+func (e *Emailer) PublicCampaignEmail(c model.Campaign) model.EmailPreview {
+	c = c.ForVariant(c.ABWinner)
 	keywords := map[string]string{
-		"base_url": e.baseURL,
+		"base_url":        e.baseURL,
+		"preferences_url": e.baseURL + "/",
+		"unsubscribe_url": e.baseURL + "/",
 	}
 
-	return e.send(requestBody{
-		From:      e.marketingFrom,
-		ToAddress: to.String(),
-		// TODO: change to name
-		ToName:      to.String(),
-		Subject:     "Welcome to the newsletter",
-		ContentHTML: getEmail("welcome_email.html", keywords),
-		ContextText: getEmail("welcome_email.txt", keywords),
-	})
+	from := c.From
+	if from == "" {
+		from = e.marketingFrom
+	}
+
+	return model.EmailPreview{
+		From:    from,
+		Subject: removeKeywords(replaceKeywords(c.Subject, keywords, false)),
+		HTML:    removeKeywords(replaceKeywords(c.HTML, keywords, true)),
+		Text:    removeKeywords(replaceKeywords(c.Text, keywords, false)),
+	}
+}
+
+// getSubscriberKeywords available in all emails to the subscriber:
+// base_url, email, first_name, last_name, name, and attributes.key for each attribute.
+func (e *Emailer) getSubscriberKeywords(to model.Subscriber) map[string]string {
+	keywords := map[string]string{
+		"base_url":   e.baseURL,
+		"email":      to.Email.String(),
+		"first_name": to.FirstName,
+		"last_name":  to.LastName,
+		"name":       to.Name(),
+	}
+	for key, value := range to.Attributes {
+		keywords["attributes."+key] = value
+	}
+	return keywords
 }
 
 type requestBody struct {
@@ -116,38 +234,120 @@ type requestBody struct {
 	Subject     string
 	ContentHTML string
 	ContextText string
+	// ListID is set for marketing emails, which get List-Unsubscribe headers, see RFC 2369 and RFC 8058.
+	ListID string
 }
 
-func (e *Emailer) send(body requestBody) error {
-	m := gomail.NewMessage()
+// preview of the email without sending it.
+func (b requestBody) preview() model.EmailPreview {
+	return model.EmailPreview{
+		From:    b.From,
+		To:      b.ToAddress,
+		Subject: b.Subject,
+		HTML:    b.ContentHTML,
+		Text:    b.ContextText,
+	}
+}
 
-	fmt.Printf("Message to send: %v \n", body.ToAddress)
-	fmt.Printf("Message from: %v \n", body.From)
+// send the email. Marketing email to suppressed recipients is not sent, and returns model.ErrSuppressed.
+func (e *Emailer) send(ctx context.Context, body requestBody) error {
+	if body.ListID != "" && e.suppressions != nil {
+		suppressed, err := e.suppressions.IsSuppressed(ctx, model.Email(body.ToAddress))
+		if err != nil {
+			return fmt.Errorf("could not check suppressions: %w", err)
+		}
+		if suppressed {
+			return model.ErrSuppressed
+		}
+	}
+
+	m := gomail.NewMessage()
 
 	m.SetHeader("From", body.From)
-	m.SetHeader("To", body.ToAddress, body.ToName)
+	m.SetAddressHeader("To", body.ToAddress, body.ToName)
 	m.SetHeader("Subject", body.Subject)
-	m.SetBody("text/html", body.ContentHTML)
-	m.SetBody("text/plain", body.ContextText)
+	if body.ListID != "" {
+		m.SetHeader("List-Unsubscribe", "<"+e.unsubscribeURL(body.ListID, model.Email(body.ToAddress))+">")
+		m.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	// The text part comes first, so clients that can show HTML pick the last alternative
+	switch {
+	case body.ContextText != "" && body.ContentHTML != "":
+		m.SetBody("text/plain", body.ContextText)
+		m.AddAlternative("text/html", body.ContentHTML)
+	case body.ContentHTML != "":
+		m.SetBody("text/html", body.ContentHTML)
+	default:
+		m.SetBody("text/plain", body.ContextText)
+	}
 
 	if err := e.dialer.DialAndSend(m); err != nil {
 		return fmt.Errorf("could not send email: %w", err)
 	}
+	e.log.Debug("Sent email", zap.String("from", body.From), zap.String("subject", body.Subject))
 	return nil
 }
 
-// getEmail from the given path, panicking on errors.
-// It also replaces keywords given in the map.
-func getEmail(path string, keywords map[string]string) string {
-	email, err := emails.ReadFile("emails/" + path)
-	if err != nil {
-		panic(err)
+// unsubscribeURL for the given list and recipient, with a signed token so it cannot be used for other addresses.
+func (e *Emailer) unsubscribeURL(listID string, to model.Email) string {
+	return e.baseURL + "/newsletter/unsubscribe?token=" + e.signer.Sign(signing.Unsubscribe, listID+":"+to.String())
+}
+
+type emailTemplate struct {
+	html string
+	text string
+}
+
+// emailTemplates by path, with the CSS inlined and a plain-text version. They are static,
+// so they are rendered once when the package is loaded, and only the keywords are replaced for each email.
+var emailTemplates = renderEmailTemplates("confirmation_email.html", "welcome_email.html")
+
+// renderEmailTemplates at the given paths, panicking on errors.
+func renderEmailTemplates(paths ...string) map[string]emailTemplate {
+	templates := map[string]emailTemplate{}
+	for _, path := range paths {
+		email, err := emails.ReadFile("emails/" + path)
+		if err != nil {
+			panic(err)
+		}
+		inlined, err := inlineCSS(string(email))
+		if err != nil {
+			panic(err)
+		}
+		templates[path] = emailTemplate{html: inlined, text: toText(inlined)}
 	}
+	return templates
+}
 
-	emailString := string(email)
-	for keyword, replacement := range keywords {
-		emailString = strings.ReplaceAll(emailString, "{{"+keyword+"}}", replacement)
+// getEmail HTML from the given path with the CSS inlined, and a plain-text version of it, panicking if there is
+// no such template. It also replaces keywords given in the map, HTML-escaping them in the HTML.
+func getEmail(path string, keywords map[string]string) (string, string) {
+	t, ok := emailTemplates[path]
+	if !ok {
+		panic("no such email template: " + path)
 	}
+	return replaceKeywords(t.html, keywords, true), replaceKeywords(t.text, keywords, false)
+}
 
-	return emailString
+var keywordMatcher = regexp.MustCompile(`{{[^{}]+}}`)
+
+// removeKeywords like {{keyword}} left in the content.
+func removeKeywords(content string) string {
+	return keywordMatcher.ReplaceAllString(content, "")
+}
+
+// replaceKeywords like {{keyword}} in the content, HTML-escaping the replacements if the content is HTML.
+// Keywords are replaced in one pass, so keywords in the replacements, like in subscriber attributes, are kept as they are.
+// Unknown keywords are kept too.
+func replaceKeywords(content string, keywords map[string]string, isHTML bool) string {
+	return keywordMatcher.ReplaceAllStringFunc(content, func(match string) string {
+		replacement, ok := keywords[strings.TrimSuffix(strings.TrimPrefix(match, "{{"), "}}")]
+		if !ok {
+			return match
+		}
+		if isHTML {
+			return html.EscapeString(replacement)
+		}
+		return replacement
+	})
 }
@@ -0,0 +1,139 @@
+package messaging_test
+
+import (
+	"Goo/messaging"
+	"Goo/model"
+	"Goo/signing"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type suppressionCheckerMock struct {
+	checked model.Email
+}
+
+func (s *suppressionCheckerMock) IsSuppressed(_ context.Context, email model.Email) (bool, error) {
+	s.checked = email
+	return true, nil
+}
+
+func TestEmailer_SendNewsletterWelcomeEmail(t *testing.T) {
+	t.Run("does not send marketing email to suppressed recipients", func(t *testing.T) {
+		s := &suppressionCheckerMock{}
+		e := messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:      "http://localhost:8080",
+			Host:         "localhost",
+			Port:         1,
+			Signer:       signing.NewSigner("secret"),
+			Suppressions: s,
+		})
+
+		err := e.SendNewsletterWelcomeEmail(context.Background(), model.Subscriber{
+			ListID:           "newsletter",
+			Email:            "me@example.com",
+			PreferencesToken: "123",
+		})
+		require.ErrorIs(t, err, model.ErrSuppressed)
+		require.Equal(t, model.Email("me@example.com"), s.checked)
+	})
+}
+
+func TestEmailer_PreviewNewsletterConfirmationEmail(t *testing.T) {
+	t.Run("renders the email with the confirmation link without sending", func(t *testing.T) {
+		e := messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:                   "http://localhost:8080",
+			TransactionalEmailAddress: "transactional@example.com",
+			Signer:                    signing.NewSigner("secret"),
+		})
+
+		preview := e.PreviewNewsletterConfirmationEmail(model.SampleSubscriber("golang"), "123")
+		require.Equal(t, "transactional@example.com", preview.From)
+		require.Equal(t, "jane.doe@example.com", preview.To)
+		require.Equal(t, "Confirm your subscription to the newsletter", preview.Subject)
+		require.Contains(t, preview.HTML, "http://localhost:8080/newsletter/golang/confirm?token=123")
+		require.Contains(t, preview.Text, "Confirm subscription (http://localhost:8080/newsletter/golang/confirm?token=123)")
+		require.NotContains(t, preview.HTML, ".body-action {")
+		require.NotContains(t, preview.Text, "Confirm your subscription to the Goo newsletter.")
+	})
+}
+
+func TestEmailer_PreviewCampaignEmail(t *testing.T) {
+	t.Run("renders the campaign personalized for the subscriber", func(t *testing.T) {
+		e := messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL:               "http://localhost:8080",
+			MarketingEmailAddress: "marketing@example.com",
+			Signer:                signing.NewSigner("secret"),
+		})
+
+		preview := e.PreviewCampaignEmail(model.Campaign{
+			ListID:  "newsletter",
+			Subject: "Hi {{first_name}}",
+			HTML:    "<p>Hi {{name}}</p>",
+			Text:    "Hi {{name}}, see {{preferences_url}}",
+		}, model.SampleSubscriber("newsletter"))
+		require.Equal(t, "marketing@example.com", preview.From)
+		require.Equal(t, "Hi Jane", preview.Subject)
+		require.Equal(t, "<p>Hi Jane Doe</p>", preview.HTML)
+		require.Equal(t, "Hi Jane Doe, see http://localhost:8080/newsletter/preferences?token=sample", preview.Text)
+	})
+
+	t.Run("does not replace keywords in replacements", func(t *testing.T) {
+		e := messaging.NewEmailer(messaging.NewEmailerOptions{
+			BaseURL: "http://localhost:8080",
+			Signer:  signing.NewSigner("secret"),
+		})
+
+		to := model.SampleSubscriber("newsletter")
+		to.FirstName = "{{unsubscribe_url}}"
+		to.Attributes = model.Attributes{"company": "{{email}} & co"}
+		// Run it a few times, as the order of keywords in a map is random
+		for i := 0; i < 10; i++ {
+			preview := e.PreviewCampaignEmail(model.Campaign{
+				ListID:  "newsletter",
+				Subject: "Hi",
+				HTML:    "<p>{{first_name}} {{attributes.company}} {{unknown}}</p>",
+				Text:    "{{first_name}} {{attributes.company}} {{unknown}}",
+			}, to)
+			require.Equal(t, "<p>{{unsubscribe_url}} {{email}} &amp; co {{unknown}}</p>", preview.HTML)
+			require.Equal(t, "{{unsubscribe_url}} {{email}} & co {{unknown}}", preview.Text)
+		}
+	})
+}
+
+func TestEmailer_PublicCampaignEmail(t *testing.T) {
+	e := messaging.NewEmailer(messaging.NewEmailerOptions{
+		BaseURL:               "http://localhost:8080",
+		MarketingEmailAddress: "marketing@example.com",
+		Signer:                signing.NewSigner("secret"),
+	})
+
+	t.Run("removes personalization", func(t *testing.T) {
+		email := e.PublicCampaignEmail(model.Campaign{
+			ListID:  "newsletter",
+			Subject: "News for {{first_name}}",
+			HTML:    `<p>Hi {{name}} from {{attributes.city}}</p><a href="{{unsubscribe_url}}">Unsubscribe</a>`,
+			Text:    "Hi {{name}}, see {{base_url}} or {{preferences_url}}",
+		})
+		require.Equal(t, "marketing@example.com", email.From)
+		require.Equal(t, "", email.To)
+		require.Equal(t, "News for ", email.Subject)
+		require.Equal(t, `<p>Hi  from </p><a href="http://localhost:8080/">Unsubscribe</a>`, email.HTML)
+		require.Equal(t, "Hi , see http://localhost:8080 or http://localhost:8080/", email.Text)
+	})
+
+	t.Run("shows the winning variant of an A/B test", func(t *testing.T) {
+		email := e.PublicCampaignEmail(model.Campaign{
+			ListID:  "newsletter",
+			Subject: "Hello",
+			Text:    "Hi",
+			ABTest: &model.ABTest{Variants: []model.CampaignVariant{
+				{Name: "a", Subject: "Hello A"},
+				{Name: "b", Subject: "Hello B"},
+			}},
+			ABWinner: "b",
+		})
+		require.Equal(t, "Hello B", email.Subject)
+	})
+}
@@ -0,0 +1,290 @@
+package messaging
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// cssRule with a selector of tags and classes, optionally with ancestors, which can be inlined.
+type cssRule struct {
+	// selectors of the element last, and its ancestors before it.
+	selectors    []simpleSelector
+	specificity  int
+	declarations []cssDeclaration
+}
+
+type simpleSelector struct {
+	tag     string
+	classes []string
+}
+
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+var (
+	cssCommentMatcher     = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	simpleSelectorMatcher = regexp.MustCompile(`^([a-z][a-z0-9]*)?((?:\.[\w-]+)*)$`)
+)
+
+// inlineCSS of the style elements in the HTML document into style attributes of the elements the rules apply to,
+// because many email clients ignore style elements. Only rules with selectors of tags and classes are inlined,
+// others like media queries and pseudo-classes stay in the style elements, for the clients that support them.
+func inlineCSS(document string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", err
+	}
+
+	var styles []*html.Node
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Style {
+			styles = append(styles, n)
+		}
+	})
+	var rules []cssRule
+	for _, style := range styles {
+		var css strings.Builder
+		for c := style.FirstChild; c != nil; c = c.NextSibling {
+			css.WriteString(c.Data)
+		}
+		inlinable, rest := parseStylesheet(css.String())
+		rules = append(rules, inlinable...)
+		if strings.TrimSpace(rest) == "" {
+			style.Parent.RemoveChild(style)
+			continue
+		}
+		for style.FirstChild != nil {
+			style.RemoveChild(style.FirstChild)
+		}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: rest})
+	}
+	// Rules apply from least to most specific, in the order of the stylesheet otherwise
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].specificity < rules[j].specificity
+	})
+
+	walkElements(doc, func(n *html.Node) {
+		var declarations []cssDeclaration
+		for _, r := range rules {
+			if r.matches(n) {
+				declarations = mergeDeclarations(declarations, r.declarations)
+			}
+		}
+		if len(declarations) == 0 {
+			return
+		}
+		declarations = mergeDeclarations(declarations, parseDeclarations(getAttribute(n, "style")))
+		var style []string
+		for _, d := range declarations {
+			if d.important {
+				style = append(style, d.property+": "+d.value+" !important")
+				continue
+			}
+			style = append(style, d.property+": "+d.value)
+		}
+		setAttribute(n, "style", strings.Join(style, "; ")+";")
+	})
+
+	var b bytes.Buffer
+	if err := html.Render(&b, doc); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// parseStylesheet into the rules that can be inlined, and the rest of the stylesheet.
+func parseStylesheet(css string) ([]cssRule, string) {
+	css = cssCommentMatcher.ReplaceAllString(css, "")
+
+	var rules []cssRule
+	var rest strings.Builder
+	for {
+		open := strings.Index(css, "{")
+		if open < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(css[:open])
+
+		// At-rules like media queries have nested blocks, which are kept as they are
+		if strings.HasPrefix(prelude, "@") {
+			depth, end := 0, len(css)
+			for i := open; i < len(css); i++ {
+				if css[i] == '{' {
+					depth++
+				} else if css[i] == '}' {
+					depth--
+					if depth == 0 {
+						end = i + 1
+						break
+					}
+				}
+			}
+			rest.WriteString(prelude + " " + strings.TrimSpace(css[open:end]) + "\n")
+			css = css[end:]
+			continue
+		}
+
+		end := strings.Index(css[open:], "}")
+		if end < 0 {
+			break
+		}
+		body := css[open+1 : open+end]
+		css = css[open+end+1:]
+
+		declarations := parseDeclarations(body)
+		var kept []string
+		for _, selector := range strings.Split(prelude, ",") {
+			selector = strings.TrimSpace(selector)
+			r, ok := parseSelector(selector)
+			if !ok {
+				kept = append(kept, selector)
+				continue
+			}
+			r.declarations = declarations
+			rules = append(rules, r)
+		}
+		if len(kept) > 0 {
+			rest.WriteString(strings.Join(kept, ", ") + " {" + body + "}\n")
+		}
+	}
+	return rules, rest.String()
+}
+
+// parseSelector of tags and classes separated by whitespace into a rule, if it can be inlined.
+func parseSelector(selector string) (cssRule, bool) {
+	var r cssRule
+	for _, part := range strings.Fields(selector) {
+		match := simpleSelectorMatcher.FindStringSubmatch(part)
+		if match == nil {
+			return r, false
+		}
+		s := simpleSelector{tag: match[1]}
+		if s.tag != "" {
+			r.specificity++
+		}
+		for _, class := range strings.Split(match[2], ".")[1:] {
+			s.classes = append(s.classes, class)
+			r.specificity += 10
+		}
+		r.selectors = append(r.selectors, s)
+	}
+	return r, len(r.selectors) > 0
+}
+
+// parseDeclarations of a rule or style attribute. Premailer-specific properties are left out.
+func parseDeclarations(s string) []cssDeclaration {
+	var declarations []cssDeclaration
+	for _, d := range strings.Split(s, ";") {
+		property, value, ok := strings.Cut(d, ":")
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if !ok || property == "" || value == "" || strings.HasPrefix(property, "-premailer-") {
+			continue
+		}
+		declaration := cssDeclaration{property: property, value: value}
+		if trimmed := strings.TrimSuffix(value, "!important"); trimmed != value {
+			declaration.value = strings.TrimSpace(trimmed)
+			declaration.important = true
+		}
+		declarations = append(declarations, declaration)
+	}
+	return declarations
+}
+
+// mergeDeclarations overriding earlier ones of the same property, unless they are important and the new ones not.
+func mergeDeclarations(declarations, overrides []cssDeclaration) []cssDeclaration {
+	for _, o := range overrides {
+		skip := false
+		for i, d := range declarations {
+			if d.property != o.property {
+				continue
+			}
+			if d.important && !o.important {
+				skip = true
+				break
+			}
+			declarations = append(declarations[:i:i], declarations[i+1:]...)
+			break
+		}
+		if !skip {
+			declarations = append(declarations, o)
+		}
+	}
+	return declarations
+}
+
+// matches if the element matches the last selector of the rule, and its ancestors the ones before, in order.
+func (r cssRule) matches(n *html.Node) bool {
+	last := len(r.selectors) - 1
+	if !r.selectors[last].matches(n) {
+		return false
+	}
+	i := last - 1
+	for a := n.Parent; a != nil && i >= 0; a = a.Parent {
+		if a.Type == html.ElementNode && r.selectors[i].matches(a) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+// matches if the element has the tag and all classes of the selector.
+func (s simpleSelector) matches(n *html.Node) bool {
+	if s.tag != "" && s.tag != n.Data {
+		return false
+	}
+	classes := strings.Fields(getAttribute(n, "class"))
+	for _, class := range s.classes {
+		found := false
+		for _, c := range classes {
+			if c == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// walkElements in document order, calling f for each element node.
+func walkElements(n *html.Node, f func(n *html.Node)) {
+	for c := n.FirstChild; c != nil; {
+		// f may remove c, so get the next sibling first
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			f(c)
+		}
+		walkElements(c, f)
+		c = next
+	}
+}
+
+func getAttribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttribute(n *html.Node, key, value string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
@@ -0,0 +1,100 @@
+package messaging_test
+
+import (
+	"Goo/messaging"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The CSS inliner is tested through RenderMarkdown, with style elements and spans written as HTML in the Markdown.
+// The layout has no rules that apply to spans outside of media queries, so only the rules of each test apply.
+func TestRenderMarkdown_InlineCSS(t *testing.T) {
+	tests := map[string]struct {
+		css      string
+		content  string
+		expected string
+	}{
+		"tag and class": {
+			css:      `span.a { color: red }`,
+			content:  `<span class="a">x</span><span>y</span>`,
+			expected: `<span class="a" style="color: red;">x</span><span>y</span>`,
+		},
+		"all classes must match": {
+			css:      `.a.b { color: red }`,
+			content:  `<span class="a b">x</span><span class="a">y</span>`,
+			expected: `<span class="a b" style="color: red;">x</span><span class="a">y</span>`,
+		},
+		"descendant": {
+			css:      `.outer span { color: red }`,
+			content:  `<span class="outer"><span>x</span></span>`,
+			expected: `<span class="outer"><span style="color: red;">x</span></span>`,
+		},
+		"more specific rules win over later ones": {
+			css:      `.a { color: red } span { color: blue }`,
+			content:  `<span class="a">x</span>`,
+			expected: `<span class="a" style="color: red;">x</span>`,
+		},
+		"later rules win when equally specific": {
+			css:      `.a { color: red } .b { color: blue }`,
+			content:  `<span class="a b">x</span>`,
+			expected: `<span class="a b" style="color: blue;">x</span>`,
+		},
+		"important rules win over more specific ones": {
+			css:      `span { color: red !important } .a { color: blue }`,
+			content:  `<span class="a">x</span>`,
+			expected: `<span class="a" style="color: red !important;">x</span>`,
+		},
+		"existing style attributes win over rules": {
+			css:      `.a { color: red; font-weight: bold }`,
+			content:  `<span class="a" style="color: blue">x</span>`,
+			expected: `<span class="a" style="font-weight: bold; color: blue;">x</span>`,
+		},
+		"important rules win over existing style attributes": {
+			css:      `.a { color: red !important }`,
+			content:  `<span class="a" style="color: blue">x</span>`,
+			expected: `<span class="a" style="color: red !important;">x</span>`,
+		},
+		"premailer properties are left out": {
+			css:      `.a { -premailer-width: 100; color: red }`,
+			content:  `<span class="a">x</span>`,
+			expected: `<span class="a" style="color: red;">x</span>`,
+		},
+		"comments are ignored": {
+			css:      `/* .a { color: blue } */ .a { color: red }`,
+			content:  `<span class="a">x</span>`,
+			expected: `<span class="a" style="color: red;">x</span>`,
+		},
+		"pseudo-classes are not inlined": {
+			css:      `.a:hover { color: red }`,
+			content:  `<span class="a">x</span>`,
+			expected: `<span class="a">x</span>`,
+		},
+		"selector lists are inlined where possible": {
+			css:      `.a, .b:hover { color: red }`,
+			content:  `<span class="a">x</span><span class="b">y</span>`,
+			expected: `<span class="a" style="color: red;">x</span><span class="b">y</span>`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			html, _, err := messaging.RenderMarkdown("<style>\n" + test.css + "\n</style>\n\n" + test.content)
+			require.NoError(t, err)
+			require.Contains(t, html, test.expected)
+		})
+	}
+
+	t.Run("keeps rules that cannot be inlined in the style element", func(t *testing.T) {
+		html, _, err := messaging.RenderMarkdown("<style>\n.a, .b:hover { color: red }\n@media print { .a { color: black } }\n</style>\n\nHi")
+		require.NoError(t, err)
+		require.Contains(t, html, ".b:hover { color: red }")
+		require.Contains(t, html, "@media print { .a { color: black } }")
+		require.NotContains(t, html, ".a, .b:hover")
+	})
+
+	t.Run("removes style elements that are inlined completely", func(t *testing.T) {
+		html, _, err := messaging.RenderMarkdown("<style>\n.a { color: red }\n</style>\n\nHi")
+		require.NoError(t, err)
+		require.NotContains(t, html, ".a {")
+	})
+}
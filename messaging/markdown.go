@@ -0,0 +1,41 @@
+package messaging
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	// Campaigns are written by admins, who can use HTML in the campaign body anyway
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+)
+
+var keywordUnescaper = strings.NewReplacer("%7B%7B", "{{", "%7D%7D", "}}")
+
+// RenderMarkdown campaign content into the branded email layout, with the CSS inlined for email clients,
+// and a matching plain-text version. Keywords like {{first_name}} are kept, to be replaced for each recipient.
+// The layout has links to the preferences and unsubscribe pages in the footer.
+func RenderMarkdown(content string) (string, string, error) {
+	var b bytes.Buffer
+	if err := markdown.Convert([]byte(content), &b); err != nil {
+		return "", "", err
+	}
+	// Keywords in link URLs are escaped, but need to stay as they are to be replaced
+	content = keywordUnescaper.Replace(b.String())
+
+	layout, err := emails.ReadFile("emails/layout.html")
+	if err != nil {
+		return "", "", err
+	}
+
+	html, err := inlineCSS(strings.Replace(string(layout), "{{content}}", content, 1))
+	if err != nil {
+		return "", "", err
+	}
+	return html, toText(html), nil
+}
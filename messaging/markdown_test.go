@@ -0,0 +1,38 @@
+package messaging_test
+
+import (
+	"Goo/messaging"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	html, text, err := messaging.RenderMarkdown("# Hi {{first_name}}\n\n" +
+		"Read [the news]({{base_url}}/news) or https://example.com.\n\n" +
+		"1. One\n2. Two\n\n- Three\n")
+	require.NoError(t, err)
+
+	t.Run("renders into the layout with the CSS inlined", func(t *testing.T) {
+		require.Contains(t, html, `<h1 style="margin-top: 0; color: #333333; font-size: 22px; font-weight: bold; text-align: left;">Hi {{first_name}}</h1>`)
+		require.Contains(t, html, `class="f-fallback sub align-center" style="margin: .4em 0 1.1875em; line-height: 1.625; text-align: center; font-size: 13px; color: #A8AAAF;"`)
+		require.Contains(t, html, `href="{{unsubscribe_url}}"`)
+		require.NotContains(t, html, ".email-masthead {")
+	})
+
+	t.Run("keeps rules that cannot be inlined", func(t *testing.T) {
+		require.Contains(t, html, "@media only screen and (max-width: 500px)")
+		require.Contains(t, html, ":root {")
+	})
+
+	t.Run("keeps keywords in link URLs", func(t *testing.T) {
+		require.Contains(t, html, `<a href="{{base_url}}/news" style="color: #3869D4;">the news</a>`)
+	})
+
+	t.Run("generates a matching plain-text version", func(t *testing.T) {
+		require.Contains(t, text, "Hi {{first_name}}\n\nRead the news ({{base_url}}/news) or https://example.com.\n\n1. One\n2. Two\n\n- Three\n\n")
+		require.Contains(t, text, "Goo\nSome Street\nEarth")
+		require.Contains(t, text, "Unsubscribe ({{unsubscribe_url}})")
+		require.NotContains(t, text, "<")
+	})
+}
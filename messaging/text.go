@@ -0,0 +1,161 @@
+package messaging
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// toText version of the HTML email, for the plain-text part. Blocks become paragraphs, list items get bullets
+// or numbers, and links are followed by their URL in parentheses. Hidden preheaders are left out.
+func toText(document string) string {
+	doc, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return ""
+	}
+	var w textWriter
+	w.walk(doc)
+
+	lines := strings.Split(w.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.TrimSpace(blankLinesMatcher.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+var blankLinesMatcher = regexp.MustCompile(`\n{3,}`)
+
+type textWriter struct {
+	b        strings.Builder
+	started  bool
+	newlines int
+	space    bool
+}
+
+// text written inline, with whitespace collapsed like a browser would.
+func (w *textWriter) text(s string) {
+	if strings.TrimSpace(s) == "" {
+		w.space = w.space || s != ""
+		return
+	}
+	if strings.TrimLeft(s, " \t\r\n") != s {
+		w.space = true
+	}
+	for _, word := range strings.Fields(s) {
+		if w.started && w.newlines == 0 && w.space {
+			w.b.WriteString(" ")
+		}
+		w.b.WriteString(word)
+		w.started, w.newlines, w.space = true, 0, true
+	}
+	w.space = strings.TrimRight(s, " \t\r\n") != s
+}
+
+// lineBreak so there are at least n newlines after the text written so far.
+func (w *textWriter) lineBreak(n int) {
+	if !w.started {
+		return
+	}
+	for ; w.newlines < n; w.newlines++ {
+		w.b.WriteString("\n")
+	}
+	w.space = false
+}
+
+func (w *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+}
+
+func (w *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+
+	if strings.Contains(" "+getAttribute(n, "class")+" ", " preheader ") {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Style, atom.Script, atom.Title:
+	case atom.Br:
+		w.lineBreak(1)
+	case atom.Img:
+		w.text(getAttribute(n, "alt"))
+	case atom.Hr:
+		w.lineBreak(2)
+		w.text("---")
+		w.lineBreak(2)
+	case atom.A:
+		w.children(n)
+		href := getAttribute(n, "href")
+		if href != "" && !strings.HasPrefix(href, "#") && href != strings.TrimSpace(nodeText(n)) {
+			w.text(" (" + strings.TrimPrefix(href, "mailto:") + ")")
+		}
+	case atom.Li:
+		w.lineBreak(1)
+		prefix := "- "
+		if n.Parent != nil && n.Parent.DataAtom == atom.Ol {
+			prefix = strconv.Itoa(listItemNumber(n)) + ". "
+		}
+		w.text(prefix)
+		w.children(n)
+		w.lineBreak(1)
+	case atom.Ul, atom.Ol:
+		breaks := 2
+		if n.Parent != nil && n.Parent.DataAtom == atom.Li {
+			breaks = 1
+		}
+		w.lineBreak(breaks)
+		w.children(n)
+		w.lineBreak(breaks)
+	case atom.Pre:
+		w.lineBreak(2)
+		w.b.WriteString(strings.TrimRight(nodeText(n), "\n"))
+		w.started, w.newlines, w.space = true, 0, false
+		w.lineBreak(2)
+	case atom.P, atom.Div, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Blockquote,
+		atom.Table, atom.Tr, atom.Td, atom.Th:
+		w.lineBreak(2)
+		w.children(n)
+		w.lineBreak(2)
+	default:
+		w.children(n)
+	}
+}
+
+// nodeText of all text nodes in the node, as it is.
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(nodeText(c))
+	}
+	return b.String()
+}
+
+// listItemNumber of the item in its ordered list, which may start at another number than 1.
+func listItemNumber(n *html.Node) int {
+	number, err := strconv.Atoi(getAttribute(n.Parent, "start"))
+	if err != nil {
+		number = 1
+	}
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode && s.DataAtom == atom.Li {
+			number++
+		}
+	}
+	return number
+}
@@ -0,0 +1,45 @@
+package messaging_test
+
+import (
+	"Goo/messaging"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The plain-text version is tested through RenderMarkdown, and only the content part of it is checked,
+// which comes between the masthead and the footer of the layout.
+func TestRenderMarkdown_Text(t *testing.T) {
+	tests := map[string]struct {
+		markdown string
+		expected string
+	}{
+		"paragraphs":                {"One\ntwo\n\nThree", "One two\n\nThree"},
+		"headings":                  {"# Title\n\nText", "Title\n\nText"},
+		"line breaks":               {"One  \nTwo", "One\nTwo"},
+		"unordered lists":           {"- One\n- Two", "- One\n- Two"},
+		"ordered lists":             {"1. One\n2. Two", "1. One\n2. Two"},
+		"ordered lists with start":  {"3. Three\n4. Four", "3. Three\n4. Four"},
+		"nested lists":              {"- One\n  - Two\n- Three", "- One\n- Two\n- Three"},
+		"links":                     {"[News](https://example.com/news)", "News (https://example.com/news)"},
+		"links that are their URL":  {"<https://example.com>", "https://example.com"},
+		"email links":               {"[Write me](mailto:me@example.com)", "Write me (me@example.com)"},
+		"anchor links":              {"[Top](#top)", "Top"},
+		"entities":                  {"Tom &amp; Jerry &lt;3 &quot;hi&quot;", `Tom & Jerry <3 "hi"`},
+		"images":                    {"![Logo](https://example.com/logo.png)", "Logo"},
+		"rules":                     {"One\n\n---\n\nTwo", "One\n\n---\n\nTwo"},
+		"code blocks":               {"```\nfunc  main() {\n}\n```", "func  main() {\n}"},
+		"hidden preheaders":         {`<span class="preheader">Hidden</span>Shown`, "Shown"},
+		"whitespace around inlines": {"Hello <em>there</em> <strong>you</strong>!", "Hello there you!"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, text, err := messaging.RenderMarkdown(test.markdown)
+			require.NoError(t, err)
+			content, _, ok := strings.Cut(strings.TrimPrefix(text, "Goo ({{base_url}})\n\n"), "\n\nGoo\nSome Street")
+			require.True(t, ok, text)
+			require.Equal(t, test.expected, content)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package messaging
+
+import (
+	"Goo/model"
+	"Goo/signing"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// linkMatcher for the href attributes of links, with the value in double or single quotes.
+var linkMatcher = regexp.MustCompile(`(?i)(<a\s[^>]*?\bhref\s*=\s*)(?:"([^"]*)"|'([^']*)')`)
+
+// openPixelURL for the delivery, with the delivery ID signed, so opens cannot be recorded for other deliveries.
+func (e *Emailer) openPixelURL(deliveryID int) string {
+	return e.baseURL + "/t/o/" + e.signer.Sign(signing.Open, strconv.Itoa(deliveryID)) + ".gif"
+}
+
+// addOpenPixel for the delivery at the end of the HTML body, or at the end of the HTML if it has no body element.
+func (e *Emailer) addOpenPixel(content string, deliveryID int) string {
+	pixel := `<img src="` + html.EscapeString(e.openPixelURL(deliveryID)) +
+		`" width="1" height="1" alt="" style="display: block; width: 1px; height: 1px; border: 0;">`
+	if i := strings.LastIndex(strings.ToLower(content), "</body>"); i >= 0 {
+		return content[:i] + pixel + content[i:]
+	}
+	return content + pixel
+}
+
+// clickURL for the delivery and target URL, with both signed, so the link can neither record clicks
+// for other deliveries nor redirect to other URLs.
+func (e *Emailer) clickURL(deliveryID int, target string) string {
+	return e.baseURL + "/t/c/" + e.signer.Sign(signing.Click, model.ClickTarget(deliveryID, target))
+}
+
+// trackLinks in the HTML by pointing them to the click tracking redirect of the delivery.
+// Only http and https links are tracked, and the unsubscribe link is left as is,
+// so unsubscribing does not count as engagement and works without the redirect.
+func (e *Emailer) trackLinks(content string, deliveryID int, unsubscribeURL string) string {
+	return linkMatcher.ReplaceAllStringFunc(content, func(link string) string {
+		match := linkMatcher.FindStringSubmatch(link)
+		value := match[2]
+		if strings.HasSuffix(link, "'") {
+			value = match[3]
+		}
+		target := html.UnescapeString(strings.TrimSpace(value))
+		if !model.IsTrackableURL(target) || target == unsubscribeURL {
+			return link
+		}
+		return match[1] + `"` + html.EscapeString(e.clickURL(deliveryID, target)) + `"`
+	})
+}
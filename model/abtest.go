@@ -0,0 +1,102 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// ABTestMetric is what an ABTest picks the winning variant by.
+type ABTestMetric string
+
+const (
+	ABTestOpens  ABTestMetric = "opens"
+	ABTestClicks ABTestMetric = "clicks"
+)
+
+const (
+	minVariants          = 2
+	maxVariants          = 5
+	maxVariantNameLength = 50
+	maxABTestWaitMinutes = 7 * 24 * 60
+)
+
+// CampaignVariant of the subject and content of a Campaign. Empty fields are taken from the campaign.
+// Like the campaign, the content can be written in Markdown, which is rendered into HTML and Text.
+type CampaignVariant struct {
+	Name     string `json:"name"`
+	Subject  string `json:"subject"`
+	Markdown string `json:"markdown"`
+	HTML     string `json:"html"`
+	Text     string `json:"text"`
+}
+
+// ABTest of a Campaign. The variants are sent to a sample of the recipients, split evenly between them.
+// After waiting, the variant with the most opens or clicks in the sample wins, and is sent to the rest.
+// The metric must be tracked for the campaign, see Campaign.IsValid.
+type ABTest struct {
+	Variants []CampaignVariant `json:"variants"`
+	// SamplePercent is how many of the recipients, in percent, get one of the variants before there is a winner.
+	SamplePercent int `json:"sample_percent"`
+	// WaitMinutes is how long to wait for opens and clicks after the sample has been queued.
+	WaitMinutes int          `json:"wait_minutes"`
+	Metric      ABTestMetric `json:"metric"`
+}
+
+// IsValid if it has a few uniquely named variants that each change something, a sample that leaves recipients
+// for the winner, a wait of at most a week, and a known metric.
+func (t ABTest) IsValid() bool {
+	if len(t.Variants) < minVariants || len(t.Variants) > maxVariants {
+		return false
+	}
+	names := map[string]bool{}
+	for _, v := range t.Variants {
+		if strings.TrimSpace(v.Name) == "" || utf8.RuneCountInString(v.Name) > maxVariantNameLength || names[v.Name] {
+			return false
+		}
+		names[v.Name] = true
+		if v.Subject == "" && v.Markdown == "" && v.HTML == "" && v.Text == "" {
+			return false
+		}
+		if utf8.RuneCountInString(v.Subject) > maxSubjectLength {
+			return false
+		}
+	}
+	if t.SamplePercent < 1 || t.SamplePercent > 99 {
+		return false
+	}
+	if t.WaitMinutes < 1 || t.WaitMinutes > maxABTestWaitMinutes {
+		return false
+	}
+	return t.Metric == ABTestOpens || t.Metric == ABTestClicks
+}
+
+// VariantNames in order.
+func (t ABTest) VariantNames() []string {
+	var names []string
+	for _, v := range t.Variants {
+		names = append(names, v.Name)
+	}
+	return names
+}
+
+// HasVariant with the given name.
+func (t ABTest) HasVariant(name string) bool {
+	return contains(t.VariantNames(), name)
+}
+
+// Scan implements sql.Scanner.
+func (t *ABTest) Scan(src interface{}) error {
+	data, err := getJSONBytes(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, t)
+}
+
+// Value implements driver.Valuer.
+func (t ABTest) Value() (driver.Value, error) {
+	data, err := json.Marshal(t)
+	return string(data), err
+}
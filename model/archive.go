@@ -0,0 +1,49 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Issue is a sent Campaign as shown in the public archive, with personalization removed.
+type Issue struct {
+	Slug    string
+	Subject string
+	HTML    string
+	Text    string
+	Sent    time.Time
+}
+
+// ArchivePath of the list, which is /newsletter/archive for the default list, and /newsletter/{list}/archive otherwise.
+func ArchivePath(listID string) string {
+	if listID == DefaultListID {
+		return "/newsletter/archive"
+	}
+	return "/newsletter/" + listID + "/archive"
+}
+
+const maxSlugWords = 8
+
+// CampaignSlug for the archive URL of the campaign with the given ID and subject, like 12-hello-world.
+// The ID makes it unique, and the words of the subject make it readable.
+func CampaignSlug(id int, subject string) string {
+	words := strings.FieldsFunc(strings.ToLower(subject), func(r rune) bool {
+		return r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSlugWords {
+		words = words[:maxSlugWords]
+	}
+	return strings.Join(append([]string{strconv.Itoa(id)}, words...), "-")
+}
+
+// ParseCampaignSlug for the campaign ID in front of it, see CampaignSlug.
+func ParseCampaignSlug(slug string) (int, bool) {
+	prefix, _, _ := strings.Cut(slug, "-")
+	id, err := strconv.Atoi(prefix)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
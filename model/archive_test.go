@@ -0,0 +1,46 @@
+package model_test
+
+import (
+	"Goo/model"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCampaignSlug(t *testing.T) {
+	tests := map[string]struct {
+		subject string
+		slug    string
+	}{
+		"words":            {"Hello, World!", "12-hello-world"},
+		"numbers":          {"Issue #3: Go 1.19", "12-issue-3-go-1-19"},
+		"non-ascii":        {"Grüße aus Köln", "12-gr-e-aus-k-ln"},
+		"no words":         {"🎉", "12"},
+		"many words":       {"one two three four five six seven eight nine ten", "12-one-two-three-four-five-six-seven-eight"},
+		"extra whitespace": {"  Hello   again ", "12-hello-again"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			slug := model.CampaignSlug(12, test.subject)
+			require.Equal(t, test.slug, slug)
+
+			id, ok := model.ParseCampaignSlug(slug)
+			require.True(t, ok)
+			require.Equal(t, 12, id)
+		})
+	}
+}
+
+func TestParseCampaignSlug(t *testing.T) {
+	t.Run("rejects slugs without an ID", func(t *testing.T) {
+		for _, slug := range []string{"", "hello", "-12-hello", "0-hello", "abc-12"} {
+			_, ok := model.ParseCampaignSlug(slug)
+			require.False(t, ok, slug)
+		}
+	})
+}
+
+func TestArchivePath(t *testing.T) {
+	require.Equal(t, "/newsletter/archive", model.ArchivePath(model.DefaultListID))
+	require.Equal(t, "/newsletter/golang/archive", model.ArchivePath("golang"))
+}
@@ -0,0 +1,156 @@
+package model
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrCampaignNotEditable is returned when changing a Campaign that is not a draft anymore.
+var ErrCampaignNotEditable = errors.New("campaign is not a draft")
+
+// ErrCampaignPaused is returned when sending a Campaign that is paused, which is sent again after resuming.
+var ErrCampaignPaused = errors.New("campaign is paused")
+
+// ErrCampaignCancelled is returned when sending a Campaign that is cancelled, which should not be tried again.
+var ErrCampaignCancelled = errors.New("campaign is cancelled")
+
+// CampaignStatus is where a Campaign is in its lifecycle.
+type CampaignStatus string
+
+const (
+	CampaignDraft     CampaignStatus = "draft"
+	CampaignScheduled CampaignStatus = "scheduled"
+	CampaignSending   CampaignStatus = "sending"
+	CampaignPaused    CampaignStatus = "paused"
+	CampaignSent      CampaignStatus = "sent"
+	CampaignCancelled CampaignStatus = "cancelled"
+)
+
+const maxSubjectLength = 200
+
+// TestSubjectMarker goes in front of the subject of test sends, so they are not mistaken for the real campaign.
+const TestSubjectMarker = "[TEST]"
+
+// Campaign is one newsletter issue sent to the subscribers of a List.
+type Campaign struct {
+	ID      int    `db:"id" json:"id"`
+	ListID  string `db:"list_id" json:"list_id"`
+	Subject string `db:"subject" json:"subject"`
+	// Markdown content is rendered into the branded email layout, setting HTML and Text, see messaging.RenderMarkdown.
+	Markdown string         `db:"markdown" json:"markdown"`
+	HTML     string         `db:"html" json:"html"`
+	Text     string         `db:"text" json:"text"`
+	From     string         `db:"from_address" json:"from"`
+	Status   CampaignStatus `db:"status" json:"status"`
+	Created  time.Time      `db:"created" json:"created"`
+	Updated  time.Time      `db:"updated" json:"updated"`
+	Sent     *time.Time     `db:"sent" json:"sent"`
+	// SendAt is when a scheduled campaign starts sending.
+	SendAt *time.Time `db:"send_at" json:"send_at"`
+	// SegmentID of the Segment of the list the campaign is sent to. Without one, it's sent to the whole list.
+	SegmentID *int `db:"segment_id" json:"segment_id"`
+	// LocalSendTime like 09:00 delivers the campaign at that time of day in the timezone of each recipient,
+	// instead of right away. Recipients without a timezone get it in UTC.
+	LocalSendTime string `db:"local_send_time" json:"local_send_time"`
+	// DisableOpenTracking leaves out the tracking pixel that records when a delivery is opened.
+	DisableOpenTracking bool `db:"disable_open_tracking" json:"disable_open_tracking"`
+	// DisableClickTracking leaves links as they are, instead of going through a redirect that records clicks.
+	DisableClickTracking bool `db:"disable_click_tracking" json:"disable_click_tracking"`
+	// ABTest is optional.
+	ABTest *ABTest `db:"ab_test" json:"ab_test"`
+	// ABTestEnds is when the winner of the ABTest is picked, which is set after the sample has been queued.
+	ABTestEnds *time.Time `db:"ab_test_ends" json:"ab_test_ends"`
+	// ABWinner is the name of the winning variant of the ABTest, once picked.
+	ABWinner string `db:"ab_winner" json:"ab_winner"`
+	// RecipientsAdded is when all recipients were added while sending, which fixes the audience of the campaign.
+	RecipientsAdded *time.Time `db:"recipients_added" json:"recipients_added"`
+}
+
+// IsValid if it's on a valid list, has a subject that is not too long, has a body or Markdown content,
+// and the from address is either empty, meaning the default marketing address, or a valid address.
+// Campaigns with an A/B test cannot be delivered at a local send time, and need open or click tracking to pick by opens or clicks.
+func (c Campaign) IsValid() bool {
+	if !IsValidListID(c.ListID) {
+		return false
+	}
+	if strings.TrimSpace(c.Subject) == "" || utf8.RuneCountInString(c.Subject) > maxSubjectLength {
+		return false
+	}
+	if strings.TrimSpace(c.HTML) == "" && strings.TrimSpace(c.Text) == "" && strings.TrimSpace(c.Markdown) == "" {
+		return false
+	}
+	if c.From != "" {
+		if _, err := mail.ParseAddress(c.From); err != nil {
+			return false
+		}
+	}
+	if c.LocalSendTime != "" {
+		if _, err := time.Parse(localSendTimeLayout, c.LocalSendTime); err != nil {
+			return false
+		}
+	}
+	if c.ABTest != nil && (!c.ABTest.IsValid() || c.LocalSendTime != "") {
+		return false
+	}
+	if c.ABTest != nil && (c.ABTest.Metric == ABTestOpens && c.DisableOpenTracking ||
+		c.ABTest.Metric == ABTestClicks && c.DisableClickTracking) {
+		return false
+	}
+	return true
+}
+
+const localSendTimeLayout = "15:04"
+
+// NextLocalSendTime of the campaign in the given timezone at or after now, or now if it has no LocalSendTime.
+// Unknown timezones are taken to be UTC.
+func (c Campaign) NextLocalSendTime(timezone string, now time.Time) time.Time {
+	clock, err := time.Parse(localSendTimeLayout, c.LocalSendTime)
+	if err != nil {
+		return now
+	}
+	loc := time.UTC
+	if IsValidTimezone(timezone) {
+		loc, _ = time.LoadLocation(timezone)
+	}
+	local := now.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	if next.Before(local) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, clock.Hour(), clock.Minute(), 0, 0, loc)
+	}
+	return next
+}
+
+// ForVariant is a copy of the campaign with the subject and content of the variant with the given name,
+// where the variant sets them. Returns the campaign as it is if there is no such variant.
+func (c Campaign) ForVariant(name string) Campaign {
+	if c.ABTest == nil {
+		return c
+	}
+	for _, v := range c.ABTest.Variants {
+		if v.Name != name {
+			continue
+		}
+		if v.Subject != "" {
+			c.Subject = v.Subject
+		}
+		if v.Markdown != "" {
+			c.Markdown = v.Markdown
+		}
+		if v.HTML != "" {
+			c.HTML = v.HTML
+		}
+		if v.Text != "" {
+			c.Text = v.Text
+		}
+	}
+	return c
+}
+
+// AsTest is a copy of the campaign for a test send, with TestSubjectMarker in front of the subject.
+func (c Campaign) AsTest() Campaign {
+	c.Subject = TestSubjectMarker + " " + c.Subject
+	return c
+}
@@ -0,0 +1,137 @@
+package model_test
+
+import (
+	"Goo/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var validABTest = model.ABTest{
+	Variants:      []model.CampaignVariant{{Name: "a", Subject: "Hi"}, {Name: "b", Subject: "Hey"}},
+	SamplePercent: 20,
+	WaitMinutes:   60,
+	Metric:        model.ABTestOpens,
+}
+
+func TestCampaign_IsValid(t *testing.T) {
+	valid := model.Campaign{ListID: "newsletter", Subject: "Hello", HTML: "<p>Hi</p>", Text: "Hi"}
+
+	tests := map[string]struct {
+		change func(c *model.Campaign)
+		valid  bool
+	}{
+		"valid":                             {func(c *model.Campaign) {}, true},
+		"text only":                         {func(c *model.Campaign) { c.HTML = "" }, true},
+		"html only":                         {func(c *model.Campaign) { c.Text = "" }, true},
+		"markdown only":                     {func(c *model.Campaign) { c.HTML = ""; c.Text = ""; c.Markdown = "# Hi" }, true},
+		"from address":                      {func(c *model.Campaign) { c.From = "Goo <news@example.com>" }, true},
+		"invalid list":                      {func(c *model.Campaign) { c.ListID = "Not a list" }, false},
+		"empty subject":                     {func(c *model.Campaign) { c.Subject = " " }, false},
+		"too long subject":                  {func(c *model.Campaign) { c.Subject = strings.Repeat("a", 201) }, false},
+		"no body":                           {func(c *model.Campaign) { c.HTML = ""; c.Text = "" }, false},
+		"invalid from address":              {func(c *model.Campaign) { c.From = "news" }, false},
+		"local send time":                   {func(c *model.Campaign) { c.LocalSendTime = "09:00" }, true},
+		"invalid send time":                 {func(c *model.Campaign) { c.LocalSendTime = "9 am" }, false},
+		"ab test":                           {func(c *model.Campaign) { c.ABTest = &validABTest }, true},
+		"ab test at send time":              {func(c *model.Campaign) { c.ABTest = &validABTest; c.LocalSendTime = "09:00" }, false},
+		"invalid ab test":                   {func(c *model.Campaign) { c.ABTest = &model.ABTest{} }, false},
+		"ab test on opens without tracking": {func(c *model.Campaign) { c.ABTest = &validABTest; c.DisableOpenTracking = true }, false},
+		"ab test on opens without click tracking": {func(c *model.Campaign) { c.ABTest = &validABTest; c.DisableClickTracking = true }, true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := valid
+			test.change(&c)
+			require.Equal(t, test.valid, c.IsValid())
+		})
+	}
+}
+
+func TestCampaign_AsTest(t *testing.T) {
+	t.Run("marks the subject of a copy", func(t *testing.T) {
+		c := model.Campaign{Subject: "Hello"}
+		require.Equal(t, "[TEST] Hello", c.AsTest().Subject)
+		require.Equal(t, "Hello", c.Subject)
+	})
+}
+
+func TestCampaign_ForVariant(t *testing.T) {
+	c := model.Campaign{Subject: "Hello", HTML: "<p>Hi</p>", Text: "Hi", ABTest: &model.ABTest{
+		Variants: []model.CampaignVariant{{Name: "a", Subject: "Hey"}, {Name: "b", HTML: "<p>Yo</p>", Text: "Yo"}},
+	}}
+
+	t.Run("changes only what the variant sets", func(t *testing.T) {
+		a := c.ForVariant("a")
+		require.Equal(t, "Hey", a.Subject)
+		require.Equal(t, "<p>Hi</p>", a.HTML)
+
+		b := c.ForVariant("b")
+		require.Equal(t, "Hello", b.Subject)
+		require.Equal(t, "<p>Yo</p>", b.HTML)
+		require.Equal(t, "Yo", b.Text)
+	})
+
+	t.Run("returns the campaign for unknown variants", func(t *testing.T) {
+		require.Equal(t, c, c.ForVariant(""))
+	})
+}
+
+func TestABTest_IsValid(t *testing.T) {
+	tests := map[string]struct {
+		change func(t *model.ABTest)
+		valid  bool
+	}{
+		"valid":       {func(t *model.ABTest) {}, true},
+		"clicks":      {func(t *model.ABTest) { t.Metric = model.ABTestClicks }, true},
+		"one variant": {func(t *model.ABTest) { t.Variants = t.Variants[:1] }, false},
+		"same names": {func(t *model.ABTest) {
+			t.Variants = []model.CampaignVariant{{Name: "a", Subject: "Hi"}, {Name: "a", Subject: "Hey"}}
+		}, false},
+		"markdown variant": {func(t *model.ABTest) {
+			t.Variants = []model.CampaignVariant{{Name: "a", Subject: "Hi"}, {Name: "b", Markdown: "Hey"}}
+		}, true},
+		"empty variant":      {func(t *model.ABTest) { t.Variants = []model.CampaignVariant{{Name: "a", Subject: "Hi"}, {Name: "b"}} }, false},
+		"no sample":          {func(t *model.ABTest) { t.SamplePercent = 0 }, false},
+		"everyone in sample": {func(t *model.ABTest) { t.SamplePercent = 100 }, false},
+		"no wait":            {func(t *model.ABTest) { t.WaitMinutes = 0 }, false},
+		"too long wait":      {func(t *model.ABTest) { t.WaitMinutes = 7*24*60 + 1 }, false},
+		"unknown metric":     {func(t *model.ABTest) { t.Metric = "replies" }, false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			abTest := validABTest
+			abTest.Variants = append([]model.CampaignVariant{}, validABTest.Variants...)
+			test.change(&abTest)
+			require.Equal(t, test.valid, abTest.IsValid())
+		})
+	}
+}
+
+func TestCampaign_NextLocalSendTime(t *testing.T) {
+	c := model.Campaign{LocalSendTime: "09:00"}
+
+	t.Run("is later today if the time has not passed yet in the timezone", func(t *testing.T) {
+		now := time.Date(2026, 3, 2, 6, 0, 0, 0, time.UTC)
+		next := c.NextLocalSendTime("Europe/Copenhagen", now)
+		require.Equal(t, "2026-03-02 09:00", next.Format("2006-01-02 15:04"))
+		require.Equal(t, time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC), next.UTC())
+	})
+
+	t.Run("is tomorrow if the time has passed in the timezone", func(t *testing.T) {
+		now := time.Date(2026, 3, 2, 8, 30, 0, 0, time.UTC)
+		require.Equal(t, time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC), c.NextLocalSendTime("Europe/Copenhagen", now).UTC())
+	})
+
+	t.Run("uses UTC for unknown timezones", func(t *testing.T) {
+		now := time.Date(2026, 3, 2, 6, 0, 0, 0, time.UTC)
+		require.Equal(t, time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC), c.NextLocalSendTime("", now))
+	})
+
+	t.Run("is now without a local send time", func(t *testing.T) {
+		now := time.Now()
+		require.Equal(t, now, model.Campaign{}.NextLocalSendTime("Europe/Copenhagen", now))
+	})
+}
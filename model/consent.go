@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+)
+
+// ConsentTextVersion identifies the consent text currently shown on the signup and confirmation pages.
+// Change it whenever the text changes, so old consent records still point to what people agreed to.
+const ConsentTextVersion = "2026-10-18"
+
+// consentTextVersions that have been shown, including the current one. Keep old versions here when the text changes,
+// as forms rendered before the change can still be submitted.
+var consentTextVersions = []string{ConsentTextVersion}
+
+// IsKnownConsentTextVersion if the consent text with the version has been shown, see ConsentTextVersion.
+func IsKnownConsentTextVersion(version string) bool {
+	return contains(consentTextVersions, version)
+}
+
+// ConsentAction is what a subscriber did when giving consent.
+type ConsentAction string
+
+const (
+	ConsentSignup       ConsentAction = "signup"
+	ConsentConfirmation ConsentAction = "confirmation"
+)
+
+// Consent is the evidence of a subscriber agreeing to receive a List.
+type Consent struct {
+	ListID      string        `db:"list_id" json:"list_id"`
+	Email       Email         `db:"email" json:"email"`
+	Action      ConsentAction `db:"action" json:"action"`
+	IP          string        `db:"ip" json:"ip"`
+	UserAgent   string        `db:"user_agent" json:"user_agent"`
+	FormURL     string        `db:"form_url" json:"form_url"`
+	TextVersion string        `db:"text_version" json:"text_version"`
+	Created     time.Time     `db:"created" json:"created"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"strconv"
+	"time"
+)
+
+// DeliveryState is where a Delivery is in the sending process.
+type DeliveryState string
+
+const (
+	DeliveryQueued  DeliveryState = "queued"
+	DeliverySending DeliveryState = "sending"
+	DeliverySent    DeliveryState = "sent"
+	DeliveryFailed  DeliveryState = "failed"
+	DeliveryBounced DeliveryState = "bounced"
+	// DeliverySkipped is for deliveries that were not sent on purpose, such as to suppressed recipients.
+	DeliverySkipped DeliveryState = "skipped"
+)
+
+// Delivery of one email to one recipient, either from a template like the confirmation email, or of a Campaign.
+type Delivery struct {
+	ID           int           `db:"id" json:"id"`
+	Template     string        `db:"template" json:"template"`
+	CampaignID   *int          `db:"campaign_id" json:"campaign_id"`
+	ListID       string        `db:"list_id" json:"list_id"`
+	Email        Email         `db:"email" json:"email"`
+	State        DeliveryState `db:"state" json:"state"`
+	SMTPResponse string        `db:"smtp_response" json:"smtp_response"`
+	Attempts     int           `db:"attempts" json:"attempts"`
+	Created      time.Time     `db:"created" json:"created"`
+	Updated      time.Time     `db:"updated" json:"updated"`
+	Sent         *time.Time    `db:"sent" json:"sent"`
+	// Variant of the campaign ABTest that was sent, if any.
+	Variant string     `db:"variant" json:"variant"`
+	Opened  *time.Time `db:"opened" json:"opened"`
+	Clicked *time.Time `db:"clicked" json:"clicked"`
+}
+
+// GetDeliveryID from a message, or 0 if there is none, like in messages queued before there were deliveries.
+func GetDeliveryID(m Message) int {
+	id, _ := strconv.Atoi(m["delivery_id"])
+	return id
+}
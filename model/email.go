@@ -1,6 +1,9 @@
 package model
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
 
 var emailAddressMatcher = regexp.MustCompile(
 	// Start of string
@@ -23,3 +26,12 @@ func (e Email) IsValid() bool {
 func (e Email) String() string {
 	return string(e)
 }
+
+// Domain of the email address, lowercased. Empty if there is no @.
+func (e Email) Domain() string {
+	i := strings.LastIndex(string(e), "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(string(e)[i+1:])
+}
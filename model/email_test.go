@@ -26,3 +26,8 @@ func TestEmail_IsValid(t *testing.T) {
 		}
 	})
 }
+
+func TestEmail_Domain(t *testing.T) {
+	require.Equal(t, "example.com", model.Email("me@Example.com").Domain())
+	require.Equal(t, "", model.Email("notanemail").Domain())
+}
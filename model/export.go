@@ -0,0 +1,10 @@
+package model
+
+// SubjectAccessExport is everything stored about one email address, on all lists.
+type SubjectAccessExport struct {
+	Email       Email             `json:"email"`
+	Subscribers []Subscriber      `json:"subscribers"`
+	Events      []SubscriberEvent `json:"events"`
+	Consents    []Consent         `json:"consents"`
+	Deliveries  []Delivery        `json:"deliveries"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// FeedItem from an RSS or Atom feed.
+type FeedItem struct {
+	FeedURL string `db:"feed_url" json:"feed_url"`
+	// GUID identifies the item in the feed. It falls back to the link for RSS items without a guid.
+	GUID      string     `db:"guid" json:"guid"`
+	Title     string     `db:"title" json:"title"`
+	Link      string     `db:"link" json:"link"`
+	Summary   string     `db:"summary" json:"summary"`
+	Published *time.Time `db:"published" json:"published"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// ErrListNotFound is returned when signing up to a list that does not exist.
+var ErrListNotFound = errors.New("list not found")
+
+// DefaultListID is used for the newsletter routes that don't have a list in the path.
+const DefaultListID = "newsletter"
+
+var listIDMatcher = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// List of subscribers. One deployment can run many lists.
+type List struct {
+	ID      string    `db:"id" json:"id"`
+	Name    string    `db:"name" json:"name"`
+	Created time.Time `db:"created" json:"created"`
+}
+
+// reservedListIDs are the words after /newsletter/ in routes, which lists cannot use,
+// as their routes like /newsletter/{list}/archive would clash.
+var reservedListIDs = []string{"archive", "confirm", "confirmed", "expired", "preferences", "signup", "thanks",
+	"unsubscribe", "unsubscribed"}
+
+// IsValidListID if it's a lowercase slug usable in URLs, and not a reserved word.
+func IsValidListID(id string) bool {
+	return listIDMatcher.MatchString(id) && !contains(reservedListIDs, id)
+}
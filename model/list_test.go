@@ -0,0 +1,32 @@
+package model_test
+
+import (
+	"Goo/model"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestIsValidListID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"newsletter", true},
+		{"go-weekly-2", true},
+		{"", false},
+		{"-go", false},
+		{"Go", false},
+		{"go weekly", false},
+		{"go/weekly", false},
+		{"archive", false},
+		{"confirm", false},
+		{"archives", true},
+	}
+	t.Run("reports list IDs usable in URLs", func(t *testing.T) {
+		for _, test := range tests {
+			t.Run(test.id, func(t *testing.T) {
+				require.Equal(t, test.valid, model.IsValidListID(test.id))
+			})
+		}
+	})
+}
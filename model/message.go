@@ -1,4 +1,75 @@
 package model
 
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
 // Message for communication through a queue.
 type Message = map[string]string
+
+// NewSubscriberMessage for the given job, with the subscriber fields that jobs need to address
+// and personalize emails without looking up the subscriber.
+func NewSubscriberMessage(job string, s Subscriber) Message {
+	attributes := []byte("{}")
+	if s.Attributes != nil {
+		attributes, _ = json.Marshal(s.Attributes)
+	}
+	m := Message{
+		"job":        job,
+		"list":       s.ListID,
+		"email":      s.Email.String(),
+		"first_name": s.FirstName,
+		"last_name":  s.LastName,
+		"attributes": string(attributes),
+	}
+	if s.PreferencesToken != "" {
+		m["preferences_token"] = s.PreferencesToken
+	}
+	return m
+}
+
+// GetSubscriber from a message created with NewSubscriberMessage.
+// Messages from before there were several lists are for the default list.
+func GetSubscriber(m Message) (Subscriber, error) {
+	email, ok := m["email"]
+	if !ok {
+		return Subscriber{}, errors.New("no email address in message")
+	}
+	s := Subscriber{
+		ListID:           DefaultListID,
+		Email:            Email(email),
+		PreferencesToken: m["preferences_token"],
+		Preferences: Preferences{
+			FirstName: m["first_name"],
+			LastName:  m["last_name"],
+		},
+	}
+	if listID, ok := m["list"]; ok {
+		s.ListID = listID
+	}
+	if attributes, ok := m["attributes"]; ok {
+		if err := json.Unmarshal([]byte(attributes), &s.Attributes); err != nil {
+			return Subscriber{}, err
+		}
+	}
+	return s, nil
+}
+
+// NewCampaignMessage for the given job and campaign.
+func NewCampaignMessage(job string, campaignID int) Message {
+	return Message{
+		"job":         job,
+		"campaign_id": strconv.Itoa(campaignID),
+	}
+}
+
+// GetCampaignID from a message created with NewCampaignMessage.
+func GetCampaignID(m Message) (int, error) {
+	id, ok := m["campaign_id"]
+	if !ok {
+		return 0, errors.New("no campaign ID in message")
+	}
+	return strconv.Atoi(id)
+}
@@ -0,0 +1,61 @@
+package model_test
+
+import (
+	"Goo/model"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGetSubscriber(t *testing.T) {
+	t.Run("gets the subscriber from a message created with NewSubscriberMessage", func(t *testing.T) {
+		s := model.Subscriber{
+			ListID:           "golang",
+			Email:            "me@example.com",
+			PreferencesToken: "456",
+			Attributes:       model.Attributes{"company": "Goo"},
+			Preferences:      model.Preferences{FirstName: "Me", LastName: "Myself"},
+		}
+		m := model.NewSubscriberMessage("welcome_email", s)
+		require.Equal(t, "welcome_email", m["job"])
+
+		s2, err := model.GetSubscriber(m)
+		require.NoError(t, err)
+		require.Equal(t, s, s2)
+	})
+
+	t.Run("stores no attributes as an empty object", func(t *testing.T) {
+		m := model.NewSubscriberMessage("welcome_email", model.Subscriber{Email: "me@example.com"})
+		require.Equal(t, "{}", m["attributes"])
+	})
+
+	t.Run("uses the default list for messages without one", func(t *testing.T) {
+		s, err := model.GetSubscriber(model.Message{"email": "me@example.com"})
+		require.NoError(t, err)
+		require.Equal(t, "newsletter", s.ListID)
+		require.Equal(t, model.Email("me@example.com"), s.Email)
+	})
+
+	t.Run("errors if there is no email address", func(t *testing.T) {
+		_, err := model.GetSubscriber(model.Message{})
+		require.Error(t, err)
+	})
+}
+
+func TestGetCampaignID(t *testing.T) {
+	t.Run("gets the campaign ID from a message created with NewCampaignMessage", func(t *testing.T) {
+		m := model.NewCampaignMessage("send_campaign", 123)
+		require.Equal(t, "send_campaign", m["job"])
+
+		id, err := model.GetCampaignID(m)
+		require.NoError(t, err)
+		require.Equal(t, 123, id)
+	})
+
+	t.Run("errors if there is no valid campaign ID", func(t *testing.T) {
+		_, err := model.GetCampaignID(model.Message{})
+		require.Error(t, err)
+
+		_, err = model.GetCampaignID(model.Message{"campaign_id": "abc"})
+		require.Error(t, err)
+	})
+}
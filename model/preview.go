@@ -0,0 +1,24 @@
+package model
+
+// EmailPreview is an email rendered like it would be sent, for looking at without sending it.
+type EmailPreview struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// SampleSubscriber on the list, for previewing emails without a real subscriber.
+func SampleSubscriber(listID string) Subscriber {
+	return Subscriber{
+		ListID:           listID,
+		Email:            "jane.doe@example.com",
+		PreferencesToken: "sample",
+		Attributes:       Attributes{},
+		Preferences: Preferences{
+			FirstName: "Jane",
+			LastName:  "Doe",
+		},
+	}
+}
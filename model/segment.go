@@ -0,0 +1,353 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrSegmentNotFound is returned when a campaign refers to a segment that is not on its list.
+var ErrSegmentNotFound = errors.New("segment not found")
+
+// ErrSegmentInUse is returned when deleting a segment that campaigns are targeted at.
+var ErrSegmentInUse = errors.New("segment in use")
+
+const (
+	maxSegmentNameLength  = 100
+	maxSegmentQueryLength = 2000
+)
+
+// Segment of the subscribers on a list, saved to target campaigns at.
+// See ParseSegmentQuery for the query language.
+type Segment struct {
+	ID      int       `db:"id" json:"id"`
+	ListID  string    `db:"list_id" json:"list_id"`
+	Name    string    `db:"name" json:"name"`
+	Query   string    `db:"query" json:"query"`
+	Created time.Time `db:"created" json:"created"`
+	Updated time.Time `db:"updated" json:"updated"`
+}
+
+// IsValid if it's on a valid list, has a name that is not too long, and a query that parses.
+func (s Segment) IsValid() bool {
+	if !IsValidListID(s.ListID) {
+		return false
+	}
+	if strings.TrimSpace(s.Name) == "" || utf8.RuneCountInString(s.Name) > maxSegmentNameLength {
+		return false
+	}
+	_, err := ParseSegmentQuery(s.Query)
+	return err == nil
+}
+
+// SegmentFieldType decides which values and operators a field in a segment query can be used with.
+type SegmentFieldType int
+
+const (
+	SegmentText SegmentFieldType = iota
+	SegmentNumber
+	SegmentDate
+	SegmentBool
+	SegmentTag
+)
+
+// SegmentFields that can be used in segment queries, besides attributes.<key> for the subscriber Attributes.
+// tag is one of the subscriber Topics, signed_up is the signup date,
+// and opens, clicks, last_opened and last_clicked are the engagement with campaigns on the list.
+// Subscribers who never opened or clicked have a last_opened or last_clicked before any date.
+var SegmentFields = map[string]SegmentFieldType{
+	"email":        SegmentText,
+	"first_name":   SegmentText,
+	"last_name":    SegmentText,
+	"state":        SegmentText,
+	"frequency":    SegmentText,
+	"paused":       SegmentBool,
+	"tag":          SegmentTag,
+	"signed_up":    SegmentDate,
+	"opens":        SegmentNumber,
+	"clicks":       SegmentNumber,
+	"last_opened":  SegmentDate,
+	"last_clicked": SegmentDate,
+}
+
+// SegmentAttributePrefix of fields for subscriber Attributes, like attributes.company.
+const SegmentAttributePrefix = "attributes."
+
+// SegmentCombinator of the filters in a SegmentFilter.
+type SegmentCombinator string
+
+const (
+	SegmentAnd SegmentCombinator = "and"
+	SegmentOr  SegmentCombinator = "or"
+	SegmentNot SegmentCombinator = "not"
+)
+
+// SegmentFilter is a parsed segment query. It's either a Rule, or Filters combined with AND or OR,
+// or a single filter with NOT.
+type SegmentFilter struct {
+	// Combinator of the Filters, or empty for a Rule.
+	Combinator SegmentCombinator
+	Filters    []SegmentFilter
+	Rule       SegmentRule
+}
+
+// SegmentRule compares a subscriber field to a value.
+type SegmentRule struct {
+	Field    string
+	Type     SegmentFieldType
+	Operator string
+	// Value is a string for text and tag fields, an int for numbers, a bool, or a time.Time for dates.
+	Value interface{}
+}
+
+var segmentOperators = map[SegmentFieldType][]string{
+	SegmentText:   {"=", "!="},
+	SegmentTag:    {"=", "!="},
+	SegmentBool:   {"=", "!="},
+	SegmentNumber: {"=", "!=", "<", "<=", ">", ">="},
+	SegmentDate:   {"=", "!=", "<", "<=", ">", ">="},
+}
+
+// ParseSegmentQuery like `tag = "go" AND signed_up > 2026-01-01`.
+// Rules compare a field to a string in double quotes, a whole number, a date like 2026-01-01, or true or false.
+// Text, tag and boolean fields can be compared with = and !=, numbers and dates also with <, <=, > and >=.
+// Rules are combined with AND, OR and NOT, where AND binds tighter than OR, and parentheses group.
+func ParseSegmentQuery(query string) (SegmentFilter, error) {
+	if len(query) > maxSegmentQueryLength {
+		return SegmentFilter{}, errors.New("query is too long")
+	}
+	tokens, err := lexSegmentQuery(query)
+	if err != nil {
+		return SegmentFilter{}, err
+	}
+	p := &segmentParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return SegmentFilter{}, err
+	}
+	if t := p.peek(); t.kind != segmentEOF {
+		return SegmentFilter{}, fmt.Errorf("unexpected %v at %v", t.text, t.pos)
+	}
+	return f, nil
+}
+
+type segmentTokenKind int
+
+const (
+	segmentEOF segmentTokenKind = iota
+	segmentIdent
+	segmentString
+	segmentLiteral
+	segmentOperator
+	segmentOpen
+	segmentClose
+)
+
+type segmentToken struct {
+	kind segmentTokenKind
+	text string
+	pos  int
+}
+
+var dateMatcher = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+func lexSegmentQuery(query string) ([]segmentToken, error) {
+	var tokens []segmentToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, segmentToken{segmentOpen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, segmentToken{segmentClose, ")", i})
+			i++
+		case c == '=':
+			tokens = append(tokens, segmentToken{segmentOperator, "=", i})
+			i++
+		case c == '!' || c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(query) && query[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected ! at %v", i)
+			}
+			tokens = append(tokens, segmentToken{segmentOperator, op, i})
+			i += len(op)
+		case c == '"':
+			end := i + 1
+			for ; end < len(query) && query[end] != '"'; end++ {
+				if query[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(query) {
+				return nil, fmt.Errorf("unterminated string at %v", i)
+			}
+			s, err := strconv.Unquote(query[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %v", i)
+			}
+			tokens = append(tokens, segmentToken{segmentString, s, i})
+			i = end + 1
+		case c == '-' || isDigit(c):
+			end := i + 1
+			for end < len(query) && (isDigit(query[end]) || query[end] == '-') {
+				end++
+			}
+			tokens = append(tokens, segmentToken{segmentLiteral, query[i:end], i})
+			i = end
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i + 1
+			for end < len(query) && (query[end] == '_' || query[end] == '.' || isDigit(query[end]) ||
+				unicode.IsLetter(rune(query[end]))) {
+				end++
+			}
+			tokens = append(tokens, segmentToken{segmentIdent, query[i:end], i})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at %v", c, i)
+		}
+	}
+	return append(tokens, segmentToken{segmentEOF, "end of query", len(query)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type segmentParser struct {
+	tokens []segmentToken
+	i      int
+}
+
+func (p *segmentParser) peek() segmentToken {
+	return p.tokens[p.i]
+}
+
+func (p *segmentParser) next() segmentToken {
+	t := p.tokens[p.i]
+	if t.kind != segmentEOF {
+		p.i++
+	}
+	return t
+}
+
+// isKeyword if the next token is the given keyword, in any case.
+func (p *segmentParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == segmentIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *segmentParser) parseOr() (SegmentFilter, error) {
+	return p.parseCombined(SegmentOr, p.parseAnd)
+}
+
+func (p *segmentParser) parseAnd() (SegmentFilter, error) {
+	return p.parseCombined(SegmentAnd, p.parseUnary)
+}
+
+func (p *segmentParser) parseCombined(c SegmentCombinator, parse func() (SegmentFilter, error)) (SegmentFilter, error) {
+	f, err := parse()
+	if err != nil {
+		return f, err
+	}
+	filters := []SegmentFilter{f}
+	for p.isKeyword(string(c)) {
+		p.next()
+		f, err := parse()
+		if err != nil {
+			return f, err
+		}
+		filters = append(filters, f)
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return SegmentFilter{Combinator: c, Filters: filters}, nil
+}
+
+func (p *segmentParser) parseUnary() (SegmentFilter, error) {
+	if p.isKeyword("not") {
+		p.next()
+		f, err := p.parseUnary()
+		if err != nil {
+			return f, err
+		}
+		return SegmentFilter{Combinator: SegmentNot, Filters: []SegmentFilter{f}}, nil
+	}
+	if p.peek().kind == segmentOpen {
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return f, err
+		}
+		if t := p.next(); t.kind != segmentClose {
+			return f, fmt.Errorf("expected ) at %v", t.pos)
+		}
+		return f, nil
+	}
+	rule, err := p.parseRule()
+	return SegmentFilter{Rule: rule}, err
+}
+
+func (p *segmentParser) parseRule() (SegmentRule, error) {
+	var rule SegmentRule
+
+	field := p.next()
+	if field.kind != segmentIdent {
+		return rule, fmt.Errorf("expected a field at %v", field.pos)
+	}
+	rule.Field = field.text
+	fieldType, ok := SegmentFields[field.text]
+	if key := strings.TrimPrefix(field.text, SegmentAttributePrefix); key != field.text {
+		fieldType, ok = SegmentText, len(key) <= maxAttributeKeyLength && attributeKeyMatcher.MatchString(key)
+	}
+	if !ok {
+		return rule, fmt.Errorf("unknown field %v at %v", field.text, field.pos)
+	}
+	rule.Type = fieldType
+
+	op := p.next()
+	if op.kind != segmentOperator {
+		return rule, fmt.Errorf("expected an operator at %v", op.pos)
+	}
+	if !contains(segmentOperators[fieldType], op.text) {
+		return rule, fmt.Errorf("operator %v cannot be used with %v at %v", op.text, field.text, op.pos)
+	}
+	rule.Operator = op.text
+
+	value := p.next()
+	var err error
+	switch fieldType {
+	case SegmentText, SegmentTag:
+		if value.kind != segmentString {
+			return rule, fmt.Errorf("expected a string at %v", value.pos)
+		}
+		rule.Value = value.text
+	case SegmentNumber:
+		rule.Value, err = strconv.Atoi(value.text)
+		if value.kind != segmentLiteral || err != nil {
+			return rule, fmt.Errorf("expected a number at %v", value.pos)
+		}
+	case SegmentDate:
+		rule.Value, err = time.Parse("2006-01-02", value.text)
+		if value.kind != segmentLiteral || !dateMatcher.MatchString(value.text) || err != nil {
+			return rule, fmt.Errorf("expected a date like 2026-01-01 at %v", value.pos)
+		}
+	case SegmentBool:
+		if value.kind != segmentIdent || (value.text != "true" && value.text != "false") {
+			return rule, fmt.Errorf("expected true or false at %v", value.pos)
+		}
+		rule.Value = value.text == "true"
+	}
+	return rule, nil
+}
@@ -0,0 +1,91 @@
+package model_test
+
+import (
+	"Goo/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSegmentQuery(t *testing.T) {
+	rule := func(field string, typ model.SegmentFieldType, op string, value interface{}) model.SegmentFilter {
+		return model.SegmentFilter{Rule: model.SegmentRule{Field: field, Type: typ, Operator: op, Value: value}}
+	}
+	tag := rule("tag", model.SegmentTag, "=", "go")
+	signedUp := rule("signed_up", model.SegmentDate, ">", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	opens := rule("opens", model.SegmentNumber, ">=", 3)
+
+	t.Run("parses rules combined with AND, OR and NOT", func(t *testing.T) {
+		tests := map[string]model.SegmentFilter{
+			`tag = "go"`:                            tag,
+			`tag = "go" AND signed_up > 2026-01-01`: {Combinator: model.SegmentAnd, Filters: []model.SegmentFilter{tag, signedUp}},
+			`tag = "go" or signed_up > 2026-01-01 and opens >= 3`: {Combinator: model.SegmentOr, Filters: []model.SegmentFilter{
+				tag,
+				{Combinator: model.SegmentAnd, Filters: []model.SegmentFilter{signedUp, opens}},
+			}},
+			`(tag = "go" OR signed_up > 2026-01-01) AND opens >= 3`: {Combinator: model.SegmentAnd, Filters: []model.SegmentFilter{
+				{Combinator: model.SegmentOr, Filters: []model.SegmentFilter{tag, signedUp}},
+				opens,
+			}},
+			`NOT tag = "go"`:                {Combinator: model.SegmentNot, Filters: []model.SegmentFilter{tag}},
+			`paused != true`:                rule("paused", model.SegmentBool, "!=", true),
+			`attributes.company = "Acme"`:   rule("attributes.company", model.SegmentText, "=", "Acme"),
+			`first_name = "Jane \"J\" Doe"`: rule("first_name", model.SegmentText, "=", `Jane "J" Doe`),
+		}
+		for query, expected := range tests {
+			f, err := model.ParseSegmentQuery(query)
+			require.NoError(t, err, query)
+			require.Equal(t, expected, f, query)
+		}
+	})
+
+	t.Run("errors on invalid queries", func(t *testing.T) {
+		for _, query := range []string{
+			``,
+			`tag`,
+			`tag =`,
+			`tag = go`,
+			`tag > "go"`,
+			`unknown = "go"`,
+			`attributes.Company = "Acme"`,
+			`opens > "3"`,
+			`signed_up > 2026-13-01`,
+			`signed_up > 1`,
+			`paused = yes`,
+			`tag = "go" AND`,
+			`(tag = "go"`,
+			`tag = "go")`,
+			`tag = "go`,
+			`tag ! "go"`,
+			`tag = "go"; drop table campaigns`,
+			strings.Repeat(`tag = "go" or `, 200) + `tag = "go"`,
+		} {
+			_, err := model.ParseSegmentQuery(query)
+			require.Error(t, err, query)
+		}
+	})
+}
+
+func TestSegment_IsValid(t *testing.T) {
+	valid := model.Segment{ListID: "newsletter", Name: "Gophers", Query: `tag = "go"`}
+
+	tests := map[string]struct {
+		change func(s *model.Segment)
+		valid  bool
+	}{
+		"valid":         {func(s *model.Segment) {}, true},
+		"invalid list":  {func(s *model.Segment) { s.ListID = "Not a list" }, false},
+		"empty name":    {func(s *model.Segment) { s.Name = " " }, false},
+		"too long name": {func(s *model.Segment) { s.Name = strings.Repeat("a", 101) }, false},
+		"invalid query": {func(s *model.Segment) { s.Query = "tag" }, false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := valid
+			test.change(&s)
+			require.Equal(t, test.valid, s.IsValid())
+		})
+	}
+}
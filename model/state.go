@@ -0,0 +1,62 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidTransition is returned when a subscriber cannot go from its current state to the requested one.
+var ErrInvalidTransition = errors.New("invalid subscriber state transition")
+
+// SubscriberState is where a Subscriber is in its lifecycle on a List.
+type SubscriberState string
+
+const (
+	// StateNew is the state before a Subscriber exists.
+	StateNew          SubscriberState = ""
+	StatePending      SubscriberState = "pending"
+	StateConfirmed    SubscriberState = "confirmed"
+	StateUnsubscribed SubscriberState = "unsubscribed"
+	StateBounced      SubscriberState = "bounced"
+	StateComplained   SubscriberState = "complained"
+	StateErased       SubscriberState = "erased"
+)
+
+// transitions allowed from each state.
+// Unsubscribed and bounced subscribers can sign up again, but complaints are final, to protect the sender reputation.
+// Nothing comes after erasure.
+var transitions = map[SubscriberState][]SubscriberState{
+	StateNew:          {StatePending},
+	StatePending:      {StateConfirmed, StateUnsubscribed, StateBounced, StateComplained, StateErased},
+	StateConfirmed:    {StateUnsubscribed, StateBounced, StateComplained, StateErased},
+	StateUnsubscribed: {StatePending, StateErased},
+	StateBounced:      {StatePending, StateErased},
+	StateComplained:   {StateErased},
+	StateErased:       {},
+}
+
+// CanTransitionTo the given state from this one.
+func (s SubscriberState) CanTransitionTo(to SubscriberState) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid if the state is one of the known states, not counting StateNew.
+func (s SubscriberState) IsValid() bool {
+	_, ok := transitions[s]
+	return ok && s != StateNew
+}
+
+// SubscriberEvent records a transition between two states.
+type SubscriberEvent struct {
+	ListID  string          `db:"list_id" json:"list_id"`
+	Email   Email           `db:"email" json:"email"`
+	From    SubscriberState `db:"from_state" json:"from"`
+	To      SubscriberState `db:"to_state" json:"to"`
+	Reason  string          `db:"reason" json:"reason"`
+	Created time.Time       `db:"created" json:"created"`
+}
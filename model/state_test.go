@@ -0,0 +1,42 @@
+package model_test
+
+import (
+	"Goo/model"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSubscriberState_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to model.SubscriberState
+		allowed  bool
+	}{
+		{model.StateNew, model.StatePending, true},
+		{model.StateNew, model.StateConfirmed, false},
+		{model.StatePending, model.StateConfirmed, true},
+		{model.StatePending, model.StatePending, false},
+		{model.StateConfirmed, model.StatePending, false},
+		{model.StateConfirmed, model.StateUnsubscribed, true},
+		{model.StateUnsubscribed, model.StatePending, true},
+		{model.StateUnsubscribed, model.StateConfirmed, false},
+		{model.StateBounced, model.StatePending, true},
+		{model.StateComplained, model.StatePending, false},
+		{model.StateComplained, model.StateErased, true},
+		{model.StateErased, model.StatePending, false},
+	}
+	t.Run("allows only valid transitions", func(t *testing.T) {
+		for _, test := range tests {
+			t.Run(string(test.from)+"->"+string(test.to), func(t *testing.T) {
+				require.Equal(t, test.allowed, test.from.CanTransitionTo(test.to))
+			})
+		}
+	})
+}
+
+func TestSubscriberState_IsValid(t *testing.T) {
+	t.Run("reports known states", func(t *testing.T) {
+		require.True(t, model.StateConfirmed.IsValid())
+		require.False(t, model.StateNew.IsValid())
+		require.False(t, model.SubscriberState("sleeping").IsValid())
+	})
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrTokenExpired is returned when confirming with a token that is too old.
+var ErrTokenExpired = errors.New("token expired")
+
+// Subscriber to the newsletter on a List.
+type Subscriber struct {
+	ListID           string          `db:"list_id" json:"list_id"`
+	Email            Email           `db:"email" json:"email"`
+	State            SubscriberState `db:"state" json:"state"`
+	PreferencesToken string          `db:"preferences_token" json:"-"`
+	Attributes       Attributes      `db:"attributes" json:"attributes"`
+	Timezone         string          `db:"timezone" json:"timezone"`
+	Created          time.Time       `db:"created" json:"created"`
+	Updated          time.Time       `db:"updated" json:"updated"`
+	Preferences
+}
+
+// Name of the Subscriber for display, which may be empty.
+func (s Subscriber) Name() string {
+	return strings.TrimSpace(s.FirstName + " " + s.LastName)
+}
+
+// Preferences a Subscriber can change on the preferences page.
+type Preferences struct {
+	FirstName string `db:"first_name" json:"first_name"`
+	LastName  string `db:"last_name" json:"last_name"`
+	Topics    Topics `db:"topics" json:"topics"`
+	Frequency string `db:"frequency" json:"frequency"`
+	Paused    bool   `db:"paused" json:"paused"`
+}
+
+// AvailableTopics subscribers can choose from.
+var AvailableTopics = []string{"articles", "courses", "events"}
+
+// AvailableFrequencies subscribers can choose from.
+var AvailableFrequencies = []string{"weekly", "monthly"}
+
+const maxNameLength = 100
+
+// IsValidName if it's not too long. Names are optional, so the empty string is valid.
+func IsValidName(name string) bool {
+	return utf8.RuneCountInString(name) <= maxNameLength
+}
+
+const maxTimezoneLength = 64
+
+// IsValidTimezone if it's the IANA name of a timezone, like Europe/Copenhagen or UTC.
+// Subscribers whose timezone is unknown have an empty one.
+func IsValidTimezone(name string) bool {
+	if name == "" || name == "Local" || len(name) > maxTimezoneLength {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// IsValid if the names are valid and the topics and frequency are among the available ones.
+func (p Preferences) IsValid() bool {
+	if !IsValidName(p.FirstName) || !IsValidName(p.LastName) {
+		return false
+	}
+	for _, topic := range p.Topics {
+		if !contains(AvailableTopics, topic) {
+			return false
+		}
+	}
+	return contains(AvailableFrequencies, p.Frequency)
+}
+
+// Topics a Subscriber is interested in, stored as a JSON array.
+type Topics []string
+
+// Has the given topic.
+func (t Topics) Has(topic string) bool {
+	return contains(t, topic)
+}
+
+// Scan implements sql.Scanner.
+func (t *Topics) Scan(src interface{}) error {
+	data, err := getJSONBytes(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, t)
+}
+
+// Value implements driver.Valuer.
+func (t Topics) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(t)
+	return string(data), err
+}
+
+const (
+	maxAttributes           = 20
+	maxAttributeKeyLength   = 64
+	maxAttributeValueLength = 1000
+)
+
+var attributeKeyMatcher = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Attributes are arbitrary extra fields given at signup, stored as a JSON object.
+type Attributes map[string]string
+
+// IsValid if there are not too many attributes, the keys are lowercase identifiers,
+// and keys and values are not too long.
+func (a Attributes) IsValid() bool {
+	if len(a) > maxAttributes {
+		return false
+	}
+	for key, value := range a {
+		if len(key) > maxAttributeKeyLength || !attributeKeyMatcher.MatchString(key) {
+			return false
+		}
+		if utf8.RuneCountInString(value) > maxAttributeValueLength {
+			return false
+		}
+	}
+	return true
+}
+
+// Scan implements sql.Scanner.
+func (a *Attributes) Scan(src interface{}) error {
+	data, err := getJSONBytes(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, a)
+}
+
+// Value implements driver.Valuer.
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(a)
+	return string(data), err
+}
+
+func getJSONBytes(src interface{}) ([]byte, error) {
+	switch v := src.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, errors.New("unsupported type for JSON column")
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
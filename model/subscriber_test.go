@@ -0,0 +1,101 @@
+package model_test
+
+import (
+	"Goo/model"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestPreferences_IsValid(t *testing.T) {
+	tests := []struct {
+		name        string
+		preferences model.Preferences
+		valid       bool
+	}{
+		{"no topics", model.Preferences{Frequency: "weekly"}, true},
+		{"available topics", model.Preferences{Topics: model.Topics{"articles", "events"}, Frequency: "monthly"}, true},
+		{"unknown topic", model.Preferences{Topics: model.Topics{"cats"}, Frequency: "weekly"}, false},
+		{"unknown frequency", model.Preferences{Frequency: "hourly"}, false},
+		{"no frequency", model.Preferences{}, false},
+		{"names", model.Preferences{FirstName: "Me", LastName: "Myself", Frequency: "weekly"}, true},
+		{"too long name", model.Preferences{FirstName: strings.Repeat("a", 101), Frequency: "weekly"}, false},
+	}
+	t.Run("reports valid preferences", func(t *testing.T) {
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				require.Equal(t, test.valid, test.preferences.IsValid())
+			})
+		}
+	})
+}
+
+func TestTopics(t *testing.T) {
+	t.Run("round-trips through the database representation", func(t *testing.T) {
+		value, err := model.Topics{"articles", "events"}.Value()
+		require.NoError(t, err)
+		require.Equal(t, `["articles","events"]`, value)
+
+		var topics model.Topics
+		err = topics.Scan([]byte(value.(string)))
+		require.NoError(t, err)
+		require.Equal(t, model.Topics{"articles", "events"}, topics)
+		require.True(t, topics.Has("events"))
+		require.False(t, topics.Has("courses"))
+	})
+
+	t.Run("stores nil as an empty array", func(t *testing.T) {
+		value, err := model.Topics(nil).Value()
+		require.NoError(t, err)
+		require.Equal(t, "[]", value)
+	})
+}
+
+func TestSubscriber_Name(t *testing.T) {
+	t.Run("joins first and last name", func(t *testing.T) {
+		s := model.Subscriber{Preferences: model.Preferences{FirstName: "Me", LastName: "Myself"}}
+		require.Equal(t, "Me Myself", s.Name())
+	})
+
+	t.Run("has no extra space if a name is missing", func(t *testing.T) {
+		s := model.Subscriber{Preferences: model.Preferences{LastName: "Myself"}}
+		require.Equal(t, "Myself", s.Name())
+		require.Equal(t, "", model.Subscriber{}.Name())
+	})
+}
+
+func TestAttributes(t *testing.T) {
+	t.Run("reports valid attributes", func(t *testing.T) {
+		require.True(t, model.Attributes{}.IsValid())
+		require.True(t, model.Attributes{"company": "Goo", "role_2": "dev"}.IsValid())
+		require.False(t, model.Attributes{"Company": "Goo"}.IsValid())
+		require.False(t, model.Attributes{"com pany": "Goo"}.IsValid())
+		require.False(t, model.Attributes{"company": strings.Repeat("a", 1001)}.IsValid())
+
+		tooMany := model.Attributes{}
+		for i := 0; i < 21; i++ {
+			tooMany[strings.Repeat("a", i+1)] = "a"
+		}
+		require.False(t, tooMany.IsValid())
+	})
+
+	t.Run("round-trips through the database representation", func(t *testing.T) {
+		value, err := model.Attributes{"company": "Goo"}.Value()
+		require.NoError(t, err)
+		require.Equal(t, `{"company":"Goo"}`, value)
+
+		var attributes model.Attributes
+		err = attributes.Scan(value)
+		require.NoError(t, err)
+		require.Equal(t, model.Attributes{"company": "Goo"}, attributes)
+	})
+}
+
+func TestIsValidTimezone(t *testing.T) {
+	for _, timezone := range []string{"UTC", "Europe/Copenhagen", "America/New_York"} {
+		require.True(t, model.IsValidTimezone(timezone), timezone)
+	}
+	for _, timezone := range []string{"", "Local", "Mars/Olympus_Mons", "../../etc/passwd"} {
+		require.False(t, model.IsValidTimezone(timezone), timezone)
+	}
+}
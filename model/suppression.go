@@ -0,0 +1,80 @@
+package model
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrSuppressed is returned when trying to send marketing email to a suppressed recipient.
+var ErrSuppressed = errors.New("recipient is suppressed")
+
+// SuppressionKind is what the value of a Suppression matches.
+type SuppressionKind string
+
+const (
+	// SuppressionAddress matches one email address.
+	SuppressionAddress SuppressionKind = "address"
+	// SuppressionDomain matches all email addresses at a domain.
+	SuppressionDomain SuppressionKind = "domain"
+	// SuppressionHash matches the salted hash of an erased email address.
+	SuppressionHash SuppressionKind = "hash"
+)
+
+// SuppressionReason is why a Suppression was added.
+type SuppressionReason string
+
+const (
+	SuppressionManual    SuppressionReason = "manual"
+	SuppressionBounce    SuppressionReason = "bounce"
+	SuppressionComplaint SuppressionReason = "complaint"
+	SuppressionErasure   SuppressionReason = "erasure"
+)
+
+var domainMatcher = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?(?:\.[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?)+$`)
+
+// Suppression of an address or domain, which gets no marketing email until it expires.
+type Suppression struct {
+	ID      int               `db:"id" json:"id"`
+	Kind    SuppressionKind   `db:"kind" json:"kind"`
+	Value   string            `db:"value" json:"value"`
+	Reason  SuppressionReason `db:"reason" json:"reason"`
+	Expires *time.Time        `db:"expires" json:"expires"`
+	Created time.Time         `db:"created" json:"created"`
+}
+
+// NewSuppression of the address or domain in the value, which is lowercased.
+// It's an address if it has an @, and a domain otherwise.
+func NewSuppression(value string, reason SuppressionReason, expires *time.Time) Suppression {
+	value = strings.ToLower(strings.TrimSpace(value))
+	kind := SuppressionDomain
+	if strings.Contains(value, "@") {
+		kind = SuppressionAddress
+	}
+	return Suppression{Kind: kind, Value: value, Reason: reason, Expires: expires}
+}
+
+// IsValid if the value is a valid address or domain, and the reason is known.
+// Hashes are added on erasure only, so they are not valid here, and neither is the erasure reason.
+func (s Suppression) IsValid() bool {
+	switch s.Kind {
+	case SuppressionAddress:
+		if !Email(s.Value).IsValid() {
+			return false
+		}
+	case SuppressionDomain:
+		if len(s.Value) > 253 || !domainMatcher.MatchString(s.Value) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	switch s.Reason {
+	case SuppressionManual, SuppressionBounce, SuppressionComplaint:
+		return true
+	default:
+		return false
+	}
+}
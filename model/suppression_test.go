@@ -0,0 +1,43 @@
+package model_test
+
+import (
+	"Goo/model"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSuppression(t *testing.T) {
+	t.Run("suppresses an address if there is an @, and a domain otherwise", func(t *testing.T) {
+		s := model.NewSuppression(" Me@Example.com ", model.SuppressionManual, nil)
+		require.Equal(t, model.SuppressionAddress, s.Kind)
+		require.Equal(t, "me@example.com", s.Value)
+
+		s = model.NewSuppression("Example.com", model.SuppressionBounce, nil)
+		require.Equal(t, model.SuppressionDomain, s.Kind)
+		require.Equal(t, "example.com", s.Value)
+	})
+}
+
+func TestSuppression_IsValid(t *testing.T) {
+	tests := []struct {
+		value  string
+		reason model.SuppressionReason
+		valid  bool
+	}{
+		{"me@example.com", model.SuppressionManual, true},
+		{"example.com", model.SuppressionBounce, true},
+		{"mail.example.co.uk", model.SuppressionComplaint, true},
+		{"me@example.com", model.SuppressionErasure, false},
+		{"me@example.com", "", false},
+		{"me@", model.SuppressionManual, false},
+		{"localhost", model.SuppressionManual, false},
+		{"-example.com", model.SuppressionManual, false},
+		{"", model.SuppressionManual, false},
+	}
+	for _, test := range tests {
+		t.Run(test.value+" "+string(test.reason), func(t *testing.T) {
+			require.Equal(t, test.valid, model.NewSuppression(test.value, test.reason, nil).IsValid())
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ClickTarget of a tracked link, which is the delivery ID and the URL the link goes to, like 12:https://example.com.
+// It's signed into the tracked link, so the link cannot be changed to record clicks or redirect elsewhere.
+func ClickTarget(deliveryID int, target string) string {
+	return strconv.Itoa(deliveryID) + ":" + target
+}
+
+// ParseClickTarget for the delivery ID and URL, see ClickTarget.
+// Only absolute http and https URLs are accepted.
+func ParseClickTarget(value string) (int, string, bool) {
+	prefix, target, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, "", false
+	}
+	id, err := strconv.Atoi(prefix)
+	if err != nil || id <= 0 {
+		return 0, "", false
+	}
+	if !IsTrackableURL(target) {
+		return 0, "", false
+	}
+	return id, target, true
+}
+
+// IsTrackableURL if the URL is an absolute http or https URL, which can be redirected to.
+func IsTrackableURL(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
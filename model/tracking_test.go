@@ -0,0 +1,36 @@
+package model_test
+
+import (
+	"Goo/model"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseClickTarget(t *testing.T) {
+	tests := map[string]struct {
+		value  string
+		id     int
+		target string
+		ok     bool
+	}{
+		"valid":                 {model.ClickTarget(12, "https://example.com/a?b=c:d"), 12, "https://example.com/a?b=c:d", true},
+		"http":                  {"3:http://example.com", 3, "http://example.com", true},
+		"no separator":          {"12", 0, "", false},
+		"invalid id":            {"abc:https://example.com", 0, "", false},
+		"zero id":               {"0:https://example.com", 0, "", false},
+		"relative url":          {"12:/newsletter", 0, "", false},
+		"protocol-relative url": {"12://example.com", 0, "", false},
+		"javascript url":        {"12:javascript:alert(1)", 0, "", false},
+		"mailto url":            {"12:mailto:me@example.com", 0, "", false},
+		"url without host":      {"12:https:///path", 0, "", false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			id, target, ok := model.ParseClickTarget(test.value)
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.id, id)
+			require.Equal(t, test.target, target)
+		})
+	}
+}
@@ -8,21 +8,64 @@ import (
 )
 
 func (s *Server) setupRoutes() {
+	s.mux.Use(handlers.RealIP(s.trustedProxies))
 	s.mux.Use(handlers.AddMetrics(s.metrics))
 
 	handlers.Health(s.mux, s.database)
 
-	handlers.FrontPage(s.mux)
-	handlers.NewsletterSignup(s.mux, s.database, s.queue, s.log)
+	handlers.FrontPage(s.mux, s.database, s.emailer, s.log)
+	handlers.NewsletterSignup(s.mux, s.database, s.database, s.database, s.queue, s.log)
 	handlers.NewsletterThanks(s.mux)
-	handlers.NewsletterConfirm(s.mux, s.database, s.queue, s.log)
+	handlers.NewsletterConfirm(s.mux, s.database, s.database, s.database, s.queue, s.log)
 	handlers.NewsletterConfirmed(s.mux)
+	handlers.NewsletterConfirmResend(s.mux, s.database, s.database, s.queue, s.log)
+	handlers.NewsletterExpired(s.mux)
+	handlers.NewsletterUnsubscribe(s.mux, s.database, s.signer, s.log)
+	handlers.NewsletterUnsubscribed(s.mux)
+	handlers.NewsletterPreferences(s.mux, s.database, s.log)
+	handlers.NewsletterArchive(s.mux, s.database, s.emailer, s.log)
+	handlers.NewsletterArchiveFeed(s.mux, s.database, s.emailer, s.baseURL, s.log)
+
+	handlers.TrackOpen(s.mux, s.database, s.signer, s.log)
+	handlers.TrackClick(s.mux, s.database, s.signer, s.log)
 
 	s.mux.Group(func(r chi.Router) {
 		r.Use(middleware.BasicAuth("goo", map[string]string{"admin": s.adminPassword}))
 
 		handlers.MigrateTo(r, s.database)
 		handlers.MigrateUp(r, s.database)
+
+		handlers.CreateList(r, s.database, s.log)
+		handlers.Lists(r, s.database, s.log)
+
+		handlers.Consents(r, s.database, s.log)
+		handlers.SubscriberExport(r, s.database, s.log)
+		handlers.SubscriberErase(r, s.database, s.log)
+
+		handlers.Suppressions(r, s.database, s.log)
+		handlers.AddSuppression(r, s.database, s.log)
+		handlers.DeleteSuppression(r, s.database, s.log)
+		handlers.ImportSuppressions(r, s.database, s.log)
+
+		handlers.CreateSegment(r, s.database, s.log)
+		handlers.Segments(r, s.database, s.log)
+		handlers.DeleteSegment(r, s.database, s.log)
+		handlers.SegmentCount(r, s.database, s.log)
+
+		handlers.CreateCampaign(r, s.database, s.log)
+		handlers.Campaigns(r, s.database, s.log)
+		handlers.Campaign(r, s.database, s.log)
+		handlers.UpdateCampaign(r, s.database, s.log)
+		handlers.DeleteCampaign(r, s.database, s.log)
+		handlers.SendCampaign(r, s.database, s.queue, s.log)
+		handlers.SendCampaignTest(r, s.database, s.queue, s.log)
+		handlers.CampaignPreview(r, s.database, s.database, s.emailer, s.log)
+		handlers.TemplatePreview(r, s.database, s.emailer, s.log)
+		handlers.ScheduleCampaign(r, s.database, s.log)
+		handlers.UnscheduleCampaign(r, s.database, s.log)
+		handlers.PauseCampaign(r, s.database, s.log)
+		handlers.ResumeCampaign(r, s.database, s.queue, s.log)
+		handlers.CancelCampaign(r, s.database, s.log)
 	})
 
 	metricsAuth := middleware.BasicAuth("metrics", map[string]string{"prometheus": s.metricsPassword})
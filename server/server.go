@@ -2,6 +2,7 @@ package server
 
 import (
 	"Goo/messaging"
+	"Goo/signing"
 	"Goo/storage"
 	"context"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"time"
 
@@ -20,24 +22,34 @@ import (
 type Server struct {
 	address         string
 	adminPassword   string
+	baseURL         string
 	database        *storage.Database
+	emailer         *messaging.Emailer
 	log             *zap.Logger
 	metricsPassword string
 	metrics         *prometheus.Registry
 	mux             chi.Router
 	queue           *messaging.Queue
 	server          *http.Server
+	signer          *signing.Signer
+	trustedProxies  []netip.Prefix
 }
 
 type Options struct {
-	AdminPassword   string
+	AdminPassword string
+	// BaseURL the server is reachable at, for absolute links like in the archive feed.
+	BaseURL         string
 	Database        *storage.Database
+	Emailer         *messaging.Emailer
 	Host            string
 	Log             *zap.Logger
 	MetricsPassword string
 	Metrics         *prometheus.Registry
 	Port            int
 	Queue           *messaging.Queue
+	Signer          *signing.Signer
+	// TrustedProxies whose X-Forwarded-For and X-Real-IP headers are used for the client IP, see handlers.RealIP.
+	TrustedProxies []netip.Prefix
 }
 
 func New(opts Options) *Server {
@@ -58,7 +70,9 @@ func New(opts Options) *Server {
 	return &Server{
 		address:         address,
 		adminPassword:   opts.AdminPassword,
+		baseURL:         opts.BaseURL,
 		database:        opts.Database,
+		emailer:         opts.Emailer,
 		log:             opts.Log,
 		metricsPassword: opts.MetricsPassword,
 		metrics:         opts.Metrics,
@@ -72,6 +86,8 @@ func New(opts Options) *Server {
 			WriteTimeout:      5 * time.Second,
 			IdleTimeout:       5 * time.Second,
 		},
+		signer:         opts.Signer,
+		trustedProxies: opts.TrustedProxies,
 	}
 }
 
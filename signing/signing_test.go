@@ -0,0 +1,56 @@
+package signing_test
+
+import (
+	"Goo/signing"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestSigner(t *testing.T) {
+	t.Run("signs a value and verifies it again", func(t *testing.T) {
+		s := signing.NewSigner("secret")
+
+		token := s.Sign(signing.Unsubscribe, "me@example.com")
+		require.NotContains(t, token, "@")
+
+		value, ok := s.Verify(signing.Unsubscribe, token)
+		require.True(t, ok)
+		require.Equal(t, "me@example.com", value)
+	})
+
+	t.Run("rejects tokens signed with another key", func(t *testing.T) {
+		token := signing.NewSigner("other secret").Sign(signing.Unsubscribe, "me@example.com")
+
+		_, ok := signing.NewSigner("secret").Verify(signing.Unsubscribe, token)
+		require.False(t, ok)
+	})
+
+	t.Run("rejects tokens signed for another purpose", func(t *testing.T) {
+		s := signing.NewSigner("secret")
+
+		_, ok := s.Verify(signing.Click, s.Sign(signing.Open, "123"))
+		require.False(t, ok)
+		_, ok = s.Verify(signing.Open, s.Sign(signing.Unsubscribe, "123"))
+		require.False(t, ok)
+	})
+
+	t.Run("rejects tampered and malformed tokens", func(t *testing.T) {
+		s := signing.NewSigner("secret")
+		token := strings.Split(s.Sign(signing.Unsubscribe, "me@example.com"), ".")
+		otherToken := strings.Split(s.Sign(signing.Unsubscribe, "you@example.com"), ".")
+
+		tests := []string{
+			"",
+			"nodot",
+			token[0],
+			otherToken[0] + "." + token[1],
+			token[0] + "." + token[1] + "x",
+			"!!!.???",
+		}
+		for _, test := range tests {
+			_, ok := s.Verify(signing.Unsubscribe, test)
+			require.False(t, ok, test)
+		}
+	})
+}
@@ -0,0 +1,628 @@
+package storage
+
+import (
+	"Goo/model"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// campaignColumns to select into a model.Campaign.
+const campaignColumns = `id, list_id, subject, markdown, html, text, from_address, status, created, updated, sent, send_at, segment_id, local_send_time, disable_open_tracking, disable_click_tracking, ab_test, ab_test_ends, ab_winner, recipients_added`
+
+// CreateCampaign as a draft and return it.
+// Returns model.ErrSegmentNotFound if the campaign segment is not on its list.
+func (d *Database) CreateCampaign(ctx context.Context, c model.Campaign) (model.Campaign, error) {
+	if err := d.checkSegmentExists(ctx, c); err != nil {
+		return c, err
+	}
+	query := `
+	insert into campaigns (list_id, subject, html, text, from_address, segment_id, local_send_time, ab_test, markdown,
+		disable_open_tracking, disable_click_tracking)
+	values ($1, $2, $3, $4, $5, $6, $7, $8::jsonb, $9, $10, $11)
+	returning ` + campaignColumns
+	err := d.DB.GetContext(ctx, &c, query, c.ListID, c.Subject, c.HTML, c.Text, c.From, c.SegmentID, c.LocalSendTime,
+		c.ABTest, c.Markdown, c.DisableOpenTracking, c.DisableClickTracking)
+	return c, err
+}
+
+// GetCampaign with the given ID. Returns nil if there is no such campaign.
+func (d *Database) GetCampaign(ctx context.Context, id int) (*model.Campaign, error) {
+	var c model.Campaign
+	err := d.DB.GetContext(ctx, &c, `select `+campaignColumns+` from campaigns where id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCampaigns, newest first.
+func (d *Database) GetCampaigns(ctx context.Context) ([]model.Campaign, error) {
+	var campaigns []model.Campaign
+	err := d.DB.SelectContext(ctx, &campaigns, `select `+campaignColumns+` from campaigns order by id desc`)
+	return campaigns, err
+}
+
+// GetSentCampaigns on the list, most recently sent first and up to the limit.
+func (d *Database) GetSentCampaigns(ctx context.Context, listID string, limit int) ([]model.Campaign, error) {
+	var campaigns []model.Campaign
+	query := `
+	select ` + campaignColumns + `
+	from campaigns
+	where list_id = $1 and status = 'sent'
+	order by sent desc, id desc
+	limit $2`
+	err := d.DB.SelectContext(ctx, &campaigns, query, listID, limit)
+	return campaigns, err
+}
+
+// UpdateCampaignDraft with the ID of the given campaign, and return it.
+// Returns nil if there is no such campaign, and model.ErrCampaignNotEditable if it's not a draft.
+// Like CreateCampaign, returns model.ErrSegmentNotFound if the campaign segment is not on its list.
+func (d *Database) UpdateCampaignDraft(ctx context.Context, c model.Campaign) (*model.Campaign, error) {
+	if err := d.checkSegmentExists(ctx, c); err != nil {
+		return nil, err
+	}
+	query := `
+	update campaigns
+	set list_id = $2, subject = $3, html = $4, text = $5, from_address = $6, segment_id = $7, local_send_time = $8,
+		ab_test = $9::jsonb, markdown = $10, disable_open_tracking = $11, disable_click_tracking = $12, updated = now()
+	where id = $1 and status = 'draft'
+	returning ` + campaignColumns
+	err := d.DB.GetContext(ctx, &c, query, c.ID, c.ListID, c.Subject, c.HTML, c.Text, c.From, c.SegmentID,
+		c.LocalSendTime, c.ABTest, c.Markdown, c.DisableOpenTracking, c.DisableClickTracking)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, d.checkCampaignExists(ctx, c.ID)
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteCampaignDraft with the given ID. Returns false if there is no such campaign,
+// and model.ErrCampaignNotEditable if it's not a draft.
+func (d *Database) DeleteCampaignDraft(ctx context.Context, id int) (bool, error) {
+	var deletedID int
+	err := d.DB.GetContext(ctx, &deletedID, `delete from campaigns where id = $1 and status = 'draft' returning id`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, d.checkCampaignExists(ctx, id)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// checkCampaignExists after a change to a draft matched nothing, returning model.ErrCampaignNotEditable
+// if the campaign exists, so it can't have been a draft.
+func (d *Database) checkCampaignExists(ctx context.Context, id int) error {
+	var exists bool
+	if err := d.DB.GetContext(ctx, &exists, `select exists (select from campaigns where id = $1)`, id); err != nil {
+		return err
+	}
+	if exists {
+		return model.ErrCampaignNotEditable
+	}
+	return nil
+}
+
+// ScheduleCampaign with the given ID to start sending at the given time, and return it.
+// Drafts and scheduled campaigns can be scheduled, so scheduling again reschedules.
+// Returns nil if there is no such campaign, and model.ErrCampaignNotEditable if it's in another status,
+// which includes scheduled campaigns that have just started sending.
+func (d *Database) ScheduleCampaign(ctx context.Context, id int, sendAt time.Time) (*model.Campaign, error) {
+	var c model.Campaign
+	query := `
+	update campaigns
+	set status = 'scheduled', send_at = $2, updated = now()
+	where id = $1 and status in ('draft', 'scheduled')
+	returning ` + campaignColumns
+	err := d.DB.GetContext(ctx, &c, query, id, sendAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, d.checkCampaignExists(ctx, id)
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UnscheduleCampaign with the given ID, moving it back to a draft, and return it.
+// Returns nil if there is no such campaign, and model.ErrCampaignNotEditable if it's not scheduled.
+func (d *Database) UnscheduleCampaign(ctx context.Context, id int) (*model.Campaign, error) {
+	var c model.Campaign
+	query := `
+	update campaigns
+	set status = 'draft', send_at = null, updated = now()
+	where id = $1 and status = 'scheduled'
+	returning ` + campaignColumns
+	err := d.DB.GetContext(ctx, &c, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, d.checkCampaignExists(ctx, id)
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// StartDueCampaign claims the scheduled campaign that has been due the longest, calls start with it,
+// and moves it to the sending status if start returns no error. Returns false if no campaign is due.
+// The campaign is locked until start returns, and locked campaigns are skipped, so with several
+// instances each due campaign is started by only one of them. If start errors, the campaign stays
+// scheduled and is started again later.
+func (d *Database) StartDueCampaign(ctx context.Context, start func(c model.Campaign) error) (bool, error) {
+	var started bool
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var c model.Campaign
+		query := `
+		select ` + campaignColumns + `
+		from campaigns
+		where status = 'scheduled' and send_at <= now()
+		order by send_at
+		limit 1
+		for update skip locked`
+		if err := tx.GetContext(ctx, &c, query); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		if err := start(c); err != nil {
+			return err
+		}
+
+		query = `update campaigns set status = 'sending', updated = now() where id = $1`
+		if _, err := tx.ExecContext(ctx, query, c.ID); err != nil {
+			return err
+		}
+		started = true
+		return nil
+	})
+	return started, err
+}
+
+// StartSendingCampaign with the given ID if it's a draft or scheduled, and return it.
+// Starting a campaign that is being sent already returns it as well, so sending can be started again after errors.
+// Returns nil if there is no such campaign, and model.ErrCampaignNotEditable if it's in another status.
+func (d *Database) StartSendingCampaign(ctx context.Context, id int) (*model.Campaign, error) {
+	var c model.Campaign
+	query := `
+	update campaigns
+	set status = 'sending', updated = now()
+	where id = $1 and status in ('draft', 'scheduled', 'sending')
+	returning ` + campaignColumns
+	err := d.DB.GetContext(ctx, &c, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, d.checkCampaignExists(ctx, id)
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// FinishSendingCampaign with the given ID, after all recipients have been queued.
+// Campaigns that are paused or cancelled in the meantime are not changed.
+func (d *Database) FinishSendingCampaign(ctx context.Context, id int) error {
+	query := `update campaigns set status = 'sent', sent = coalesce(sent, now()), updated = now() where id = $1 and status = 'sending'`
+	_, err := d.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// inFlightCondition matches campaigns that are being sent, including sent campaigns whose recipients
+// have all been queued, but not all been claimed for sending yet.
+const inFlightCondition = `(status = 'sending' or
+	(status = 'sent' and exists (select from campaign_recipients where campaign_id = campaigns.id and claimed is null)))`
+
+// PauseCampaign with the given ID that is in flight, and return it. Recipients of a paused campaign
+// are not sent to until it's resumed, see ClaimCampaignRecipient.
+// Returns nil if there is no such campaign, and model.ErrCampaignNotEditable if it's not in flight.
+func (d *Database) PauseCampaign(ctx context.Context, id int) (*model.Campaign, error) {
+	return d.changeCampaignStatus(ctx, id, model.CampaignPaused, inFlightCondition)
+}
+
+// ResumeCampaign with the given ID that is paused, moving it back to sending, and return it.
+// Messages for recipients of a paused campaign are dropped, so recipients that were queued but not claimed
+// are marked as not queued again. Sending should be started again afterwards, to queue them
+// and any recipients left, and finish the campaign.
+// Returns nil if there is no such campaign, and model.ErrCampaignNotEditable if it's not paused.
+func (d *Database) ResumeCampaign(ctx context.Context, id int) (*model.Campaign, error) {
+	var c *model.Campaign
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var campaign model.Campaign
+		query := `
+		update campaigns
+		set status = 'sending', updated = now()
+		where id = $1 and status = 'paused'
+		returning ` + campaignColumns
+		if err := tx.GetContext(ctx, &campaign, query, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		c = &campaign
+
+		query = `update campaign_recipients set queued = null where campaign_id = $1 and queued is not null and claimed is null`
+		_, err := tx.ExecContext(ctx, query, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, d.checkCampaignExists(ctx, id)
+	}
+	return c, nil
+}
+
+// CancelCampaign with the given ID that is in flight or paused, and return it.
+// Recipients of a cancelled campaign are skipped, see ClaimCampaignRecipient.
+// Returns nil if there is no such campaign, and model.ErrCampaignNotEditable if it's not in flight or paused.
+func (d *Database) CancelCampaign(ctx context.Context, id int) (*model.Campaign, error) {
+	return d.changeCampaignStatus(ctx, id, model.CampaignCancelled, `(status = 'paused' or `+inFlightCondition+`)`)
+}
+
+// changeCampaignStatus with the given ID to the given status if it matches the condition, and return it.
+func (d *Database) changeCampaignStatus(ctx context.Context, id int, to model.CampaignStatus, condition string) (*model.Campaign, error) {
+	var c model.Campaign
+	query := `
+	update campaigns
+	set status = $2, updated = now()
+	where id = $1 and ` + condition + `
+	returning ` + campaignColumns
+	err := d.DB.GetContext(ctx, &c, query, id, to)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, d.checkCampaignExists(ctx, id)
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// AddCampaignRecipients from the next page of confirmed, unpaused subscribers on the campaign list,
+// ordered by email and starting after the given email. Returns the last email of the page,
+// or the empty string if there are no more subscribers.
+// Subscribers that are recipients already are skipped, so pages can be added again after a crash.
+// If the campaign has a segment, only subscribers in the segment are added.
+func (d *Database) AddCampaignRecipients(ctx context.Context, c model.Campaign, after model.Email, limit int) (model.Email, error) {
+	condition, args := "true", []interface{}{c.ID, c.ListID, after, limit}
+	if c.SegmentID != nil {
+		segment, err := d.GetSegment(ctx, *c.SegmentID)
+		if err != nil {
+			return "", err
+		}
+		if segment == nil {
+			return "", model.ErrSegmentNotFound
+		}
+		condition, args, err = compileSegmentQuery(segment.Query, args...)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var last model.Email
+	query := `
+	with page as (
+		select list_id, email
+		from newsletter_subscribers s
+		where list_id = $2 and state = 'confirmed' and not paused and email > $3 and (` + condition + `)
+		order by email
+		limit $4
+	), inserted as (
+		insert into campaign_recipients (campaign_id, list_id, email)
+		select $1, list_id, email from page
+		on conflict (campaign_id, email) do nothing
+	)
+	select coalesce(max(email), '') from page`
+	err := d.DB.GetContext(ctx, &last, query, args...)
+	return last, err
+}
+
+// FinishAddingCampaignRecipients of the campaign with the given ID, setting when all recipients were added,
+// unless it's set already. After that, no more recipients are added, see AddCampaignRecipients.
+func (d *Database) FinishAddingCampaignRecipients(ctx context.Context, id int) error {
+	query := `
+	update campaigns
+	set recipients_added = coalesce(recipients_added, now()), updated = now()
+	where id = $1`
+	_, err := d.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// GetUnqueuedCampaignRecipients of the campaign, up to the limit.
+// With variantsOnly, only recipients that have been assigned a variant are returned, see AssignCampaignVariants.
+// For campaigns with a local send time, only recipients whose send time has come are returned,
+// see ScheduleCampaignRecipients.
+func (d *Database) GetUnqueuedCampaignRecipients(ctx context.Context, campaignID int, variantsOnly bool, limit int) ([]model.Email, error) {
+	var emails []model.Email
+	query := `
+	select r.email
+	from campaign_recipients r
+		join campaigns c on c.id = r.campaign_id
+	where r.campaign_id = $1 and r.queued is null and (not $2 or r.variant != '')
+		and (r.send_at <= now() or (r.send_at is null and c.local_send_time = ''))
+	order by r.email
+	limit $3`
+	err := d.DB.SelectContext(ctx, &emails, query, campaignID, variantsOnly, limit)
+	return emails, err
+}
+
+// GetCampaignRecipientTimezones of the unqueued recipients of the campaign that have no send time yet.
+func (d *Database) GetCampaignRecipientTimezones(ctx context.Context, campaignID int) ([]string, error) {
+	var timezones []string
+	query := `
+	select distinct s.timezone
+	from campaign_recipients r
+		join newsletter_subscribers s on s.list_id = r.list_id and s.email = r.email
+	where r.campaign_id = $1 and r.queued is null and r.send_at is null
+	order by s.timezone`
+	err := d.DB.SelectContext(ctx, &timezones, query, campaignID)
+	return timezones, err
+}
+
+// ScheduleCampaignRecipients of the campaign in the given timezone that have no send time yet to be sent at sendAt.
+func (d *Database) ScheduleCampaignRecipients(ctx context.Context, campaignID int, timezone string, sendAt time.Time) error {
+	query := `
+	update campaign_recipients r
+	set send_at = $3
+	from newsletter_subscribers s
+	where r.campaign_id = $1 and r.queued is null and r.send_at is null
+		and s.list_id = r.list_id and s.email = r.email and s.timezone = $2`
+	_, err := d.DB.ExecContext(ctx, query, campaignID, timezone, sendAt)
+	return err
+}
+
+// HasScheduledCampaignRecipients if the campaign has unqueued recipients whose send time has not come yet.
+func (d *Database) HasScheduledCampaignRecipients(ctx context.Context, campaignID int) (bool, error) {
+	var scheduled bool
+	query := `
+	select exists (
+		select from campaign_recipients where campaign_id = $1 and queued is null and send_at > now()
+	)`
+	err := d.DB.GetContext(ctx, &scheduled, query, campaignID)
+	return scheduled, err
+}
+
+// GetCampaignsWithDueRecipients, which are campaigns being sent with unqueued recipients whose send time has come.
+func (d *Database) GetCampaignsWithDueRecipients(ctx context.Context) ([]int, error) {
+	var ids []int
+	query := `
+	select distinct c.id
+	from campaigns c
+		join campaign_recipients r on r.campaign_id = c.id
+	where c.status = 'sending' and r.queued is null and r.send_at <= now()
+	order by c.id`
+	err := d.DB.SelectContext(ctx, &ids, query)
+	return ids, err
+}
+
+// AssignCampaignVariants of the campaign A/B test to its recipients. Before there is a winner, a random sample
+// of the recipients is assigned the variants in turn, once. After, all recipients left get the winner.
+func (d *Database) AssignCampaignVariants(ctx context.Context, c model.Campaign) error {
+	if c.ABTest == nil {
+		return nil
+	}
+
+	return d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		// Lock the campaign, so the sample is only assigned once, even by jobs running at the same time
+		if _, err := tx.ExecContext(ctx, `select from campaigns where id = $1 for update`, c.ID); err != nil {
+			return err
+		}
+
+		if c.ABWinner != "" {
+			query := `update campaign_recipients set variant = $2 where campaign_id = $1 and variant = ''`
+			_, err := tx.ExecContext(ctx, query, c.ID, c.ABWinner)
+			return err
+		}
+
+		query := `
+		with ranked as (
+			select email, row_number() over (order by random()) as n, count(*) over () as total
+			from campaign_recipients
+			where campaign_id = $1
+		)
+		update campaign_recipients r
+		set variant = ($3::text[])[((ranked.n - 1) % cardinality($3::text[]))::int + 1]
+		from ranked
+		where r.campaign_id = $1 and r.email = ranked.email and ranked.n <= ceil(ranked.total * $2::int / 100.0)
+			and not exists (select from campaign_recipients where campaign_id = $1 and variant != '')`
+		_, err := tx.ExecContext(ctx, query, c.ID, c.ABTest.SamplePercent, c.ABTest.VariantNames())
+		return err
+	})
+}
+
+// StartABTestWait of the campaign with the given ID after its A/B test sample has been queued,
+// setting when the winner is picked, unless it's set already.
+func (d *Database) StartABTestWait(ctx context.Context, id int, wait time.Duration) error {
+	query := `
+	update campaigns
+	set ab_test_ends = coalesce(ab_test_ends, now() + make_interval(secs => $2)), updated = now()
+	where id = $1`
+	_, err := d.DB.ExecContext(ctx, query, id, wait.Seconds())
+	return err
+}
+
+// PickDueABTestWinner of the campaign being sent whose A/B test wait ended the longest ago, calls start with it,
+// and keeps the winner if start returns no error. Returns false if no A/B test is due.
+// The winner is the variant with the most opens or clicks in the sample, depending on the test metric,
+// as recorded by RecordDeliveryOpen and RecordDeliveryClick. Ties go to the variant that comes first in the test,
+// so with no opens or clicks at all, or no sample deliveries, the first variant wins.
+// Like StartDueCampaign, campaigns are locked, so each winner is picked by only one instance.
+func (d *Database) PickDueABTestWinner(ctx context.Context, start func(c model.Campaign) error) (bool, error) {
+	var picked bool
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var c model.Campaign
+		query := `
+		select ` + campaignColumns + `
+		from campaigns
+		where status = 'sending' and ab_winner = '' and ab_test_ends <= now()
+		order by ab_test_ends
+		limit 1
+		for update skip locked`
+		if err := tx.GetContext(ctx, &c, query); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		if c.ABTest == nil {
+			return errors.New("campaign has no A/B test")
+		}
+
+		count := "count(opened)"
+		if c.ABTest.Metric == model.ABTestClicks {
+			count = "count(clicked)"
+		}
+		query = `
+		select variant
+		from deliveries
+		where campaign_id = $1 and variant != ''
+		group by variant
+		order by ` + count + ` desc, array_position($2::text[], variant)
+		limit 1`
+		if err := tx.GetContext(ctx, &c.ABWinner, query, c.ID, c.ABTest.VariantNames()); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			c.ABWinner = c.ABTest.Variants[0].Name
+		}
+
+		if err := start(c); err != nil {
+			return err
+		}
+
+		query = `update campaigns set ab_winner = $2, updated = now() where id = $1`
+		if _, err := tx.ExecContext(ctx, query, c.ID, c.ABWinner); err != nil {
+			return err
+		}
+		picked = true
+		return nil
+	})
+	return picked, err
+}
+
+// MarkCampaignRecipientsQueued after a message has been queued for each of them, creating their queued deliveries.
+func (d *Database) MarkCampaignRecipientsQueued(ctx context.Context, campaignID int, emails []model.Email) error {
+	addresses := make([]string, len(emails))
+	for i, email := range emails {
+		addresses[i] = email.String()
+	}
+	query := `
+	with queued as (
+		update campaign_recipients set queued = now()
+		where campaign_id = $1 and email = any($2::text[])
+		returning campaign_id, list_id, email, variant
+	)
+	insert into deliveries (campaign_id, list_id, email, variant)
+	select campaign_id, list_id, email, variant from queued
+	on conflict (campaign_id, email) where campaign_id is not null do nothing`
+	_, err := d.DB.ExecContext(ctx, query, campaignID, addresses)
+	return err
+}
+
+// ClaimCampaignRecipient before sending the campaign to them, so it's sent at most once.
+// Returns the campaign with the variant assigned to the recipient, and the subscriber to send to, or nil if the recipient has been claimed already.
+// Returns model.ErrCampaignPaused without claiming if the campaign is paused, so it can be claimed after resuming.
+// Returns model.ErrCampaignCancelled if the campaign is cancelled, and nil if the campaign is not being sent
+// for another reason, or the subscriber is not confirmed or has paused email. In those cases the recipient
+// stays claimed, so nothing is sent later either, and the delivery is skipped.
+func (d *Database) ClaimCampaignRecipient(ctx context.Context, campaignID int, email model.Email) (*model.Campaign, *model.Subscriber, error) {
+	var c *model.Campaign
+	var s *model.Subscriber
+	var cancelled bool
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var campaign model.Campaign
+		query := `select ` + campaignColumns + ` from campaigns where id = $1 for share`
+		if err := tx.GetContext(ctx, &campaign, query, campaignID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		if campaign.Status == model.CampaignPaused {
+			return model.ErrCampaignPaused
+		}
+
+		var recipient struct {
+			ListID  string `db:"list_id"`
+			Variant string `db:"variant"`
+		}
+		query = `
+		update campaign_recipients
+		set claimed = now()
+		where campaign_id = $1 and email = $2 and claimed is null
+		returning list_id, variant`
+		if err := tx.GetContext(ctx, &recipient, query, campaignID, email); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		switch campaign.Status {
+		case model.CampaignSending, model.CampaignSent:
+		case model.CampaignCancelled:
+			cancelled = true
+			return skipQueuedDelivery(ctx, tx, campaignID, email, "not sent: campaign is cancelled")
+		default:
+			return skipQueuedDelivery(ctx, tx, campaignID, email, "not sent: campaign is not being sent")
+		}
+
+		var subscriber model.Subscriber
+		query = `
+		select ` + subscriberColumns + `
+		from newsletter_subscribers
+		where list_id = $1 and email = $2 and state = 'confirmed' and not paused`
+		if err := tx.GetContext(ctx, &subscriber, query, recipient.ListID, email); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return skipQueuedDelivery(ctx, tx, campaignID, email, "not sent: subscriber is not confirmed or has paused email")
+			}
+			return err
+		}
+
+		campaign = campaign.ForVariant(recipient.Variant)
+		c = &campaign
+		s = &subscriber
+		return nil
+	})
+	if err == nil && cancelled {
+		err = model.ErrCampaignCancelled
+	}
+	return c, s, err
+}
+
+// skipQueuedDelivery of the campaign to the recipient that will not be sent, with the reason as the SMTP response.
+// Messages are queued before MarkCampaignRecipientsQueued creates the queued delivery, so the delivery
+// may not exist yet. Then the skipped delivery is created, which MarkCampaignRecipientsQueued keeps.
+func skipQueuedDelivery(ctx context.Context, tx *sqlx.Tx, campaignID int, email model.Email, reason string) error {
+	query := `
+	insert into deliveries (campaign_id, list_id, email, variant, state, smtp_response)
+	select campaign_id, list_id, email, variant, 'skipped', $3
+	from campaign_recipients
+	where campaign_id = $1 and email = $2
+	on conflict (campaign_id, email) where campaign_id is not null do update set
+		state = 'skipped',
+		smtp_response = excluded.smtp_response,
+		updated = now()
+	where deliveries.state = 'queued'`
+	_, err := tx.ExecContext(ctx, query, campaignID, email, reason)
+	return err
+}
+
+// ReleaseCampaignRecipient claimed with ClaimCampaignRecipient, so sending can be tried again.
+func (d *Database) ReleaseCampaignRecipient(ctx context.Context, campaignID int, email model.Email) error {
+	query := `update campaign_recipients set claimed = null where campaign_id = $1 and email = $2`
+	_, err := d.DB.ExecContext(ctx, query, campaignID, email)
+	return err
+}
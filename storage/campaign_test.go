@@ -0,0 +1,549 @@
+package storage_test
+
+import (
+	"Goo/integrationtest"
+	"Goo/model"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_CreateCampaign(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("creates, gets, updates and deletes a draft", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", HTML: "<p>Hi</p>", Text: "Hi"})
+		require.NoError(t, err)
+		require.NotZero(t, c.ID)
+		require.Equal(t, model.CampaignDraft, c.Status)
+		require.False(t, c.Created.IsZero())
+		require.Nil(t, c.Sent)
+
+		got, err := db.GetCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, "Hello", got.Subject)
+
+		c.Subject = "Hello again"
+		updated, err := db.UpdateCampaignDraft(context.Background(), c)
+		require.NoError(t, err)
+		require.Equal(t, "Hello again", updated.Subject)
+
+		campaigns, err := db.GetCampaigns(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, len(campaigns))
+
+		deleted, err := db.DeleteCampaignDraft(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.True(t, deleted)
+
+		got, err = db.GetCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Nil(t, got)
+	})
+
+	t.Run("cannot change campaigns that are not drafts", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi"})
+		require.NoError(t, err)
+		_, err = db.DB.Exec(`update campaigns set status = 'sent' where id = $1`, c.ID)
+		require.NoError(t, err)
+
+		updated, err := db.UpdateCampaignDraft(context.Background(), c)
+		require.ErrorIs(t, err, model.ErrCampaignNotEditable)
+		require.Nil(t, updated)
+
+		deleted, err := db.DeleteCampaignDraft(context.Background(), c.ID)
+		require.ErrorIs(t, err, model.ErrCampaignNotEditable)
+		require.False(t, deleted)
+	})
+
+	t.Run("returns nothing for campaigns that do not exist", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		updated, err := db.UpdateCampaignDraft(context.Background(), model.Campaign{ID: 123, ListID: "newsletter", Subject: "Hello"})
+		require.NoError(t, err)
+		require.Nil(t, updated)
+
+		deleted, err := db.DeleteCampaignDraft(context.Background(), 123)
+		require.NoError(t, err)
+		require.False(t, deleted)
+	})
+}
+
+func TestDatabase_GetSentCampaigns(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("gets sent campaigns on the list, most recently sent first", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.CreateList(context.Background(), "golang", "Go")
+		require.NoError(t, err)
+
+		var ids []int
+		for _, listID := range []string{"newsletter", "newsletter", "newsletter", "golang"} {
+			c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: listID, Subject: "Hello", Text: "Hi"})
+			require.NoError(t, err)
+			ids = append(ids, c.ID)
+		}
+		_, err = db.DB.Exec(`update campaigns set status = 'sent', sent = now() - make_interval(days => id) where id != $1`, ids[1])
+		require.NoError(t, err)
+
+		campaigns, err := db.GetSentCampaigns(context.Background(), "newsletter", 10)
+		require.NoError(t, err)
+		require.Equal(t, 2, len(campaigns))
+		require.Equal(t, ids[0], campaigns[0].ID)
+		require.Equal(t, ids[2], campaigns[1].ID)
+
+		campaigns, err = db.GetSentCampaigns(context.Background(), "newsletter", 1)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(campaigns))
+	})
+}
+
+func TestDatabase_ScheduleCampaign(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("schedules, reschedules and unschedules a campaign", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi"})
+		require.NoError(t, err)
+
+		sendAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		scheduled, err := db.ScheduleCampaign(context.Background(), c.ID, sendAt)
+		require.NoError(t, err)
+		require.Equal(t, model.CampaignScheduled, scheduled.Status)
+		require.True(t, sendAt.Equal(*scheduled.SendAt))
+
+		sendAt = sendAt.Add(time.Hour)
+		scheduled, err = db.ScheduleCampaign(context.Background(), c.ID, sendAt)
+		require.NoError(t, err)
+		require.True(t, sendAt.Equal(*scheduled.SendAt))
+
+		_, err = db.UpdateCampaignDraft(context.Background(), c)
+		require.ErrorIs(t, err, model.ErrCampaignNotEditable)
+
+		unscheduled, err := db.UnscheduleCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CampaignDraft, unscheduled.Status)
+		require.Nil(t, unscheduled.SendAt)
+
+		_, err = db.UnscheduleCampaign(context.Background(), c.ID)
+		require.ErrorIs(t, err, model.ErrCampaignNotEditable)
+	})
+
+	t.Run("starts due campaigns once, and leaves them scheduled if starting fails", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		due, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Due", Text: "Hi"})
+		require.NoError(t, err)
+		_, err = db.ScheduleCampaign(context.Background(), due.ID, time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+
+		later, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Later", Text: "Hi"})
+		require.NoError(t, err)
+		_, err = db.ScheduleCampaign(context.Background(), later.ID, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+
+		started, err := db.StartDueCampaign(context.Background(), func(c model.Campaign) error {
+			return errors.New("queue is down")
+		})
+		require.Error(t, err)
+		require.False(t, started)
+
+		c, err := db.GetCampaign(context.Background(), due.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CampaignScheduled, c.Status)
+
+		var startedIDs []int
+		for {
+			started, err := db.StartDueCampaign(context.Background(), func(c model.Campaign) error {
+				startedIDs = append(startedIDs, c.ID)
+				return nil
+			})
+			require.NoError(t, err)
+			if !started {
+				break
+			}
+		}
+		require.Equal(t, []int{due.ID}, startedIDs)
+
+		c, err = db.GetCampaign(context.Background(), due.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CampaignSending, c.Status)
+
+		_, err = db.ScheduleCampaign(context.Background(), due.ID, time.Now().Add(time.Hour))
+		require.ErrorIs(t, err, model.ErrCampaignNotEditable)
+	})
+}
+
+func TestDatabase_AddCampaignRecipients(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("adds confirmed subscribers in pages, queues and claims them once", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		for _, email := range []model.Email{"a@example.com", "b@example.com", "c@example.com", "d@example.com"} {
+			token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: email})
+			require.NoError(t, err)
+			if email != "d@example.com" {
+				_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+				require.NoError(t, err)
+			}
+		}
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi"})
+		require.NoError(t, err)
+		started, err := db.StartSendingCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CampaignSending, started.Status)
+
+		last, err := db.AddCampaignRecipients(context.Background(), c, "", 2)
+		require.NoError(t, err)
+		require.Equal(t, model.Email("b@example.com"), last)
+		// Adding the same page again is fine
+		last, err = db.AddCampaignRecipients(context.Background(), c, "", 2)
+		require.NoError(t, err)
+		require.Equal(t, model.Email("b@example.com"), last)
+		last, err = db.AddCampaignRecipients(context.Background(), c, last, 2)
+		require.NoError(t, err)
+		require.Equal(t, model.Email("c@example.com"), last)
+		last, err = db.AddCampaignRecipients(context.Background(), c, last, 2)
+		require.NoError(t, err)
+		require.Equal(t, model.Email(""), last)
+
+		emails, err := db.GetUnqueuedCampaignRecipients(context.Background(), c.ID, false, 10)
+		require.NoError(t, err)
+		require.Equal(t, []model.Email{"a@example.com", "b@example.com", "c@example.com"}, emails)
+
+		err = db.MarkCampaignRecipientsQueued(context.Background(), c.ID, emails[:2])
+		require.NoError(t, err)
+		emails, err = db.GetUnqueuedCampaignRecipients(context.Background(), c.ID, false, 10)
+		require.NoError(t, err)
+		require.Equal(t, []model.Email{"c@example.com"}, emails)
+
+		campaign, subscriber, err := db.ClaimCampaignRecipient(context.Background(), c.ID, "a@example.com")
+		require.NoError(t, err)
+		require.Equal(t, c.ID, campaign.ID)
+		require.Equal(t, model.Email("a@example.com"), subscriber.Email)
+
+		campaign, subscriber, err = db.ClaimCampaignRecipient(context.Background(), c.ID, "a@example.com")
+		require.NoError(t, err)
+		require.Nil(t, campaign)
+		require.Nil(t, subscriber)
+
+		err = db.ReleaseCampaignRecipient(context.Background(), c.ID, "a@example.com")
+		require.NoError(t, err)
+		campaign, _, err = db.ClaimCampaignRecipient(context.Background(), c.ID, "a@example.com")
+		require.NoError(t, err)
+		require.NotNil(t, campaign)
+
+		err = db.UnsubscribeFromNewsletter(context.Background(), "newsletter", "b@example.com")
+		require.NoError(t, err)
+		campaign, _, err = db.ClaimCampaignRecipient(context.Background(), c.ID, "b@example.com")
+		require.NoError(t, err)
+		require.Nil(t, campaign)
+
+		err = db.FinishSendingCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		finished, err := db.GetCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CampaignSent, finished.Status)
+		require.NotNil(t, finished.Sent)
+
+		_, err = db.StartSendingCampaign(context.Background(), c.ID)
+		require.ErrorIs(t, err, model.ErrCampaignNotEditable)
+	})
+}
+
+func TestDatabase_FinishAddingCampaignRecipients(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("sets when recipients were added, once", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi"})
+		require.NoError(t, err)
+		require.Nil(t, c.RecipientsAdded)
+
+		err = db.FinishAddingCampaignRecipients(context.Background(), c.ID)
+		require.NoError(t, err)
+		added, err := db.GetCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.NotNil(t, added.RecipientsAdded)
+
+		err = db.FinishAddingCampaignRecipients(context.Background(), c.ID)
+		require.NoError(t, err)
+		again, err := db.GetCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, added.RecipientsAdded, again.RecipientsAdded)
+	})
+}
+
+func TestDatabase_PauseCampaign(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("pauses, resumes and cancels a campaign in flight, checked when claiming recipients", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		for _, email := range []model.Email{"a@example.com", "b@example.com"} {
+			token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: email})
+			require.NoError(t, err)
+			_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+			require.NoError(t, err)
+		}
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi"})
+		require.NoError(t, err)
+
+		_, err = db.PauseCampaign(context.Background(), c.ID)
+		require.ErrorIs(t, err, model.ErrCampaignNotEditable)
+
+		_, err = db.StartSendingCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		_, err = db.AddCampaignRecipients(context.Background(), c, "", 10)
+		require.NoError(t, err)
+		err = db.MarkCampaignRecipientsQueued(context.Background(), c.ID, []model.Email{"a@example.com", "b@example.com"})
+		require.NoError(t, err)
+		err = db.FinishSendingCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+
+		// Sent, but recipients have not been claimed yet, so it's still in flight
+		paused, err := db.PauseCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CampaignPaused, paused.Status)
+
+		_, _, err = db.ClaimCampaignRecipient(context.Background(), c.ID, "a@example.com")
+		require.ErrorIs(t, err, model.ErrCampaignPaused)
+
+		resumed, err := db.ResumeCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CampaignSending, resumed.Status)
+
+		// The messages of the recipients may have been dropped while paused, so they are queued again
+		emails, err := db.GetUnqueuedCampaignRecipients(context.Background(), c.ID, false, 10)
+		require.NoError(t, err)
+		require.Equal(t, []model.Email{"a@example.com", "b@example.com"}, emails)
+		err = db.MarkCampaignRecipientsQueued(context.Background(), c.ID, emails)
+		require.NoError(t, err)
+
+		campaign, _, err := db.ClaimCampaignRecipient(context.Background(), c.ID, "a@example.com")
+		require.NoError(t, err)
+		require.NotNil(t, campaign)
+
+		cancelled, err := db.CancelCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.CampaignCancelled, cancelled.Status)
+
+		_, _, err = db.ClaimCampaignRecipient(context.Background(), c.ID, "b@example.com")
+		require.ErrorIs(t, err, model.ErrCampaignCancelled)
+
+		deliveries, err := db.GetDeliveries(context.Background(), "b@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(deliveries))
+		require.Equal(t, model.DeliverySkipped, deliveries[0].State)
+		require.Equal(t, "not sent: campaign is cancelled", deliveries[0].SMTPResponse)
+
+		// Claimed already, so it's not skipped again
+		campaign, _, err = db.ClaimCampaignRecipient(context.Background(), c.ID, "b@example.com")
+		require.NoError(t, err)
+		require.Nil(t, campaign)
+
+		_, err = db.ResumeCampaign(context.Background(), c.ID)
+		require.ErrorIs(t, err, model.ErrCampaignNotEditable)
+	})
+
+	t.Run("skips recipients claimed before their queued delivery is created", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "a@example.com"})
+		require.NoError(t, err)
+		_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi"})
+		require.NoError(t, err)
+		_, err = db.StartSendingCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		_, err = db.AddCampaignRecipients(context.Background(), c, "", 10)
+		require.NoError(t, err)
+		_, err = db.CancelCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+
+		// The message was queued, but the recipient not marked as queued yet
+		_, _, err = db.ClaimCampaignRecipient(context.Background(), c.ID, "a@example.com")
+		require.ErrorIs(t, err, model.ErrCampaignCancelled)
+		err = db.MarkCampaignRecipientsQueued(context.Background(), c.ID, []model.Email{"a@example.com"})
+		require.NoError(t, err)
+
+		deliveries, err := db.GetDeliveries(context.Background(), "a@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(deliveries))
+		require.Equal(t, model.DeliverySkipped, deliveries[0].State)
+		require.Equal(t, "not sent: campaign is cancelled", deliveries[0].SMTPResponse)
+	})
+}
+
+func TestDatabase_AssignCampaignVariants(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("assigns variants to a sample once, picks the winner by opens, and assigns it to the rest", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		for _, email := range []model.Email{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+			token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: email})
+			require.NoError(t, err)
+			_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+			require.NoError(t, err)
+		}
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi",
+			ABTest: &model.ABTest{
+				Variants:      []model.CampaignVariant{{Name: "a", Subject: "Hi"}, {Name: "b", Subject: "Hey"}},
+				SamplePercent: 40,
+				WaitMinutes:   60,
+				Metric:        model.ABTestOpens,
+			},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, c.ABTest)
+		_, err = db.StartSendingCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		_, err = db.AddCampaignRecipients(context.Background(), c, "", 10)
+		require.NoError(t, err)
+
+		err = db.AssignCampaignVariants(context.Background(), c)
+		require.NoError(t, err)
+		// Assigning again does not change the sample
+		err = db.AssignCampaignVariants(context.Background(), c)
+		require.NoError(t, err)
+
+		sample, err := db.GetUnqueuedCampaignRecipients(context.Background(), c.ID, true, 10)
+		require.NoError(t, err)
+		require.Equal(t, 2, len(sample))
+		err = db.MarkCampaignRecipientsQueued(context.Background(), c.ID, sample)
+		require.NoError(t, err)
+
+		err = db.StartABTestWait(context.Background(), c.ID, time.Hour)
+		require.NoError(t, err)
+		picked, err := db.PickDueABTestWinner(context.Background(), func(model.Campaign) error { return nil })
+		require.NoError(t, err)
+		require.False(t, picked)
+
+		var opened struct {
+			ID    int    `db:"id"`
+			Email string `db:"email"`
+		}
+		err = db.DB.Get(&opened, `select id, email from deliveries where campaign_id = $1 and variant = 'b'`, c.ID)
+		require.NoError(t, err)
+		recorded, err := db.RecordDeliveryOpen(context.Background(), opened.ID)
+		require.NoError(t, err)
+		require.True(t, recorded)
+		_, err = db.DB.Exec(`update campaigns set ab_test_ends = now() - interval '1 minute' where id = $1`, c.ID)
+		require.NoError(t, err)
+
+		picked, err = db.PickDueABTestWinner(context.Background(), func(c model.Campaign) error {
+			require.Equal(t, "b", c.ABWinner)
+			return nil
+		})
+		require.NoError(t, err)
+		require.True(t, picked)
+
+		withWinner, err := db.GetCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, "b", withWinner.ABWinner)
+
+		err = db.AssignCampaignVariants(context.Background(), *withWinner)
+		require.NoError(t, err)
+		rest, err := db.GetUnqueuedCampaignRecipients(context.Background(), c.ID, true, 10)
+		require.NoError(t, err)
+		require.Equal(t, 3, len(rest))
+
+		campaign, _, err := db.ClaimCampaignRecipient(context.Background(), c.ID, rest[0])
+		require.NoError(t, err)
+		require.Equal(t, "Hey", campaign.Subject)
+		campaign, _, err = db.ClaimCampaignRecipient(context.Background(), c.ID, model.Email(opened.Email))
+		require.NoError(t, err)
+		require.Equal(t, "Hey", campaign.Subject)
+	})
+}
+
+func TestDatabase_ScheduleCampaignRecipients(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("schedules recipients by timezone and only returns those whose time has come", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		for email, timezone := range map[model.Email]string{"a@example.com": "Europe/Copenhagen", "b@example.com": ""} {
+			token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: email, Timezone: timezone})
+			require.NoError(t, err)
+			_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+			require.NoError(t, err)
+		}
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi", LocalSendTime: "09:00"})
+		require.NoError(t, err)
+		require.Equal(t, "09:00", c.LocalSendTime)
+		_, err = db.StartSendingCampaign(context.Background(), c.ID)
+		require.NoError(t, err)
+		_, err = db.AddCampaignRecipients(context.Background(), c, "", 10)
+		require.NoError(t, err)
+
+		// Not scheduled yet, so not returned
+		emails, err := db.GetUnqueuedCampaignRecipients(context.Background(), c.ID, false, 10)
+		require.NoError(t, err)
+		require.Empty(t, emails)
+
+		timezones, err := db.GetCampaignRecipientTimezones(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{"", "Europe/Copenhagen"}, timezones)
+
+		err = db.ScheduleCampaignRecipients(context.Background(), c.ID, "Europe/Copenhagen", time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		err = db.ScheduleCampaignRecipients(context.Background(), c.ID, "", time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		// Scheduling again does not change the send time
+		err = db.ScheduleCampaignRecipients(context.Background(), c.ID, "", time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+
+		timezones, err = db.GetCampaignRecipientTimezones(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.Empty(t, timezones)
+
+		emails, err = db.GetUnqueuedCampaignRecipients(context.Background(), c.ID, false, 10)
+		require.NoError(t, err)
+		require.Equal(t, []model.Email{"a@example.com"}, emails)
+
+		ids, err := db.GetCampaignsWithDueRecipients(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, []int{c.ID}, ids)
+
+		err = db.MarkCampaignRecipientsQueued(context.Background(), c.ID, emails)
+		require.NoError(t, err)
+		ids, err = db.GetCampaignsWithDueRecipients(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, ids)
+
+		scheduled, err := db.HasScheduledCampaignRecipients(context.Background(), c.ID)
+		require.NoError(t, err)
+		require.True(t, scheduled)
+	})
+}
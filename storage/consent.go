@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"Goo/model"
+	"context"
+)
+
+// RecordConsent given by a subscriber. The timestamp is set by the database.
+func (d *Database) RecordConsent(ctx context.Context, c model.Consent) error {
+	query := `
+	insert into consents (list_id, email, action, ip, user_agent, form_url, text_version)
+	values ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := d.DB.ExecContext(ctx, query, c.ListID, c.Email, c.Action, c.IP, c.UserAgent, c.FormURL, c.TextVersion)
+	return err
+}
+
+// GetConsents for the email in any case on all lists, oldest first.
+func (d *Database) GetConsents(ctx context.Context, email model.Email) ([]model.Consent, error) {
+	var consents []model.Consent
+	query := `
+	select list_id, email, action, ip, user_agent, form_url, text_version, created
+	from consents
+	where lower(email) = lower($1)
+	order by id`
+	err := d.DB.SelectContext(ctx, &consents, query, email)
+	return consents, err
+}
@@ -0,0 +1,61 @@
+package storage_test
+
+import (
+	"Goo/integrationtest"
+	"Goo/model"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_RecordConsent(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("records consents and gets them for the email on all lists", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.CreateList(context.Background(), "golang", "Go")
+		require.NoError(t, err)
+
+		for _, listID := range []string{"newsletter", "golang"} {
+			_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: listID, Email: "me@example.com"})
+			require.NoError(t, err)
+			err = db.RecordConsent(context.Background(), model.Consent{
+				ListID:      listID,
+				Email:       "me@example.com",
+				Action:      model.ConsentSignup,
+				IP:          "192.0.2.1",
+				UserAgent:   "Mozilla/5.0",
+				FormURL:     "https://example.com/",
+				TextVersion: model.ConsentTextVersion,
+			})
+			require.NoError(t, err)
+		}
+
+		consents, err := db.GetConsents(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 2, len(consents))
+		require.Equal(t, "newsletter", consents[0].ListID)
+		require.Equal(t, "golang", consents[1].ListID)
+		require.Equal(t, model.ConsentSignup, consents[0].Action)
+		require.Equal(t, "192.0.2.1", consents[0].IP)
+		require.Equal(t, "Mozilla/5.0", consents[0].UserAgent)
+		require.Equal(t, "https://example.com/", consents[0].FormURL)
+		require.Equal(t, model.ConsentTextVersion, consents[0].TextVersion)
+		require.False(t, consents[0].Created.IsZero())
+
+		consents, err = db.GetConsents(context.Background(), "you@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 0, len(consents))
+	})
+
+	t.Run("cannot record consent for someone who is not signed up", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.RecordConsent(context.Background(), model.Consent{ListID: "newsletter", Email: "me@example.com", Action: model.ConsentSignup})
+		require.Error(t, err)
+	})
+}
@@ -18,18 +18,21 @@ import (
 )
 
 type Database struct {
-	DB                    *sqlx.DB
-	host                  string
-	port                  int
-	user                  string
-	password              string
-	name                  string
-	maxOpenConnections    int
-	maxIdleConnections    int
-	connectionMaxLifetime time.Duration
-	connectionMaxIdleTime time.Duration
-	log                   *zap.Logger
-	metrics               *prometheus.Registry
+	DB                         *sqlx.DB
+	confirmationResendInterval time.Duration
+	confirmationTokenTTL       time.Duration
+	emailHashSalt              []byte
+	host                       string
+	port                       int
+	user                       string
+	password                   string
+	name                       string
+	maxOpenConnections         int
+	maxIdleConnections         int
+	connectionMaxLifetime      time.Duration
+	connectionMaxIdleTime      time.Duration
+	log                        *zap.Logger
+	metrics                    *prometheus.Registry
 }
 
 type NewDatabaseOptions struct {
@@ -44,6 +47,13 @@ type NewDatabaseOptions struct {
 	ConnectionMaxIdleTime time.Duration
 	Log                   *zap.Logger
 	Metrics               *prometheus.Registry
+	// ConfirmationResendInterval is the minimum time between confirmation tokens for one address. Defaults to 5 minutes.
+	ConfirmationResendInterval time.Duration
+	// ConfirmationTokenTTL is how long a confirmation token can be used. Defaults to 48 hours.
+	ConfirmationTokenTTL time.Duration
+	// EmailHashSalt is the secret salt for hashes of erased email addresses.
+	// It must not change, or erased addresses are not recognized anymore.
+	EmailHashSalt string
 }
 
 func NewDatabase(opts NewDatabaseOptions) *Database {
@@ -53,18 +63,27 @@ func NewDatabase(opts NewDatabaseOptions) *Database {
 	if opts.Metrics == nil {
 		opts.Metrics = prometheus.NewRegistry()
 	}
+	if opts.ConfirmationResendInterval == 0 {
+		opts.ConfirmationResendInterval = 5 * time.Minute
+	}
+	if opts.ConfirmationTokenTTL == 0 {
+		opts.ConfirmationTokenTTL = 48 * time.Hour
+	}
 	return &Database{
-		host:                  opts.Host,
-		port:                  opts.Port,
-		user:                  opts.User,
-		password:              opts.Password,
-		name:                  opts.Name,
-		maxOpenConnections:    opts.MaxOpenConnections,
-		maxIdleConnections:    opts.MaxIdleConnections,
-		connectionMaxIdleTime: opts.ConnectionMaxIdleTime,
-		connectionMaxLifetime: opts.ConnectionMaxLifetime,
-		log:                   opts.Log,
-		metrics:               opts.Metrics,
+		confirmationResendInterval: opts.ConfirmationResendInterval,
+		confirmationTokenTTL:       opts.ConfirmationTokenTTL,
+		emailHashSalt:              []byte(opts.EmailHashSalt),
+		host:                       opts.Host,
+		port:                       opts.Port,
+		user:                       opts.User,
+		password:                   opts.Password,
+		name:                       opts.Name,
+		maxOpenConnections:         opts.MaxOpenConnections,
+		maxIdleConnections:         opts.MaxIdleConnections,
+		connectionMaxIdleTime:      opts.ConnectionMaxIdleTime,
+		connectionMaxLifetime:      opts.ConnectionMaxLifetime,
+		log:                        opts.Log,
+		metrics:                    opts.Metrics,
 	}
 }
 
@@ -115,6 +134,19 @@ func (d *Database) Ping(ctx context.Context) error {
 	return err
 }
 
+// inTransaction runs fn in a transaction, which is committed if fn returns no error and rolled back otherwise.
+func (d *Database) inTransaction(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := d.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 //go:embed migrations
 var migrations embed.FS
 
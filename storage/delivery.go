@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"Goo/model"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// deliveryColumns to select into a model.Delivery.
+const deliveryColumns = `id, template, campaign_id, list_id, email, state, smtp_response, attempts, created, updated, sent, variant, opened, clicked`
+
+// CreateDelivery in the queued state, before queueing a message for it. Returns the ID.
+func (d *Database) CreateDelivery(ctx context.Context, delivery model.Delivery) (int, error) {
+	var id int
+	query := `
+	insert into deliveries (template, campaign_id, list_id, email)
+	values ($1, $2, $3, $4)
+	returning id`
+	err := d.DB.GetContext(ctx, &id, query, delivery.Template, delivery.CampaignID, delivery.ListID, delivery.Email)
+	return id, err
+}
+
+// StartDelivery right before sending, moving it to the sending state and counting the attempt. Returns the ID.
+// Deliveries without an ID are created, except for campaign deliveries, which are found by campaign and email.
+// Created campaign deliveries get the variant assigned to the recipient.
+func (d *Database) StartDelivery(ctx context.Context, delivery model.Delivery) (int, error) {
+	var id int
+	if delivery.ID != 0 {
+		query := `
+		update deliveries
+		set state = 'sending', attempts = attempts + 1, updated = now()
+		where id = $1
+		returning id`
+		err := d.DB.GetContext(ctx, &id, query, delivery.ID)
+		if err == nil || !errors.Is(err, sql.ErrNoRows) {
+			return id, err
+		}
+	}
+
+	query := `
+	insert into deliveries (template, campaign_id, list_id, email, state, attempts, variant)
+	values ($1, $2, $3, $4, 'sending', 1,
+		coalesce((select variant from campaign_recipients where campaign_id = $2 and email = $4), ''))
+	on conflict (campaign_id, email) where campaign_id is not null do update set
+		state = 'sending',
+		attempts = deliveries.attempts + 1,
+		updated = now()
+	returning id`
+	err := d.DB.GetContext(ctx, &id, query, delivery.Template, delivery.CampaignID, delivery.ListID, delivery.Email)
+	return id, err
+}
+
+// FinishDelivery after sending, moving it to the sent state, or to the failed state with the error as the SMTP response.
+// Deliveries to suppressed recipients are moved to the skipped state instead.
+func (d *Database) FinishDelivery(ctx context.Context, id int, sendErr error) error {
+	if sendErr != nil {
+		state := model.DeliveryFailed
+		if errors.Is(sendErr, model.ErrSuppressed) {
+			state = model.DeliverySkipped
+		}
+		query := `update deliveries set state = $2, smtp_response = $3, updated = now() where id = $1`
+		_, err := d.DB.ExecContext(ctx, query, id, state, sendErr.Error())
+		return err
+	}
+	query := `update deliveries set state = 'sent', smtp_response = '', sent = now(), updated = now() where id = $1`
+	_, err := d.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// GetDeliveries to the email in any case on all lists, oldest first.
+func (d *Database) GetDeliveries(ctx context.Context, email model.Email) ([]model.Delivery, error) {
+	var deliveries []model.Delivery
+	query := `select ` + deliveryColumns + ` from deliveries where lower(email) = lower($1) order by id`
+	err := d.DB.SelectContext(ctx, &deliveries, query, email)
+	return deliveries, err
+}
+
+// RecordDeliveryOpen of the delivery with the given ID. Only the first open is recorded, so opens are counted
+// once per delivery. Returns false if there is no such delivery.
+func (d *Database) RecordDeliveryOpen(ctx context.Context, id int) (bool, error) {
+	query := `update deliveries set opened = coalesce(opened, now()), updated = now() where id = $1`
+	res, err := d.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows > 0, err
+}
+
+// RecordDeliveryClick of the delivery with the given ID. Only the first click is recorded, so clicks are counted
+// once per delivery. A click also records an open, as the email was opened even if its images were not loaded.
+// Returns false if there is no such delivery.
+func (d *Database) RecordDeliveryClick(ctx context.Context, id int) (bool, error) {
+	query := `update deliveries set clicked = coalesce(clicked, now()), opened = coalesce(opened, now()), updated = now()
+	where id = $1`
+	res, err := d.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,176 @@
+package storage_test
+
+import (
+	"Goo/integrationtest"
+	"Goo/model"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_StartDelivery(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("moves a queued delivery through sending to sent, counting attempts", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		delivery := model.Delivery{Template: "confirmation_email", ListID: "newsletter", Email: "me@example.com"}
+		id, err := db.CreateDelivery(context.Background(), delivery)
+		require.NoError(t, err)
+
+		deliveries, err := db.GetDeliveries(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(deliveries))
+		require.Equal(t, model.DeliveryQueued, deliveries[0].State)
+		require.Equal(t, 0, deliveries[0].Attempts)
+
+		delivery.ID = id
+		startedID, err := db.StartDelivery(context.Background(), delivery)
+		require.NoError(t, err)
+		require.Equal(t, id, startedID)
+		err = db.FinishDelivery(context.Background(), id, errors.New("421 try again later"))
+		require.NoError(t, err)
+
+		deliveries, err = db.GetDeliveries(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, model.DeliveryFailed, deliveries[0].State)
+		require.Equal(t, "421 try again later", deliveries[0].SMTPResponse)
+		require.Nil(t, deliveries[0].Sent)
+
+		_, err = db.StartDelivery(context.Background(), delivery)
+		require.NoError(t, err)
+		err = db.FinishDelivery(context.Background(), id, nil)
+		require.NoError(t, err)
+
+		deliveries, err = db.GetDeliveries(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(deliveries))
+		require.Equal(t, "confirmation_email", deliveries[0].Template)
+		require.Equal(t, model.DeliverySent, deliveries[0].State)
+		require.Equal(t, "", deliveries[0].SMTPResponse)
+		require.Equal(t, 2, deliveries[0].Attempts)
+		require.NotNil(t, deliveries[0].Sent)
+	})
+
+	t.Run("creates a delivery without an ID", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		id, err := db.StartDelivery(context.Background(), model.Delivery{Template: "welcome_email", ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		require.NotEqual(t, 0, id)
+
+		deliveries, err := db.GetDeliveries(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(deliveries))
+		require.Equal(t, model.DeliverySending, deliveries[0].State)
+		require.Equal(t, 1, deliveries[0].Attempts)
+	})
+
+	t.Run("finds campaign deliveries by campaign and email", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hi", Text: "Hi"})
+		require.NoError(t, err)
+
+		delivery := model.Delivery{CampaignID: &c.ID, ListID: "newsletter", Email: "me@example.com"}
+		firstID, err := db.StartDelivery(context.Background(), delivery)
+		require.NoError(t, err)
+		secondID, err := db.StartDelivery(context.Background(), delivery)
+		require.NoError(t, err)
+		require.Equal(t, firstID, secondID)
+
+		deliveries, err := db.GetDeliveries(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(deliveries))
+		require.Equal(t, c.ID, *deliveries[0].CampaignID)
+		require.Equal(t, 2, deliveries[0].Attempts)
+	})
+}
+
+func TestDatabase_RecordDeliveryOpen(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("records only the first open", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		id, err := db.CreateDelivery(context.Background(), model.Delivery{Template: "welcome_email", ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		recorded, err := db.RecordDeliveryOpen(context.Background(), id)
+		require.NoError(t, err)
+		require.True(t, recorded)
+		deliveries, err := db.GetDeliveries(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.NotNil(t, deliveries[0].Opened)
+		opened := *deliveries[0].Opened
+
+		_, err = db.RecordDeliveryOpen(context.Background(), id)
+		require.NoError(t, err)
+		deliveries, err = db.GetDeliveries(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, opened, *deliveries[0].Opened)
+	})
+
+	t.Run("returns false if there is no such delivery", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		recorded, err := db.RecordDeliveryOpen(context.Background(), 123)
+		require.NoError(t, err)
+		require.False(t, recorded)
+	})
+}
+
+func TestDatabase_RecordDeliveryClick(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("records only the first click, and an open", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		id, err := db.CreateDelivery(context.Background(), model.Delivery{Template: "welcome_email", ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		recorded, err := db.RecordDeliveryClick(context.Background(), id)
+		require.NoError(t, err)
+		require.True(t, recorded)
+		deliveries, err := db.GetDeliveries(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.NotNil(t, deliveries[0].Clicked)
+		require.NotNil(t, deliveries[0].Opened)
+		clicked := *deliveries[0].Clicked
+
+		_, err = db.RecordDeliveryClick(context.Background(), id)
+		require.NoError(t, err)
+		deliveries, err = db.GetDeliveries(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, clicked, *deliveries[0].Clicked)
+	})
+
+	t.Run("returns false if there is no such delivery", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		recorded, err := db.RecordDeliveryClick(context.Background(), 123)
+		require.NoError(t, err)
+		require.False(t, recorded)
+	})
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"Goo/model"
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AddFeedItems of the feed with the given URL that are not stored yet, returning how many were added.
+// When a feed is added for the first time, its items are marked as digested, so only items published after that
+// end up in digests, instead of the whole back catalogue.
+func (d *Database) AddFeedItems(ctx context.Context, feedURL string, items []model.FeedItem) (int, error) {
+	var added int
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var known bool
+		if err := tx.GetContext(ctx, &known, `select exists (select from feed_items where feed_url = $1)`, feedURL); err != nil {
+			return err
+		}
+
+		query := `
+		insert into feed_items (feed_url, guid, title, link, summary, published, digested)
+		values ($1, $2, $3, $4, $5, $6, case when $7 then null else now() end)
+		on conflict (feed_url, guid) do nothing`
+		for _, item := range items {
+			res, err := tx.ExecContext(ctx, query, feedURL, item.GUID, item.Title, item.Link, item.Summary, item.Published, known)
+			if err != nil {
+				return err
+			}
+			rows, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			added += int(rows)
+		}
+		return nil
+	})
+	return added, err
+}
+
+// CreateDigestCampaign from the feed items of the given feeds that have not been digested yet, oldest first
+// and up to the limit. The campaign from build is created as a draft, or with autoSend, as scheduled right away,
+// so it's started by StartDueCampaign once it's committed along with the items being marked as digested.
+// Returns nil if there are no items to digest.
+// The items are locked, so they end up in only one digest, even if this runs on several instances at the same time.
+func (d *Database) CreateDigestCampaign(ctx context.Context, feedURLs []string, limit int,
+	build func(items []model.FeedItem) (model.Campaign, error), autoSend bool) (*model.Campaign, error) {
+	var campaign *model.Campaign
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var items []model.FeedItem
+		query := `
+		select feed_url, guid, title, link, summary, published
+		from feed_items
+		where feed_url = any($1::text[]) and digested is null
+		order by published nulls last, created, guid
+		limit $2
+		for update`
+		if err := tx.SelectContext(ctx, &items, query, feedURLs, limit); err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+
+		c, err := build(items)
+		if err != nil {
+			return err
+		}
+		status := model.CampaignDraft
+		if autoSend {
+			status = model.CampaignScheduled
+		}
+		query = `
+		insert into campaigns (list_id, subject, html, text, from_address, status, send_at)
+		values ($1, $2, $3, $4, $5, $6, case when $6 = 'scheduled' then now() end)
+		returning ` + campaignColumns
+		if err := tx.GetContext(ctx, &c, query, c.ListID, c.Subject, c.HTML, c.Text, c.From, status); err != nil {
+			return err
+		}
+
+		query = `
+		update feed_items
+		set digested = now(), campaign_id = $1
+		where (feed_url, guid) in (select * from unnest($2::text[], $3::text[]))`
+		var urls, guids []string
+		for _, item := range items {
+			urls = append(urls, item.FeedURL)
+			guids = append(guids, item.GUID)
+		}
+		if _, err := tx.ExecContext(ctx, query, c.ID, urls, guids); err != nil {
+			return err
+		}
+		campaign = &c
+		return nil
+	})
+	return campaign, err
+}
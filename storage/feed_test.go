@@ -0,0 +1,69 @@
+package storage_test
+
+import (
+	"Goo/integrationtest"
+	"Goo/model"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_CreateDigestCampaign(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("adds feed items, and digests only those added after the feed was first seen, once", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		feedURL := "https://example.com/feed"
+		published := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+		added, err := db.AddFeedItems(context.Background(), feedURL, []model.FeedItem{{GUID: "1", Title: "Old", Published: &published}})
+		require.NoError(t, err)
+		require.Equal(t, 1, added)
+
+		build := func(items []model.FeedItem) (model.Campaign, error) {
+			return model.Campaign{ListID: "newsletter", Subject: "Digest", Text: items[0].Title}, nil
+		}
+		c, err := db.CreateDigestCampaign(context.Background(), []string{feedURL}, 10, build, false)
+		require.NoError(t, err)
+		require.Nil(t, c)
+
+		added, err = db.AddFeedItems(context.Background(), feedURL, []model.FeedItem{
+			{GUID: "2", Title: "New", Link: "https://example.com/2", Published: &published},
+			{GUID: "1", Title: "Old", Published: &published},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, added)
+
+		// Failing to build leaves the items for the next digest
+		_, err = db.CreateDigestCampaign(context.Background(), []string{feedURL}, 10, func([]model.FeedItem) (model.Campaign, error) {
+			return model.Campaign{}, errors.New("template is broken")
+		}, true)
+		require.Error(t, err)
+
+		c, err = db.CreateDigestCampaign(context.Background(), []string{feedURL}, 10, build, true)
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		require.Equal(t, "New", c.Text)
+		require.Equal(t, model.CampaignScheduled, c.Status)
+
+		c, err = db.CreateDigestCampaign(context.Background(), []string{feedURL}, 10, build, false)
+		require.NoError(t, err)
+		require.Nil(t, c)
+
+		campaigns, err := db.GetCampaigns(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, len(campaigns))
+
+		// The digest is started like other scheduled campaigns, once it's committed
+		started, err := db.StartDueCampaign(context.Background(), func(due model.Campaign) error {
+			require.Equal(t, campaigns[0].ID, due.ID)
+			return nil
+		})
+		require.NoError(t, err)
+		require.True(t, started)
+	})
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"Goo/model"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// CreateList with the given ID and name. If the list exists already, its name is updated.
+func (d *Database) CreateList(ctx context.Context, id, name string) error {
+	query := `insert into lists (id, name)
+		values ($1, $2)
+		on conflict (id) do update set
+			name = excluded.name,
+			updated = now()`
+	_, err := d.DB.ExecContext(ctx, query, id, name)
+	return err
+}
+
+// GetList with the given ID. Returns nil if there is no such list.
+func (d *Database) GetList(ctx context.Context, id string) (*model.List, error) {
+	var l model.List
+	query := `select id, name, created from lists where id = $1`
+	if err := d.DB.GetContext(ctx, &l, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetLists ordered by ID.
+func (d *Database) GetLists(ctx context.Context) ([]model.List, error) {
+	var lists []model.List
+	query := `select id, name, created from lists order by id`
+	err := d.DB.SelectContext(ctx, &lists, query)
+	return lists, err
+}
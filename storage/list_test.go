@@ -0,0 +1,49 @@
+package storage_test
+
+import (
+	"Goo/integrationtest"
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDatabase_CreateList(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("creates a list next to the default list and updates its name", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.CreateList(context.Background(), "golang", "Go")
+		require.NoError(t, err)
+		err = db.CreateList(context.Background(), "golang", "Go weekly")
+		require.NoError(t, err)
+
+		lists, err := db.GetLists(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 2, len(lists))
+		require.Equal(t, "golang", lists[0].ID)
+		require.Equal(t, "Go weekly", lists[0].Name)
+		require.Equal(t, "newsletter", lists[1].ID)
+	})
+}
+
+func TestDatabase_GetList(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("gets the list, or nil if there is no such list", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.CreateList(context.Background(), "golang", "Go")
+		require.NoError(t, err)
+
+		list, err := db.GetList(context.Background(), "golang")
+		require.NoError(t, err)
+		require.Equal(t, "Go", list.Name)
+
+		list, err = db.GetList(context.Background(), "rust")
+		require.NoError(t, err)
+		require.Nil(t, list)
+	})
+}
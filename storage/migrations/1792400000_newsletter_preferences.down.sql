@@ -0,0 +1,6 @@
+alter table newsletter_subscribers
+    drop column preferences_token,
+    drop column name,
+    drop column topics,
+    drop column frequency,
+    drop column paused;
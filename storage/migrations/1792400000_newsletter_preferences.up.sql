@@ -0,0 +1,12 @@
+alter table newsletter_subscribers
+    add column preferences_token text,
+    add column name text not null default '',
+    add column topics jsonb not null default '[]',
+    add column frequency text not null default 'weekly',
+    add column paused bool not null default false;
+
+update newsletter_subscribers set preferences_token = md5(random()::text) || md5(random()::text);
+
+alter table newsletter_subscribers alter column preferences_token set not null;
+
+create unique index newsletter_subscribers_preferences_token_idx on newsletter_subscribers (preferences_token);
@@ -0,0 +1,10 @@
+delete from newsletter_subscribers where list_id != 'newsletter';
+
+drop index newsletter_subscribers_email_idx;
+
+alter table newsletter_subscribers drop constraint newsletter_subscribers_pkey;
+alter table newsletter_subscribers add primary key (email);
+
+alter table newsletter_subscribers drop column list_id;
+
+drop table lists;
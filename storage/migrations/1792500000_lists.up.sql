@@ -0,0 +1,16 @@
+create table lists (
+    id text primary key,
+    name text not null,
+    created timestamp not null default now(),
+    updated timestamp not null default now()
+);
+
+insert into lists (id, name) values ('newsletter', 'Newsletter');
+
+alter table newsletter_subscribers add column list_id text not null default 'newsletter' references lists (id) on delete cascade;
+alter table newsletter_subscribers alter column list_id drop default;
+
+alter table newsletter_subscribers drop constraint newsletter_subscribers_pkey;
+alter table newsletter_subscribers add primary key (list_id, email);
+
+create index newsletter_subscribers_email_idx on newsletter_subscribers (email);
@@ -0,0 +1,8 @@
+alter table newsletter_subscribers add column name text not null default '';
+
+update newsletter_subscribers set name = trim(first_name || ' ' || last_name);
+
+alter table newsletter_subscribers
+    drop column first_name,
+    drop column last_name,
+    drop column attributes;
@@ -0,0 +1,8 @@
+alter table newsletter_subscribers
+    add column first_name text not null default '',
+    add column last_name text not null default '',
+    add column attributes jsonb not null default '{}';
+
+update newsletter_subscribers set first_name = name;
+
+alter table newsletter_subscribers drop column name;
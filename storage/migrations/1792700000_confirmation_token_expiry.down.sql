@@ -0,0 +1,7 @@
+drop index newsletter_subscribers_token_idx;
+
+update newsletter_subscribers set token = md5(random()::text) || md5(random()::text) where token is null;
+
+alter table newsletter_subscribers
+    alter column token set not null,
+    drop column token_created;
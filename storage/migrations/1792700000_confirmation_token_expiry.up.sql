@@ -0,0 +1,8 @@
+alter table newsletter_subscribers
+    alter column token drop not null,
+    add column token_created timestamp;
+
+update newsletter_subscribers set token_created = updated where not confirmed;
+update newsletter_subscribers set token = null where confirmed;
+
+create unique index newsletter_subscribers_token_idx on newsletter_subscribers (token);
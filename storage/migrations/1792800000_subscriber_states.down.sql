@@ -0,0 +1,11 @@
+drop table subscriber_events;
+
+alter table newsletter_subscribers
+    add column confirmed bool not null default false,
+    add column active bool not null default true;
+
+update newsletter_subscribers set
+    confirmed = state in ('confirmed', 'unsubscribed', 'bounced', 'complained'),
+    active = state in ('pending', 'confirmed');
+
+alter table newsletter_subscribers drop column state;
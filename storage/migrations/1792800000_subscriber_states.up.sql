@@ -0,0 +1,25 @@
+alter table newsletter_subscribers add column state text not null default 'pending'
+    check (state in ('pending', 'confirmed', 'unsubscribed', 'bounced', 'complained', 'erased'));
+
+update newsletter_subscribers set state = case
+    when not active then 'unsubscribed'
+    when confirmed then 'confirmed'
+    else 'pending'
+end;
+
+alter table newsletter_subscribers
+    drop column confirmed,
+    drop column active;
+
+create table subscriber_events (
+    id bigserial primary key,
+    list_id text not null,
+    email text not null,
+    from_state text,
+    to_state text not null,
+    reason text not null,
+    created timestamp not null default now(),
+    foreign key (list_id, email) references newsletter_subscribers (list_id, email) on update cascade on delete cascade
+);
+
+create index subscriber_events_list_id_email_idx on subscriber_events (list_id, email);
@@ -0,0 +1,14 @@
+create table consents (
+    id bigserial primary key,
+    list_id text not null,
+    email text not null,
+    action text not null check (action in ('signup', 'confirmation')),
+    ip text not null,
+    user_agent text not null,
+    form_url text not null,
+    text_version text not null,
+    created timestamp not null default now(),
+    foreign key (list_id, email) references newsletter_subscribers (list_id, email) on update cascade on delete cascade
+);
+
+create index consents_email_idx on consents (email);
@@ -0,0 +1,5 @@
+create table suppressions (
+    hash text primary key,
+    reason text not null check (reason in ('erasure')),
+    created timestamp not null default now()
+);
@@ -0,0 +1,15 @@
+delete from suppressions where kind != 'hash';
+
+drop index suppressions_kind_value_idx;
+
+alter table suppressions
+    drop constraint suppressions_reason_check,
+    drop column id,
+    drop column kind,
+    drop column expires;
+
+alter table suppressions rename column value to hash;
+
+alter table suppressions
+    add primary key (hash),
+    add constraint suppressions_reason_check check (reason in ('erasure'));
@@ -0,0 +1,13 @@
+alter table suppressions drop constraint suppressions_pkey;
+alter table suppressions drop constraint suppressions_reason_check;
+alter table suppressions rename column hash to value;
+
+alter table suppressions
+    add column id bigserial primary key,
+    add column kind text not null default 'hash' check (kind in ('address', 'domain', 'hash')),
+    add column expires timestamp,
+    add constraint suppressions_reason_check check (reason in ('manual', 'bounce', 'complaint', 'erasure'));
+
+alter table suppressions alter column kind drop default;
+
+create unique index suppressions_kind_value_idx on suppressions (kind, value);
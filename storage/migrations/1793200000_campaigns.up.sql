@@ -0,0 +1,14 @@
+create table campaigns (
+    id bigserial primary key,
+    list_id text not null references lists (id) on delete cascade,
+    subject text not null,
+    html text not null default '',
+    text text not null default '',
+    from_address text not null default '',
+    status text not null default 'draft' check (status in ('draft', 'scheduled', 'sending', 'sent', 'cancelled')),
+    created timestamp not null default now(),
+    updated timestamp not null default now(),
+    sent timestamp
+);
+
+create index campaigns_status_idx on campaigns (status);
@@ -0,0 +1 @@
+drop table campaign_recipients;
@@ -0,0 +1,12 @@
+create table campaign_recipients (
+    campaign_id bigint not null references campaigns (id) on delete cascade,
+    list_id text not null,
+    email text not null,
+    created timestamp not null default now(),
+    queued timestamp,
+    claimed timestamp,
+    primary key (campaign_id, email),
+    foreign key (list_id, email) references newsletter_subscribers (list_id, email) on update cascade on delete cascade
+);
+
+create index campaign_recipients_unqueued_idx on campaign_recipients (campaign_id, email) where queued is null;
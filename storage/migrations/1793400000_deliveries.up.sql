@@ -0,0 +1,18 @@
+create table deliveries (
+    id bigserial primary key,
+    template text not null default '',
+    campaign_id bigint references campaigns (id) on delete set null,
+    list_id text not null,
+    email text not null,
+    state text not null default 'queued' check (state in ('queued', 'sending', 'sent', 'failed', 'bounced')),
+    smtp_response text not null default '',
+    attempts int not null default 0,
+    created timestamp not null default now(),
+    updated timestamp not null default now(),
+    sent timestamp,
+    foreign key (list_id, email) references newsletter_subscribers (list_id, email) on update cascade on delete cascade,
+    check (template != '' or campaign_id is not null)
+);
+
+create index deliveries_email_idx on deliveries (email);
+create unique index deliveries_campaign_id_email_idx on deliveries (campaign_id, email) where campaign_id is not null;
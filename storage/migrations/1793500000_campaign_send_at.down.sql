@@ -0,0 +1,3 @@
+update campaigns set status = 'draft' where status = 'scheduled';
+
+alter table campaigns drop column send_at;
@@ -0,0 +1,3 @@
+alter table campaigns add column send_at timestamptz;
+
+create index campaigns_send_at_idx on campaigns (send_at) where status = 'scheduled';
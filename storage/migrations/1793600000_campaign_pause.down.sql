@@ -0,0 +1,9 @@
+update deliveries set state = 'failed' where state = 'skipped';
+alter table deliveries drop constraint deliveries_state_check;
+alter table deliveries add constraint deliveries_state_check
+    check (state in ('queued', 'sending', 'sent', 'failed', 'bounced'));
+
+update campaigns set status = 'cancelled' where status = 'paused';
+alter table campaigns drop constraint campaigns_status_check;
+alter table campaigns add constraint campaigns_status_check
+    check (status in ('draft', 'scheduled', 'sending', 'sent', 'cancelled'));
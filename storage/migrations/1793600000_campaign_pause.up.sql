@@ -0,0 +1,7 @@
+alter table campaigns drop constraint campaigns_status_check;
+alter table campaigns add constraint campaigns_status_check
+    check (status in ('draft', 'scheduled', 'sending', 'paused', 'sent', 'cancelled'));
+
+alter table deliveries drop constraint deliveries_state_check;
+alter table deliveries add constraint deliveries_state_check
+    check (state in ('queued', 'sending', 'sent', 'failed', 'bounced', 'skipped'));
@@ -0,0 +1,11 @@
+alter table deliveries
+    drop column variant,
+    drop column opened,
+    drop column clicked;
+
+alter table campaign_recipients drop column variant;
+
+alter table campaigns
+    drop column ab_test,
+    drop column ab_test_ends,
+    drop column ab_winner;
@@ -0,0 +1,13 @@
+alter table campaigns
+    add column ab_test jsonb,
+    add column ab_test_ends timestamptz,
+    add column ab_winner text not null default '';
+
+create index campaigns_ab_test_ends_idx on campaigns (ab_test_ends) where status = 'sending' and ab_winner = '';
+
+alter table campaign_recipients add column variant text not null default '';
+
+alter table deliveries
+    add column variant text not null default '',
+    add column opened timestamp,
+    add column clicked timestamp;
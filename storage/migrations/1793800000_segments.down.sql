@@ -0,0 +1,3 @@
+alter table campaigns drop column segment_id;
+
+drop table segments;
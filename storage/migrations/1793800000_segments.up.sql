@@ -0,0 +1,15 @@
+create table segments (
+    id bigserial primary key,
+    list_id text not null references lists (id) on delete cascade,
+    name text not null,
+    query text not null,
+    created timestamp not null default now(),
+    updated timestamp not null default now(),
+    unique (id, list_id)
+);
+
+alter table campaigns add column segment_id bigint;
+
+-- Campaigns can only target segments of their own list
+alter table campaigns add constraint campaigns_segment_fkey
+    foreign key (segment_id, list_id) references segments (id, list_id);
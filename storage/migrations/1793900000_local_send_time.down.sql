@@ -0,0 +1,5 @@
+alter table campaign_recipients drop column send_at;
+
+alter table campaigns drop column local_send_time;
+
+alter table newsletter_subscribers drop column timezone;
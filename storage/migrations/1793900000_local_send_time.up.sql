@@ -0,0 +1,7 @@
+alter table newsletter_subscribers add column timezone text not null default '';
+
+alter table campaigns add column local_send_time text not null default '';
+
+alter table campaign_recipients add column send_at timestamptz;
+
+create index campaign_recipients_send_at_idx on campaign_recipients (send_at) where queued is null;
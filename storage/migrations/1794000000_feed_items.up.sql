@@ -0,0 +1,15 @@
+create table feed_items (
+    feed_url text not null,
+    guid text not null,
+    title text not null default '',
+    link text not null default '',
+    summary text not null default '',
+    published timestamptz,
+    created timestamp not null default now(),
+    -- digested is when the item was put in a digest campaign, or seen when the feed was first polled
+    digested timestamp,
+    campaign_id bigint references campaigns (id) on delete set null,
+    primary key (feed_url, guid)
+);
+
+create index feed_items_undigested_idx on feed_items (published) where digested is null;
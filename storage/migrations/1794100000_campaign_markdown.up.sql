@@ -0,0 +1 @@
+alter table campaigns add column markdown text not null default '';
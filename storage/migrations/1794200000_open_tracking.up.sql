@@ -0,0 +1 @@
+alter table campaigns add column disable_open_tracking boolean not null default false;
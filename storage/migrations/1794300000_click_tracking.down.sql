@@ -0,0 +1 @@
+alter table campaigns drop column disable_click_tracking;
@@ -0,0 +1 @@
+alter table campaigns add column disable_click_tracking boolean not null default false;
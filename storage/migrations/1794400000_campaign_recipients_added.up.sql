@@ -0,0 +1 @@
+alter table campaigns add column recipients_added timestamptz;
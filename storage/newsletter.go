@@ -7,39 +7,303 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
-func (d *Database) SignupForNewsletter(ctx context.Context, email model.Email) (string, error) {
+// subscriberColumns to select into a model.Subscriber.
+const subscriberColumns = `list_id, email, state, preferences_token, first_name, last_name, attributes, timezone, topics, frequency, paused, created, updated`
+
+// SignupForNewsletter with the list ID, email, names, attributes and timezone of the given subscriber.
+// Returns the confirmation token, or model.ErrListNotFound if there is no such list.
+// Signing up again while pending replaces the names, attributes and timezone, and the token, unless the last token
+// was created less than the confirmation resend interval ago, like RenewNewsletterConfirmationToken.
+// Then the token is kept and an empty token is returned, so no new confirmation email is sent.
+// Unsubscribed and bounced subscribers go back to pending. Other subscribers cannot sign up again,
+// which returns model.ErrInvalidTransition.
+func (d *Database) SignupForNewsletter(ctx context.Context, s model.Subscriber) (string, error) {
 	token, err := createSecret()
 	if err != nil {
 		return "", err
 	}
-	query := `insert into newsletter_subscribers (email, token)
-		values ($1, $2)
-		on conflict (email) do update set
-			token = excluded.token,
-			updated = now()`
-	_, err = d.DB.ExecContext(ctx, query, email, token)
-	return token, err
+	preferencesToken, err := createSecret()
+	if err != nil {
+		return "", err
+	}
+
+	err = d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		query := `insert into newsletter_subscribers (list_id, email, state, token, token_created, preferences_token, first_name, last_name, attributes, timezone)
+			select id, $2, 'pending', $3, now(), $4, $5, $6, $7::jsonb, $8 from lists where id = $1
+			on conflict (list_id, email) do nothing
+			returning token`
+		err := tx.GetContext(ctx, &token, query, s.ListID, s.Email, token, preferencesToken, s.FirstName, s.LastName, s.Attributes, s.Timezone)
+		if err == nil {
+			return recordTransition(ctx, tx, s.ListID, s.Email, model.StateNew, model.StatePending, "signup")
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		// Either the subscriber exists already, or there is no such list
+		state, err := getStateForUpdate(ctx, tx, s.ListID, s.Email)
+		if err != nil {
+			return err
+		}
+		if state == model.StateNew {
+			return model.ErrListNotFound
+		}
+		if state == model.StatePending {
+			var throttled bool
+			query = `
+			select token_created is not null and token_created > now() - make_interval(secs => $3)
+			from newsletter_subscribers
+			where list_id = $1 and email = $2`
+			if err := tx.GetContext(ctx, &throttled, query, s.ListID, s.Email, d.confirmationResendInterval.Seconds()); err != nil {
+				return err
+			}
+			if throttled {
+				token = ""
+			}
+		} else {
+			if err := recordTransition(ctx, tx, s.ListID, s.Email, state, model.StatePending, "signup"); err != nil {
+				return err
+			}
+		}
+
+		query = `
+		update newsletter_subscribers
+		set token = coalesce(nullif($3, ''), token), token_created = case when $3 = '' then token_created else now() end,
+			first_name = $4, last_name = $5, attributes = $6::jsonb, timezone = $7, updated = now()
+		where list_id = $1 and email = $2`
+		_, err = tx.ExecContext(ctx, query, s.ListID, s.Email, token, s.FirstName, s.LastName, s.Attributes, s.Timezone)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConfirmNewsletterSignup on the list with the given token. Returns the associated subscriber if matched.
+// The token is cleared, so it can only be used once.
+// Confirming is new consent, so it also deletes the erasure suppression of the address, if it was erased before,
+// and the address gets marketing email again. Other suppressions of the address are kept.
+// Returns model.ErrTokenExpired if the token is older than the confirmation token TTL.
+func (d *Database) ConfirmNewsletterSignup(ctx context.Context, listID, token string) (*model.Subscriber, error) {
+	var s *model.Subscriber
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var current struct {
+			Email model.Email           `db:"email"`
+			State model.SubscriberState `db:"state"`
+			Fresh bool                  `db:"fresh"`
+		}
+		query := `
+		select email, state, token_created > now() - make_interval(secs => $3) as fresh
+		from newsletter_subscribers
+		where list_id = $1 and token = $2
+		for update`
+		if err := tx.GetContext(ctx, &current, query, listID, token, d.confirmationTokenTTL.Seconds()); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+		if !current.Fresh {
+			return model.ErrTokenExpired
+		}
+
+		if err := recordTransition(ctx, tx, listID, current.Email, current.State, model.StateConfirmed, "confirmation"); err != nil {
+			return err
+		}
+
+		// Confirming again is new consent, which overrides an earlier erasure
+		if _, err := tx.ExecContext(ctx, `delete from suppressions where kind = 'hash' and value = $1 and reason = 'erasure'`,
+			d.hashEmail(current.Email)); err != nil {
+			return err
+		}
+
+		s = &model.Subscriber{}
+		return tx.GetContext(ctx, s, `select `+subscriberColumns+` from newsletter_subscribers where list_id = $1 and email = $2`,
+			listID, current.Email)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
-// ConfirmNewsletterSignup with the given token. Returns the associated email if matched.
-func (d *Database) ConfirmNewsletterSignup(ctx context.Context, token string) (*model.Email, error) {
-	var email model.Email
+// RenewNewsletterConfirmationToken for a pending subscriber on the list, returning the subscriber and the new token.
+// Returns nil if there is no such pending subscriber, or if the last token was created less than
+// the confirmation resend interval ago.
+func (d *Database) RenewNewsletterConfirmationToken(ctx context.Context, listID string, email model.Email) (*model.Subscriber, string, error) {
+	token, err := createSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	var s model.Subscriber
 	query := `
 	update newsletter_subscribers
-	set confirmed = true
-	where token = $1
-	returning email
-	`
-	err := d.DB.GetContext(ctx, &email, query, token)
+	set token = $3, token_created = now(), updated = now()
+	where list_id = $1 and email = $2 and state = 'pending'
+		and (token_created is null or token_created < now() - make_interval(secs => $4))
+	returning ` + subscriberColumns
+	err = d.DB.GetContext(ctx, &s, query, listID, email, token, d.confirmationResendInterval.Seconds())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	return &s, token, nil
+}
+
+// GetNewsletterPreferences of the subscriber with the given preferences token. Returns nil if not matched.
+func (d *Database) GetNewsletterPreferences(ctx context.Context, token string) (*model.Subscriber, error) {
+	var s model.Subscriber
+	query := `
+	select ` + subscriberColumns + `
+	from newsletter_subscribers
+	where preferences_token = $1`
+	err := d.DB.GetContext(ctx, &s, query, token)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &email, nil
+	return &s, nil
+}
+
+// GetSubscriber with the given email on the list. Returns nil if there is no such subscriber.
+func (d *Database) GetSubscriber(ctx context.Context, listID string, email model.Email) (*model.Subscriber, error) {
+	var s model.Subscriber
+	query := `select ` + subscriberColumns + ` from newsletter_subscribers where list_id = $1 and email = $2`
+	err := d.DB.GetContext(ctx, &s, query, listID, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// UpdateNewsletterPreferences of the subscriber with the given preferences token.
+// Returns the updated subscriber, or nil if not matched.
+func (d *Database) UpdateNewsletterPreferences(ctx context.Context, token string, p model.Preferences) (*model.Subscriber, error) {
+	var s model.Subscriber
+	query := `
+	update newsletter_subscribers
+	set first_name = $2, last_name = $3, topics = $4, frequency = $5, paused = $6, updated = now()
+	where preferences_token = $1
+	returning ` + subscriberColumns
+	err := d.DB.GetContext(ctx, &s, query, token, p.FirstName, p.LastName, p.Topics, p.Frequency, p.Paused)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// UnsubscribeFromNewsletter moves the subscriber with the given email on the list to the unsubscribed state.
+// It is not an error if there is no such subscriber, or if the subscriber cannot be unsubscribed
+// because it's unsubscribed already or in another final state.
+func (d *Database) UnsubscribeFromNewsletter(ctx context.Context, listID string, email model.Email) error {
+	err := d.ChangeSubscriberState(ctx, listID, email, model.StateUnsubscribed, "unsubscribe")
+	if errors.Is(err, model.ErrInvalidTransition) {
+		return nil
+	}
+	return err
+}
+
+// PurgeUnconfirmedSignups deletes pending subscribers, including their tokens, events and consents,
+// that were last updated longer ago than the given duration, which must be positive. Signing up again
+// and renewing the confirmation token both update the subscriber. Returns how many were deleted.
+func (d *Database) PurgeUnconfirmedSignups(ctx context.Context, olderThan time.Duration) (int, error) {
+	if olderThan <= 0 {
+		return 0, errors.New("retention of unconfirmed signups must be positive")
+	}
+	query := `
+	delete from newsletter_subscribers
+	where state = 'pending' and updated < now() - make_interval(secs => $1)`
+	result, err := d.DB.ExecContext(ctx, query, olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// ChangeSubscriberState of the subscriber with the given email on the list, recording the reason.
+// Returns model.ErrInvalidTransition if the subscriber cannot go from its current state to the given one.
+// It is not an error if there is no such subscriber.
+func (d *Database) ChangeSubscriberState(ctx context.Context, listID string, email model.Email, to model.SubscriberState, reason string) error {
+	return d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		state, err := getStateForUpdate(ctx, tx, listID, email)
+		if err != nil {
+			return err
+		}
+		if state == model.StateNew {
+			return nil
+		}
+		return recordTransition(ctx, tx, listID, email, state, to, reason)
+	})
+}
+
+// GetSubscriberEvents for the subscriber with the given email on the list, oldest first.
+func (d *Database) GetSubscriberEvents(ctx context.Context, listID string, email model.Email) ([]model.SubscriberEvent, error) {
+	var events []model.SubscriberEvent
+	query := `
+	select list_id, email, coalesce(from_state, '') as from_state, to_state, reason, created
+	from subscriber_events
+	where list_id = $1 and email = $2
+	order by id`
+	err := d.DB.SelectContext(ctx, &events, query, listID, email)
+	return events, err
+}
+
+// getStateForUpdate of the subscriber, locking the row until the end of the transaction.
+// Returns model.StateNew if there is no such subscriber.
+func getStateForUpdate(ctx context.Context, tx *sqlx.Tx, listID string, email model.Email) (model.SubscriberState, error) {
+	var state model.SubscriberState
+	query := `select state from newsletter_subscribers where list_id = $1 and email = $2 for update`
+	if err := tx.GetContext(ctx, &state, query, listID, email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.StateNew, nil
+		}
+		return "", err
+	}
+	return state, nil
+}
+
+// recordTransition of the subscriber from one state to another, if allowed.
+// The confirmation token is cleared when leaving the pending state, and kept when going to it,
+// so the token of a new signup stays valid.
+// The subscriber must exist, and its row should be locked by the caller.
+func recordTransition(ctx context.Context, tx *sqlx.Tx, listID string, email model.Email, from, to model.SubscriberState, reason string) error {
+	if !from.CanTransitionTo(to) {
+		return model.ErrInvalidTransition
+	}
+
+	query := `
+	update newsletter_subscribers
+	set state = $3,
+		token = case when $3 = 'pending' then token end,
+		token_created = case when $3 = 'pending' then token_created end,
+		updated = now()
+	where list_id = $1 and email = $2`
+	if _, err := tx.ExecContext(ctx, query, listID, email, to); err != nil {
+		return err
+	}
+
+	query = `
+	insert into subscriber_events (list_id, email, from_state, to_state, reason)
+	values ($1, $2, nullif($3::text, ''), $4, $5)`
+	_, err := tx.ExecContext(ctx, query, listID, email, from, to, reason)
+	return err
 }
 
 func createSecret() (string, error) {
@@ -2,10 +2,12 @@ package storage_test
 
 import (
 	"Goo/integrationtest"
+	"Goo/model"
 	"context"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func TestDatabase_SignupForNewsletter(t *testing.T) {
@@ -15,18 +17,31 @@ func TestDatabase_SignupForNewsletter(t *testing.T) {
 		db, cleanup := integrationtest.CreateDatabase()
 		defer cleanup()
 
-		expectedToken, err := db.SignupForNewsletter(context.Background(), "me@example.com")
+		expectedToken, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
 		require.NoError(t, err)
 		require.Equal(t, 64, len(expectedToken))
 
 		var email, token string
-		err = db.DB.QueryRow(`select email, token from newsletter_subscribers `).Scan(&email, &token)
+		var tokenCreated *time.Time
+		err = db.DB.QueryRow(`select email, token, token_created from newsletter_subscribers `).Scan(&email, &token, &tokenCreated)
 		require.NoError(t, err)
 		require.Equal(t, "me@example.com", email)
 		assert.Equal(t, expectedToken, token)
+		assert.NotNil(t, tokenCreated)
 
-		expectedToken2, err := db.SignupForNewsletter(context.Background(), "me@example.com")
+		// Signing up again right away keeps the token, so no new confirmation email is sent
+		throttledToken, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
 		require.NoError(t, err)
+		require.Equal(t, "", throttledToken)
+		err = db.DB.QueryRow(`select token from newsletter_subscribers`).Scan(&token)
+		require.NoError(t, err)
+		require.Equal(t, expectedToken, token)
+
+		_, err = db.DB.Exec(`update newsletter_subscribers set token_created = now() - interval '6 minutes'`)
+		require.NoError(t, err)
+		expectedToken2, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		require.Equal(t, 64, len(expectedToken2))
 		require.NotEqual(t, expectedToken, expectedToken2)
 
 		err = db.DB.QueryRow(`select email, token from newsletter_subscribers`).Scan(&email, &token)
@@ -34,6 +49,106 @@ func TestDatabase_SignupForNewsletter(t *testing.T) {
 		require.Equal(t, "me@example.com", email)
 		assert.Equal(t, expectedToken2, token)
 	})
+
+	t.Run("signs up to lists independently", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.CreateList(context.Background(), "golang", "Go")
+		require.NoError(t, err)
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		_, err = db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "golang", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		subscriber, err := db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+		require.Equal(t, "newsletter", subscriber.ListID)
+
+		var states []model.SubscriberState
+		err = db.DB.Select(&states, `select state from newsletter_subscribers order by list_id`)
+		require.NoError(t, err)
+		require.Equal(t, []model.SubscriberState{model.StatePending, model.StateConfirmed}, states)
+	})
+
+	t.Run("stores names and attributes, and does not sign up confirmed subscribers again", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{
+			ListID:      "newsletter",
+			Email:       "me@example.com",
+			Attributes:  model.Attributes{"company": "Goo"},
+			Preferences: model.Preferences{FirstName: "Me", LastName: "Myself"},
+		})
+		require.NoError(t, err)
+
+		subscriber, err := db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+		require.Equal(t, "Me Myself", subscriber.Name())
+		require.Equal(t, model.Attributes{"company": "Goo"}, subscriber.Attributes)
+
+		token, err = db.SignupForNewsletter(context.Background(), model.Subscriber{
+			ListID:      "newsletter",
+			Email:       "me@example.com",
+			Preferences: model.Preferences{FirstName: "Someone", LastName: "Else"},
+		})
+		require.ErrorIs(t, err, model.ErrInvalidTransition)
+		require.Equal(t, "", token)
+
+		s, err := db.GetNewsletterPreferences(context.Background(), subscriber.PreferencesToken)
+		require.NoError(t, err)
+		require.Equal(t, "Me Myself", s.Name())
+	})
+
+	t.Run("signs up unsubscribed subscribers again and records the transitions", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		_, err = db.DB.Exec(`update newsletter_subscribers set token_created = now() - interval '6 minutes'`)
+		require.NoError(t, err)
+		token2, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		require.NotEqual(t, token, token2)
+		_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token2)
+		require.NoError(t, err)
+		err = db.UnsubscribeFromNewsletter(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+
+		token, err = db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		require.Equal(t, 64, len(token))
+
+		events, err := db.GetSubscriberEvents(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 4, len(events))
+		for i, expected := range []struct {
+			from, to model.SubscriberState
+			reason   string
+		}{
+			{model.StateNew, model.StatePending, "signup"},
+			{model.StatePending, model.StateConfirmed, "confirmation"},
+			{model.StateConfirmed, model.StateUnsubscribed, "unsubscribe"},
+			{model.StateUnsubscribed, model.StatePending, "signup"},
+		} {
+			require.Equal(t, expected.from, events[i].From)
+			require.Equal(t, expected.to, events[i].To)
+			require.Equal(t, expected.reason, events[i].Reason)
+			require.False(t, events[i].Created.IsZero())
+		}
+	})
+
+	t.Run("returns model.ErrListNotFound if there is no such list", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "doesnotexist", Email: "me@example.com"})
+		require.ErrorIs(t, err, model.ErrListNotFound)
+		require.Equal(t, "", token)
+	})
 }
 
 func TestDatabase_ConfirmNewsletterSignup(t *testing.T) {
@@ -43,32 +158,338 @@ func TestDatabase_ConfirmNewsletterSignup(t *testing.T) {
 		db, cleanup := integrationtest.CreateDatabase()
 		defer cleanup()
 
-		token, err := db.SignupForNewsletter(context.Background(), "me@example.com")
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		var state model.SubscriberState
+		err = db.DB.Get(&state, `select state from newsletter_subscribers where token = $1`, token)
+		require.NoError(t, err)
+		require.Equal(t, model.StatePending, state)
+
+		subscriber, err := db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+		require.Equal(t, "me@example.com", subscriber.Email.String())
+		require.Equal(t, 64, len(subscriber.PreferencesToken))
+
+		require.Equal(t, model.StateConfirmed, subscriber.State)
+
+		err = db.DB.Get(&state, `select state from newsletter_subscribers where email = $1`, "me@example.com")
 		require.NoError(t, err)
+		require.Equal(t, model.StateConfirmed, state)
+	})
+
+	t.Run("lifts an earlier erasure of the address, but not other suppressions", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
 
-		var confirmed bool
-		err = db.DB.Get(&confirmed, `select confirmed from newsletter_subscribers where token = &1`, token)
+		err := db.EraseSubscriber(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		err = db.EraseSubscriber(context.Background(), "you@example.com")
 		require.NoError(t, err)
-		require.False(t, confirmed)
+		_, err = db.AddSuppression(context.Background(), model.NewSuppression("you@example.com", model.SuppressionManual, nil))
+		require.NoError(t, err)
+
+		for _, email := range []model.Email{"me@example.com", "you@example.com"} {
+			token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: email})
+			require.NoError(t, err)
+			suppressed, err := db.IsSuppressed(context.Background(), email)
+			require.NoError(t, err)
+			require.True(t, suppressed)
 
-		email, err := db.ConfirmNewsletterSignup(context.Background(), token)
+			_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+			require.NoError(t, err)
+		}
+
+		suppressed, err := db.IsSuppressed(context.Background(), "me@example.com")
 		require.NoError(t, err)
-		require.Equal(t, "me@example.com", email.String())
+		require.False(t, suppressed)
 
-		err = db.DB.Get(&confirmed, `select confirmed from newsletter_subscribers where token = &1`, token)
+		suppressed, err = db.IsSuppressed(context.Background(), "you@example.com")
 		require.NoError(t, err)
-		require.True(t, confirmed)
+		require.True(t, suppressed)
 	})
 
 	t.Run("returns nil if no such token", func(t *testing.T) {
 		db, cleanup := integrationtest.CreateDatabase()
 		defer cleanup()
 
-		_, err := db.SignupForNewsletter(context.Background(), "me@example.com")
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		subscriber, err := db.ConfirmNewsletterSignup(context.Background(), "newsletter", "wrongtoken")
+		require.NoError(t, err)
+		require.Nil(t, subscriber)
+	})
+
+	t.Run("returns nil if the token is for another list", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.CreateList(context.Background(), "golang", "Go")
+		require.NoError(t, err)
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		subscriber, err := db.ConfirmNewsletterSignup(context.Background(), "golang", token)
+		require.NoError(t, err)
+		require.Nil(t, subscriber)
+	})
+}
+
+func TestDatabase_ConfirmNewsletterSignup_TokenExpiry(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("can only use a token once", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		subscriber, err := db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+		require.NotNil(t, subscriber)
+
+		subscriber, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
 		require.NoError(t, err)
+		require.Nil(t, subscriber)
+	})
+
+	t.Run("returns ErrTokenExpired if the token is too old", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		_, err = db.DB.Exec(`update newsletter_subscribers set token_created = now() - interval '49 hours'`)
+		require.NoError(t, err)
+
+		subscriber, err := db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.ErrorIs(t, err, model.ErrTokenExpired)
+		require.Nil(t, subscriber)
+	})
+}
+
+func TestDatabase_RenewNewsletterConfirmationToken(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("renews the token of an unconfirmed subscriber, but not too often", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		subscriber, newToken, err := db.RenewNewsletterConfirmationToken(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+		require.Nil(t, subscriber)
+		require.Equal(t, "", newToken)
+
+		_, err = db.DB.Exec(`update newsletter_subscribers set token_created = now() - interval '6 minutes'`)
+		require.NoError(t, err)
+
+		subscriber, newToken, err = db.RenewNewsletterConfirmationToken(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, model.Email("me@example.com"), subscriber.Email)
+		require.Equal(t, 64, len(newToken))
+		require.NotEqual(t, token, newToken)
+
+		subscriber, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+		require.Nil(t, subscriber)
+
+		subscriber, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", newToken)
+		require.NoError(t, err)
+		require.NotNil(t, subscriber)
+	})
+
+	t.Run("returns nil for confirmed and unknown subscribers", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+
+		subscriber, _, err := db.RenewNewsletterConfirmationToken(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+		require.Nil(t, subscriber)
+
+		subscriber, _, err = db.RenewNewsletterConfirmationToken(context.Background(), "newsletter", "you@example.com")
+		require.NoError(t, err)
+		require.Nil(t, subscriber)
+	})
+}
+
+func TestDatabase_UpdateNewsletterPreferences(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("gets default preferences and updates them", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		subscriber, err := db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+
+		s, err := db.GetNewsletterPreferences(context.Background(), subscriber.PreferencesToken)
+		require.NoError(t, err)
+		require.Equal(t, model.Preferences{Topics: model.Topics{}, Frequency: "weekly", Paused: false}, s.Preferences)
+
+		preferences := model.Preferences{FirstName: "Me", LastName: "Myself", Topics: model.Topics{"articles"}, Frequency: "monthly", Paused: true}
+		s, err = db.UpdateNewsletterPreferences(context.Background(), subscriber.PreferencesToken, preferences)
+		require.NoError(t, err)
+		require.Equal(t, preferences, s.Preferences)
+
+		s, err = db.GetNewsletterPreferences(context.Background(), subscriber.PreferencesToken)
+		require.NoError(t, err)
+		require.Equal(t, model.Email("me@example.com"), s.Email)
+		require.Equal(t, preferences, s.Preferences)
+	})
+
+	t.Run("keeps the preferences token when signing up again", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		subscriber, err := db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+
+		err = db.UnsubscribeFromNewsletter(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+		token, err = db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		subscriber2, err := db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+		require.Equal(t, subscriber.PreferencesToken, subscriber2.PreferencesToken)
+	})
+
+	t.Run("returns nil if no such token", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s, err := db.GetNewsletterPreferences(context.Background(), "wrongtoken")
+		require.NoError(t, err)
+		require.Nil(t, s)
+
+		s, err = db.UpdateNewsletterPreferences(context.Background(), "wrongtoken", model.Preferences{Frequency: "weekly"})
+		require.NoError(t, err)
+		require.Nil(t, s)
+	})
+}
+
+func TestDatabase_UnsubscribeFromNewsletter(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("moves the subscriber to the unsubscribed state", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+
+		err = db.UnsubscribeFromNewsletter(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+
+		var state model.SubscriberState
+		err = db.DB.Get(&state, `select state from newsletter_subscribers where email = $1`, "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, model.StateUnsubscribed, state)
+
+		err = db.UnsubscribeFromNewsletter(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+	})
+
+	t.Run("does not error if there is no such subscriber", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.UnsubscribeFromNewsletter(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+	})
+}
+
+func TestDatabase_ChangeSubscriberState(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("rejects transitions that are not allowed", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		err = db.ChangeSubscriberState(context.Background(), "newsletter", "me@example.com", model.StateComplained, "complaint")
+		require.NoError(t, err)
+
+		err = db.ChangeSubscriberState(context.Background(), "newsletter", "me@example.com", model.StatePending, "signup")
+		require.ErrorIs(t, err, model.ErrInvalidTransition)
+
+		_, err = db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.ErrorIs(t, err, model.ErrInvalidTransition)
+
+		events, err := db.GetSubscriberEvents(context.Background(), "newsletter", "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 2, len(events))
+		require.Equal(t, model.StateComplained, events[1].To)
+		require.Equal(t, "complaint", events[1].Reason)
+	})
+
+	t.Run("does not error if there is no such subscriber", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.ChangeSubscriberState(context.Background(), "newsletter", "me@example.com", model.StateBounced, "bounce")
+		require.NoError(t, err)
+	})
+}
+
+func TestDatabase_PurgeUnconfirmedSignups(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("purges only pending signups that have not been updated within the retention", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "old@example.com"})
+		require.NoError(t, err)
+		_, err = db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "new@example.com"})
+		require.NoError(t, err)
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "confirmed@example.com"})
+		require.NoError(t, err)
+		_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+		_, err = db.DB.Exec(`update newsletter_subscribers set updated = now() - interval '31 days' where email != 'new@example.com'`)
+		require.NoError(t, err)
+
+		count, err := db.PurgeUnconfirmedSignups(context.Background(), 30*24*time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+
+		var emails []string
+		err = db.DB.Select(&emails, `select email from newsletter_subscribers order by email`)
+		require.NoError(t, err)
+		require.Equal(t, []string{"confirmed@example.com", "new@example.com"}, emails)
+	})
+
+	t.Run("returns an error if the retention is not positive", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+
+		_, err = db.PurgeUnconfirmedSignups(context.Background(), -time.Hour)
+		require.Error(t, err)
 
-		email, err := db.ConfirmNewsletterSignup(context.Background(), "wrongtoken")
+		var count int
+		err = db.DB.Get(&count, `select count(*) from newsletter_subscribers`)
 		require.NoError(t, err)
-		require.Nil(t, email)
+		require.Equal(t, 1, count)
 	})
 }
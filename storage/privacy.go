@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"Goo/model"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ExportSubscriber returns everything stored about the email on all lists, matching the email in any case,
+// like EraseSubscriber.
+func (d *Database) ExportSubscriber(ctx context.Context, email model.Email) (model.SubjectAccessExport, error) {
+	export := model.SubjectAccessExport{
+		Email:       email,
+		Subscribers: []model.Subscriber{},
+		Events:      []model.SubscriberEvent{},
+		Consents:    []model.Consent{},
+		Deliveries:  []model.Delivery{},
+	}
+
+	query := `select ` + subscriberColumns + ` from newsletter_subscribers where lower(email) = lower($1) order by list_id, email`
+	if err := d.DB.SelectContext(ctx, &export.Subscribers, query, email); err != nil {
+		return export, err
+	}
+
+	query = `
+	select list_id, email, coalesce(from_state, '') as from_state, to_state, reason, created
+	from subscriber_events
+	where lower(email) = lower($1)
+	order by id`
+	if err := d.DB.SelectContext(ctx, &export.Events, query, email); err != nil {
+		return export, err
+	}
+
+	var err error
+	export.Consents, err = d.GetConsents(ctx, email)
+	if export.Consents == nil {
+		export.Consents = []model.Consent{}
+	}
+	if err != nil {
+		return export, err
+	}
+
+	export.Deliveries, err = d.GetDeliveries(ctx, email)
+	if export.Deliveries == nil {
+		export.Deliveries = []model.Delivery{}
+	}
+	return export, err
+}
+
+// EraseSubscriber deletes the personal data stored about the email on all lists.
+// Subscribers are moved to the erased state, their email is replaced by a salted hash, and their names,
+// attributes, timezone, preferences and consent records are removed, as are SMTP responses of their deliveries,
+// which can contain the address. The hash is added to the suppressions,
+// so the address gets no marketing email without being stored, see IsSuppressed,
+// until it signs up and confirms again, see ConfirmNewsletterSignup.
+// The email is matched in any case, like the hash. Differently cased subscribers on the same list would get the same
+// hash, so all but one of them are deleted.
+// Erasing an address that is not stored still adds it to the suppressions.
+func (d *Database) EraseSubscriber(ctx context.Context, email model.Email) error {
+	hash := d.hashEmail(email)
+
+	return d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		var subscribers []struct {
+			ListID string                `db:"list_id"`
+			Email  model.Email           `db:"email"`
+			State  model.SubscriberState `db:"state"`
+		}
+		query := `select list_id, email, state from newsletter_subscribers where lower(email) = lower($1) order by list_id, email for update`
+		if err := tx.SelectContext(ctx, &subscribers, query, email); err != nil {
+			return err
+		}
+		for _, s := range subscribers {
+			if err := recordTransition(ctx, tx, s.ListID, s.Email, s.State, model.StateErased, "erasure"); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `delete from consents where lower(email) = lower($1)`, email); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `update deliveries set smtp_response = '' where lower(email) = lower($1)`, email); err != nil {
+			return err
+		}
+
+		// Rows from an earlier erasure of the same address would clash with the new ones
+		if _, err := tx.ExecContext(ctx, `delete from newsletter_subscribers where email = $1`, hash); err != nil {
+			return err
+		}
+
+		// So would differently cased rows on the same list, so only the first of them is kept
+		query = `
+		delete from newsletter_subscribers s
+		where lower(s.email) = lower($1) and exists (
+			select from newsletter_subscribers o where o.list_id = s.list_id and lower(o.email) = lower($1) and o.email < s.email)`
+		if _, err := tx.ExecContext(ctx, query, email); err != nil {
+			return err
+		}
+
+		query = `
+		update newsletter_subscribers
+		set email = $2, first_name = '', last_name = '', attributes = '{}', timezone = '', topics = '[]', paused = false,
+			updated = now()
+		where lower(email) = lower($1)`
+		if _, err := tx.ExecContext(ctx, query, email, hash); err != nil {
+			return err
+		}
+
+		query = `insert into suppressions (kind, value, reason) values ('hash', $1, 'erasure') on conflict (kind, value) do nothing`
+		_, err := tx.ExecContext(ctx, query, hash)
+		return err
+	})
+}
+
+// hashEmail with the secret salt, so erased addresses can be recognized but not recovered.
+// The address is lowercased first, so differently cased variants match.
+func (d *Database) hashEmail(email model.Email) string {
+	h := hmac.New(sha256.New, d.emailHashSalt)
+	h.Write([]byte(strings.ToLower(strings.TrimSpace(email.String()))))
+	return hex.EncodeToString(h.Sum(nil))
+}
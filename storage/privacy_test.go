@@ -0,0 +1,174 @@
+package storage_test
+
+import (
+	"Goo/integrationtest"
+	"Goo/model"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_ExportSubscriber(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("exports subscribers, events and consents for the email", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{
+			ListID:      "newsletter",
+			Email:       "me@example.com",
+			Preferences: model.Preferences{FirstName: "Me"},
+		})
+		require.NoError(t, err)
+		err = db.RecordConsent(context.Background(), model.Consent{ListID: "newsletter", Email: "me@example.com", Action: model.ConsentSignup})
+		require.NoError(t, err)
+		_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+		_, err = db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "you@example.com"})
+		require.NoError(t, err)
+
+		export, err := db.ExportSubscriber(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, model.Email("me@example.com"), export.Email)
+		require.Equal(t, 1, len(export.Subscribers))
+		require.Equal(t, "Me", export.Subscribers[0].FirstName)
+		require.Equal(t, model.StateConfirmed, export.Subscribers[0].State)
+		require.Equal(t, 2, len(export.Events))
+		require.Equal(t, 1, len(export.Consents))
+	})
+
+	t.Run("exports the email in any case", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.CreateList(context.Background(), "golang", "Go")
+		require.NoError(t, err)
+		_, err = db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		_, err = db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "golang", Email: "Me@Example.com"})
+		require.NoError(t, err)
+
+		export, err := db.ExportSubscriber(context.Background(), "ME@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 2, len(export.Subscribers))
+		require.Equal(t, 2, len(export.Events))
+	})
+}
+
+func TestDatabase_EraseSubscriber(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("erases personal data and remembers the hash", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{
+			ListID:      "newsletter",
+			Email:       "me@example.com",
+			Attributes:  model.Attributes{"company": "Goo"},
+			Preferences: model.Preferences{FirstName: "Me", LastName: "Myself"},
+		})
+		require.NoError(t, err)
+		err = db.RecordConsent(context.Background(), model.Consent{ListID: "newsletter", Email: "me@example.com", Action: model.ConsentSignup, IP: "192.0.2.1"})
+		require.NoError(t, err)
+
+		err = db.EraseSubscriber(context.Background(), "me@example.com")
+		require.NoError(t, err)
+
+		export, err := db.ExportSubscriber(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.Equal(t, 0, len(export.Subscribers))
+		require.Equal(t, 0, len(export.Events))
+		require.Equal(t, 0, len(export.Consents))
+
+		var count int
+		err = db.DB.Get(&count, `select count(*) from newsletter_subscribers where first_name = 'Me' or email like '%@%'`)
+		require.NoError(t, err)
+		require.Equal(t, 0, count)
+
+		var states []model.SubscriberState
+		err = db.DB.Select(&states, `select to_state from subscriber_events order by id`)
+		require.NoError(t, err)
+		require.Equal(t, []model.SubscriberState{model.StatePending, model.StateErased}, states)
+
+		erased, err := db.IsSuppressed(context.Background(), "Me@Example.com")
+		require.NoError(t, err)
+		require.True(t, erased)
+
+		erased, err = db.IsSuppressed(context.Background(), "you@example.com")
+		require.NoError(t, err)
+		require.False(t, erased)
+	})
+
+	t.Run("erases the email in any case", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.CreateList(context.Background(), "golang", "Go")
+		require.NoError(t, err)
+		for _, s := range []model.Subscriber{
+			{ListID: "newsletter", Email: "me@example.com", Preferences: model.Preferences{FirstName: "Me"}},
+			{ListID: "newsletter", Email: "Me@Example.com", Preferences: model.Preferences{FirstName: "Me"}},
+			{ListID: "golang", Email: "ME@EXAMPLE.COM", Preferences: model.Preferences{FirstName: "Me"}},
+		} {
+			_, err := db.SignupForNewsletter(context.Background(), s)
+			require.NoError(t, err)
+			err = db.RecordConsent(context.Background(), model.Consent{ListID: s.ListID, Email: s.Email, Action: model.ConsentSignup, IP: "192.0.2.1"})
+			require.NoError(t, err)
+		}
+
+		err = db.EraseSubscriber(context.Background(), "mE@example.com")
+		require.NoError(t, err)
+
+		var count int
+		err = db.DB.Get(&count, `select count(*) from newsletter_subscribers where first_name = 'Me' or email like '%@%'`)
+		require.NoError(t, err)
+		require.Equal(t, 0, count)
+		err = db.DB.Get(&count, `select count(*) from newsletter_subscribers where state = 'erased'`)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+		err = db.DB.Get(&count, `select count(*) from consents`)
+		require.NoError(t, err)
+		require.Equal(t, 0, count)
+	})
+
+	t.Run("can erase again after signing up and confirming again, which lifts the erasure", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		err = db.EraseSubscriber(context.Background(), "me@example.com")
+		require.NoError(t, err)
+
+		token, err := db.SignupForNewsletter(context.Background(), model.Subscriber{ListID: "newsletter", Email: "me@example.com"})
+		require.NoError(t, err)
+		_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+		require.NoError(t, err)
+
+		erased, err := db.IsSuppressed(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.False(t, erased)
+
+		err = db.EraseSubscriber(context.Background(), "me@example.com")
+		require.NoError(t, err)
+
+		erased, err = db.IsSuppressed(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.True(t, erased)
+	})
+
+	t.Run("remembers the hash of an address that is not stored", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		err := db.EraseSubscriber(context.Background(), "me@example.com")
+		require.NoError(t, err)
+
+		erased, err := db.IsSuppressed(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.True(t, erased)
+	})
+}
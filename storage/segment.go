@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"Goo/model"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// segmentColumns to select into a model.Segment.
+const segmentColumns = `id, list_id, name, query, created, updated`
+
+// CreateSegment and return it.
+func (d *Database) CreateSegment(ctx context.Context, s model.Segment) (model.Segment, error) {
+	query := `
+	insert into segments (list_id, name, query)
+	values ($1, $2, $3)
+	returning ` + segmentColumns
+	err := d.DB.GetContext(ctx, &s, query, s.ListID, s.Name, s.Query)
+	return s, err
+}
+
+// GetSegment with the given ID. Returns nil if there is no such segment.
+func (d *Database) GetSegment(ctx context.Context, id int) (*model.Segment, error) {
+	var s model.Segment
+	err := d.DB.GetContext(ctx, &s, `select `+segmentColumns+` from segments where id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetSegments ordered by list and name.
+func (d *Database) GetSegments(ctx context.Context) ([]model.Segment, error) {
+	var segments []model.Segment
+	err := d.DB.SelectContext(ctx, &segments, `select `+segmentColumns+` from segments order by list_id, name, id`)
+	return segments, err
+}
+
+// DeleteSegment with the given ID. Returns false if there is no such segment,
+// and model.ErrSegmentInUse if campaigns are targeted at it.
+func (d *Database) DeleteSegment(ctx context.Context, id int) (bool, error) {
+	var deletedID int
+	query := `
+	delete from segments
+	where id = $1 and not exists (select from campaigns where segment_id = $1)
+	returning id`
+	err := d.DB.GetContext(ctx, &deletedID, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s, err := d.GetSegment(ctx, id)
+			if err != nil || s == nil {
+				return false, err
+			}
+			return false, model.ErrSegmentInUse
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CountSegment of confirmed, unpaused subscribers on the list that match the segment query,
+// which are the ones a campaign targeted at the segment would be sent to.
+func (d *Database) CountSegment(ctx context.Context, listID, query string) (int, error) {
+	condition, args, err := compileSegmentQuery(query, listID)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = d.DB.GetContext(ctx, &count, `
+	select count(*)
+	from newsletter_subscribers s
+	where list_id = $1 and state = 'confirmed' and not paused and (`+condition+`)`, args...)
+	return count, err
+}
+
+// checkSegmentExists on the list of the campaign, if it has a segment, returning model.ErrSegmentNotFound if not.
+func (d *Database) checkSegmentExists(ctx context.Context, c model.Campaign) error {
+	if c.SegmentID == nil {
+		return nil
+	}
+	var exists bool
+	query := `select exists (select from segments where id = $1 and list_id = $2)`
+	if err := d.DB.GetContext(ctx, &exists, query, *c.SegmentID, c.ListID); err != nil {
+		return err
+	}
+	if !exists {
+		return model.ErrSegmentNotFound
+	}
+	return nil
+}
+
+// engagementColumn of deliveries of campaigns on the list to the subscriber s, aggregated with the given function.
+func engagementColumn(aggregate, column string) string {
+	return `(select ` + aggregate + `(` + column + `) from deliveries d where d.list_id = s.list_id and d.email = s.email)`
+}
+
+// segmentFieldColumns are the SQL expressions for model.SegmentFields, on newsletter_subscribers as s.
+// None of them are null, so comparisons are never null, which would leave out subscribers. Subscribers who never
+// opened or clicked count as having done so at -infinity, so last_opened < 2026-01-01 includes them.
+var segmentFieldColumns = map[string]string{
+	"email":        "s.email",
+	"first_name":   "s.first_name",
+	"last_name":    "s.last_name",
+	"state":        "s.state",
+	"frequency":    "s.frequency",
+	"paused":       "s.paused",
+	"tag":          "s.topics",
+	"signed_up":    "s.created::date",
+	"opens":        engagementColumn("count", "opened"),
+	"clicks":       engagementColumn("count", "clicked"),
+	"last_opened":  "coalesce(" + engagementColumn("max", "opened") + "::date, '-infinity')",
+	"last_clicked": "coalesce(" + engagementColumn("max", "clicked") + "::date, '-infinity')",
+}
+
+// compileSegmentQuery into an SQL condition on newsletter_subscribers as s, see model.ParseSegmentQuery.
+// Values are added as parameters after the given args, and all args are returned.
+func compileSegmentQuery(query string, args ...interface{}) (string, []interface{}, error) {
+	f, err := model.ParseSegmentQuery(query)
+	if err != nil {
+		return "", nil, err
+	}
+	c := &segmentCompiler{args: args}
+	condition, err := c.compile(f)
+	return condition, c.args, err
+}
+
+type segmentCompiler struct {
+	args []interface{}
+}
+
+// param for the given value, cast to the given type.
+func (c *segmentCompiler) param(value interface{}, typ string) string {
+	c.args = append(c.args, value)
+	return "$" + strconv.Itoa(len(c.args)) + "::" + typ
+}
+
+func (c *segmentCompiler) compile(f model.SegmentFilter) (string, error) {
+	switch f.Combinator {
+	case model.SegmentNot:
+		// Like the field columns, null conditions count as false, so negating them matches
+		condition, err := c.compile(f.Filters[0])
+		return "coalesce(not (" + condition + "), true)", err
+	case model.SegmentAnd, model.SegmentOr:
+		var conditions []string
+		for _, filter := range f.Filters {
+			condition, err := c.compile(filter)
+			if err != nil {
+				return "", err
+			}
+			conditions = append(conditions, "("+condition+")")
+		}
+		return strings.Join(conditions, " "+string(f.Combinator)+" "), nil
+	default:
+		return c.compileRule(f.Rule)
+	}
+}
+
+func (c *segmentCompiler) compileRule(r model.SegmentRule) (string, error) {
+	column, ok := segmentFieldColumns[r.Field]
+	if key := strings.TrimPrefix(r.Field, model.SegmentAttributePrefix); key != r.Field {
+		column, ok = "coalesce(s.attributes ->> "+c.param(key, "text")+", '')", true
+	}
+	if !ok {
+		return "", fmt.Errorf("unknown segment field %v", r.Field)
+	}
+
+	var value string
+	switch v := r.Value.(type) {
+	case string:
+		value = c.param(v, "text")
+	case int:
+		value = c.param(v, "int")
+	case bool:
+		value = c.param(v, "boolean")
+	case time.Time:
+		value = c.param(v.Format("2006-01-02"), "date")
+	default:
+		return "", fmt.Errorf("unsupported segment value %v", r.Value)
+	}
+
+	if r.Type == model.SegmentTag {
+		condition := column + " @> jsonb_build_array(" + value + ")"
+		if r.Operator == "!=" {
+			condition = "not (" + condition + ")"
+		}
+		return condition, nil
+	}
+	return column + " " + r.Operator + " " + value, nil
+}
@@ -0,0 +1,117 @@
+package storage_test
+
+import (
+	"Goo/integrationtest"
+	"Goo/model"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_CreateSegment(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("creates, lists and deletes segments, unless campaigns use them", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s, err := db.CreateSegment(context.Background(), model.Segment{ListID: "newsletter", Name: "Gophers", Query: `tag = "go"`})
+		require.NoError(t, err)
+		require.NotZero(t, s.ID)
+
+		segments, err := db.GetSegments(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, []model.Segment{s}, segments)
+
+		err = db.CreateList(context.Background(), "golang", "Golang")
+		require.NoError(t, err)
+		_, err = db.CreateCampaign(context.Background(), model.Campaign{ListID: "golang", Subject: "Hello", Text: "Hi", SegmentID: &s.ID})
+		require.ErrorIs(t, err, model.ErrSegmentNotFound)
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi", SegmentID: &s.ID})
+		require.NoError(t, err)
+		require.Equal(t, s.ID, *c.SegmentID)
+
+		_, err = db.DeleteSegment(context.Background(), s.ID)
+		require.ErrorIs(t, err, model.ErrSegmentInUse)
+
+		_, err = db.DeleteCampaignDraft(context.Background(), c.ID)
+		require.NoError(t, err)
+		deleted, err := db.DeleteSegment(context.Background(), s.ID)
+		require.NoError(t, err)
+		require.True(t, deleted)
+		deleted, err = db.DeleteSegment(context.Background(), s.ID)
+		require.NoError(t, err)
+		require.False(t, deleted)
+	})
+}
+
+func TestDatabase_CountSegment(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("counts and adds campaign recipients matching segment queries", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		subscribers := []model.Subscriber{
+			{ListID: "newsletter", Email: "a@example.com", Attributes: model.Attributes{"company": "Acme"}},
+			{ListID: "newsletter", Email: "b@example.com"},
+			{ListID: "newsletter", Email: "c@example.com", Preferences: model.Preferences{FirstName: "Cat"}},
+		}
+		for _, s := range subscribers {
+			token, err := db.SignupForNewsletter(context.Background(), s)
+			require.NoError(t, err)
+			_, err = db.ConfirmNewsletterSignup(context.Background(), "newsletter", token)
+			require.NoError(t, err)
+		}
+		_, err := db.DB.Exec(`
+			update newsletter_subscribers set topics = '["articles"]' where email = 'a@example.com';
+			update newsletter_subscribers set topics = '["articles", "events"]', frequency = 'monthly' where email = 'b@example.com';
+			update newsletter_subscribers set created = '2025-06-01' where email = 'c@example.com'`)
+		require.NoError(t, err)
+
+		c, err := db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi"})
+		require.NoError(t, err)
+		_, err = db.AddCampaignRecipients(context.Background(), c, "", 10)
+		require.NoError(t, err)
+		err = db.MarkCampaignRecipientsQueued(context.Background(), c.ID, []model.Email{"a@example.com", "b@example.com"})
+		require.NoError(t, err)
+		_, err = db.DB.Exec(`update deliveries set opened = now() where email = 'b@example.com'`)
+		require.NoError(t, err)
+
+		tests := map[string]int{
+			`tag = "articles"`:                            2,
+			`tag = "events" OR tag != "articles"`:         2,
+			`NOT tag = "events"`:                          2,
+			`signed_up > 2026-01-01`:                      2,
+			`signed_up <= 2026-01-01`:                     1,
+			`attributes.company = "Acme"`:                 1,
+			`attributes.company != "Acme"`:                2,
+			`frequency = "weekly" AND opens = 0`:          2,
+			`opens > 0 OR first_name = "Cat"`:             2,
+			`last_opened >= 2026-01-01`:                   1,
+			`last_opened < 2026-01-01`:                    2,
+			`last_opened != 2026-01-01`:                   3,
+			`NOT last_opened >= 2026-01-01`:               2,
+			`last_clicked < 2026-01-01`:                   3,
+			`NOT last_clicked = 2026-01-01`:               3,
+			`paused = false AND email != "a@example.com"`: 2,
+		}
+		for query, expected := range tests {
+			count, err := db.CountSegment(context.Background(), "newsletter", query)
+			require.NoError(t, err, query)
+			require.Equal(t, expected, count, query)
+		}
+
+		s, err := db.CreateSegment(context.Background(), model.Segment{ListID: "newsletter", Name: "Articles", Query: `tag = "articles"`})
+		require.NoError(t, err)
+		c, err = db.CreateCampaign(context.Background(), model.Campaign{ListID: "newsletter", Subject: "Hello", Text: "Hi", SegmentID: &s.ID})
+		require.NoError(t, err)
+		_, err = db.AddCampaignRecipients(context.Background(), c, "", 10)
+		require.NoError(t, err)
+		emails, err := db.GetUnqueuedCampaignRecipients(context.Background(), c.ID, false, 10)
+		require.NoError(t, err)
+		require.Equal(t, []model.Email{"a@example.com", "b@example.com"}, emails)
+	})
+}
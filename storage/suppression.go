@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"Goo/model"
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const suppressionColumns = `id, kind, value, reason, expires, created`
+
+// IsSuppressed if there is an unexpired suppression for the email address, its domain, or its erasure hash.
+func (d *Database) IsSuppressed(ctx context.Context, email model.Email) (bool, error) {
+	var suppressed bool
+	query := `
+	select exists (
+		select from suppressions
+		where (expires is null or expires > now()) and (
+			(kind = 'address' and value = lower($1)) or
+			(kind = 'domain' and value = $2) or
+			(kind = 'hash' and value = $3)
+		)
+	)`
+	err := d.DB.GetContext(ctx, &suppressed, query, email, email.Domain(), d.hashEmail(email))
+	return suppressed, err
+}
+
+// GetSuppressions ordered by ID, including expired ones.
+func (d *Database) GetSuppressions(ctx context.Context) ([]model.Suppression, error) {
+	var suppressions []model.Suppression
+	query := `select ` + suppressionColumns + ` from suppressions order by id`
+	err := d.DB.SelectContext(ctx, &suppressions, query)
+	return suppressions, err
+}
+
+// AddSuppression and return it. If the address or domain is suppressed already, its reason and expiry are updated.
+func (d *Database) AddSuppression(ctx context.Context, s model.Suppression) (model.Suppression, error) {
+	err := d.DB.GetContext(ctx, &s, addSuppressionQuery, s.Kind, s.Value, s.Reason, s.Expires)
+	return s, err
+}
+
+const addSuppressionQuery = `
+	insert into suppressions (kind, value, reason, expires)
+	values ($1, $2, $3, $4)
+	on conflict (kind, value) do update set
+		reason = excluded.reason,
+		expires = excluded.expires
+	returning ` + suppressionColumns
+
+// ImportSuppressions in one transaction, like AddSuppression. Returns how many were imported.
+func (d *Database) ImportSuppressions(ctx context.Context, suppressions []model.Suppression) (int, error) {
+	err := d.inTransaction(ctx, func(tx *sqlx.Tx) error {
+		for _, s := range suppressions {
+			if _, err := tx.ExecContext(ctx, addSuppressionQuery, s.Kind, s.Value, s.Reason, s.Expires); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(suppressions), nil
+}
+
+// DeleteSuppression with the given ID. Returns false if there is no such suppression.
+func (d *Database) DeleteSuppression(ctx context.Context, id int) (bool, error) {
+	var deletedID int
+	err := d.DB.GetContext(ctx, &deletedID, `delete from suppressions where id = $1 returning id`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,115 @@
+package storage_test
+
+import (
+	"Goo/integrationtest"
+	"Goo/model"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabase_IsSuppressed(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("matches addresses, domains and erased addresses", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		_, err := db.AddSuppression(context.Background(), model.NewSuppression("me@example.com", model.SuppressionManual, nil))
+		require.NoError(t, err)
+		_, err = db.AddSuppression(context.Background(), model.NewSuppression("example.org", model.SuppressionBounce, nil))
+		require.NoError(t, err)
+		err = db.EraseSubscriber(context.Background(), "erased@example.net")
+		require.NoError(t, err)
+
+		tests := map[model.Email]bool{
+			"me@example.com":     true,
+			"Me@Example.com":     true,
+			"you@example.com":    false,
+			"you@example.org":    true,
+			"you@Example.org":    true,
+			"erased@example.net": true,
+			"you@example.net":    false,
+		}
+		for email, expected := range tests {
+			suppressed, err := db.IsSuppressed(context.Background(), email)
+			require.NoError(t, err)
+			require.Equal(t, expected, suppressed, email)
+		}
+	})
+
+	t.Run("does not match expired suppressions", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		expired := time.Now().Add(-time.Hour)
+		_, err := db.AddSuppression(context.Background(), model.NewSuppression("me@example.com", model.SuppressionManual, &expired))
+		require.NoError(t, err)
+		expires := time.Now().Add(time.Hour)
+		_, err = db.AddSuppression(context.Background(), model.NewSuppression("you@example.com", model.SuppressionManual, &expires))
+		require.NoError(t, err)
+
+		suppressed, err := db.IsSuppressed(context.Background(), "me@example.com")
+		require.NoError(t, err)
+		require.False(t, suppressed)
+
+		suppressed, err = db.IsSuppressed(context.Background(), "you@example.com")
+		require.NoError(t, err)
+		require.True(t, suppressed)
+	})
+}
+
+func TestDatabase_AddSuppression(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("adds, updates, lists and deletes suppressions", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		s, err := db.AddSuppression(context.Background(), model.NewSuppression("me@example.com", model.SuppressionManual, nil))
+		require.NoError(t, err)
+		require.NotZero(t, s.ID)
+		require.False(t, s.Created.IsZero())
+
+		s2, err := db.AddSuppression(context.Background(), model.NewSuppression("me@example.com", model.SuppressionComplaint, nil))
+		require.NoError(t, err)
+		require.Equal(t, s.ID, s2.ID)
+		require.Equal(t, model.SuppressionComplaint, s2.Reason)
+
+		suppressions, err := db.GetSuppressions(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, len(suppressions))
+
+		deleted, err := db.DeleteSuppression(context.Background(), s.ID)
+		require.NoError(t, err)
+		require.True(t, deleted)
+
+		deleted, err = db.DeleteSuppression(context.Background(), s.ID)
+		require.NoError(t, err)
+		require.False(t, deleted)
+	})
+}
+
+func TestDatabase_ImportSuppressions(t *testing.T) {
+	integrationtest.SkipIfShort(t)
+
+	t.Run("imports many suppressions at once", func(t *testing.T) {
+		db, cleanup := integrationtest.CreateDatabase()
+		defer cleanup()
+
+		count, err := db.ImportSuppressions(context.Background(), []model.Suppression{
+			model.NewSuppression("me@example.com", model.SuppressionBounce, nil),
+			model.NewSuppression("example.org", model.SuppressionManual, nil),
+			model.NewSuppression("me@example.com", model.SuppressionComplaint, nil),
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, count)
+
+		suppressions, err := db.GetSuppressions(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 2, len(suppressions))
+		require.Equal(t, model.SuppressionComplaint, suppressions[0].Reason)
+	})
+}
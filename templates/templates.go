@@ -2,6 +2,11 @@ package templates
 
 import _ "embed"
 
+// Index template parameters:
+//
+//	consent_version
+//	issues: list of the latest model.Issue
+//
 //go:embed index.html
 var Index string
 
@@ -10,10 +15,78 @@ var Thanks string
 
 // Confirm template parameters:
 //
+//	list
 //	token
+//	consent_version
 //
 //go:embed confirm.html
 var Confirm string
 
 //go:embed confirmed.html
 var Confirmed string
+
+// Expired template parameters:
+//
+//	list
+//
+//go:embed expired.html
+var Expired string
+
+// Unsubscribe template parameters:
+//
+//	token
+//
+//go:embed unsubscribe.html
+var Unsubscribe string
+
+//go:embed unsubscribed.html
+var Unsubscribed string
+
+// Preferences template parameters:
+//
+//	token
+//	email
+//	first_name
+//	last_name
+//	topics: list of options with Name and Checked
+//	frequencies: list of options with Name and Checked
+//	paused
+//	saved
+//
+//go:embed preferences.html
+var Preferences string
+
+// Archive template parameters:
+//
+//	archive_path: see model.ArchivePath
+//	issues: list of model.Issue
+//	list: model.List
+//	signup: whether the front page signs up to the list
+//
+//go:embed archive.html
+var Archive string
+
+// Issue template parameters:
+//
+//	archive_path: see model.ArchivePath
+//	issue: model.Issue
+//	list: model.List
+//	signup: whether the front page signs up to the list
+//
+//go:embed issue.html
+var Issue string
+
+// Digest templates for campaigns built from feed items use [[ and ]] as delimiters,
+// so the {{keyword}} placeholders of campaign emails are left for personalization when sending.
+// Parameters:
+//
+//	subject
+//	items: list of model.FeedItem
+//
+//go:embed digest.html
+var DigestHTML string
+
+// DigestText template parameters are like for DigestHTML.
+//
+//go:embed digest.txt
+var DigestText string
@@ -41,6 +41,33 @@ func GetDurationOrDefault(name string, defaultV time.Duration) time.Duration {
 	return vAsDuration
 }
 
+func GetBoolOrDefault(name string, defaultV bool) bool {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultV
+	}
+	vAsBool, err := strconv.ParseBool(v)
+	if err != nil {
+		return defaultV
+	}
+	return vAsBool
+}
+
+// GetStringsOrDefault from a comma-separated list, ignoring empty entries.
+func GetStringsOrDefault(name string, defaultV []string) []string {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultV
+	}
+	var values []string
+	for _, value := range strings.Split(v, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // Load environment variables from environment files. Defaults to loading from .env.
 func Load(paths ...string) error {
 	if len(paths) == 0 {
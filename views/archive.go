@@ -0,0 +1,81 @@
+package views
+
+import (
+	"Goo/model"
+	"encoding/xml"
+	"time"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Link      atomLink    `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// ArchiveFeed of the issues as an Atom feed with the title, with links to the archive pages under the archive URL.
+// The feed is as new as the latest issue, or the given time if there are none.
+func ArchiveFeed(archiveURL, title string, issues []model.Issue, now time.Time) ([]byte, error) {
+	updated := now
+	if len(issues) > 0 {
+		updated = issues[0].Sent
+	}
+
+	feed := atomFeed{
+		Title:   title,
+		ID:      archiveURL,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "Goo"},
+		Links: []atomLink{
+			{Href: archiveURL + ".atom", Rel: "self", Type: "application/atom+xml"},
+			{Href: archiveURL, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for _, issue := range issues {
+		entry := atomEntry{
+			Title:     issue.Subject,
+			ID:        archiveURL + "/" + issue.Slug,
+			Published: issue.Sent.UTC().Format(time.RFC3339),
+			Updated:   issue.Sent.UTC().Format(time.RFC3339),
+			Link:      atomLink{Href: archiveURL + "/" + issue.Slug, Rel: "alternate", Type: "text/html"},
+			Content:   atomContent{Type: "html", Body: issue.HTML},
+		}
+		if issue.HTML == "" {
+			entry.Content = atomContent{Type: "text", Body: issue.Text}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
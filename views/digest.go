@@ -0,0 +1,50 @@
+package views
+
+import (
+	"Goo/model"
+	"Goo/templates"
+	"bytes"
+	"html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DigestCampaign HTML and text with the subject and feed items, see templates.DigestHTML.
+// Feed items can contain anything, so keywords like {{unsubscribe_url}} in them are broken up,
+// so they are not replaced for each recipient, see neutraliseKeywords.
+func DigestCampaign(subject string, items []model.FeedItem) (string, string, error) {
+	neutralised := make([]model.FeedItem, len(items))
+	for i, item := range items {
+		item.Title = neutraliseKeywords(item.Title)
+		item.Link = neutraliseKeywords(item.Link)
+		item.Summary = neutraliseKeywords(item.Summary)
+		neutralised[i] = item
+	}
+	data := map[string]interface{}{"subject": subject, "items": neutralised}
+
+	htmlTemplate, err := template.New("digest.html").Delims("[[", "]]").Parse(templates.DigestHTML)
+	if err != nil {
+		return "", "", err
+	}
+	var html bytes.Buffer
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return "", "", err
+	}
+
+	textTemplate, err := texttemplate.New("digest.txt").Delims("[[", "]]").Parse(templates.DigestText)
+	if err != nil {
+		return "", "", err
+	}
+	var text bytes.Buffer
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return "", "", err
+	}
+
+	return html.String(), text.String(), nil
+}
+
+// neutraliseKeywords by putting a zero-width space after each opening brace, which looks the same,
+// but leaves no double braces to start a keyword.
+func neutraliseKeywords(s string) string {
+	return strings.ReplaceAll(s, "{", "{\u200b")
+}
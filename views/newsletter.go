@@ -16,3 +16,27 @@ func NewsletterConfirmPage(path string) (*template.Template, error) {
 func NewsletterConfirmedPage(path string) (*template.Template, error) {
 	return template.New(path).Parse(templates.Confirmed)
 }
+
+func NewsletterExpiredPage(path string) (*template.Template, error) {
+	return template.New(path).Parse(templates.Expired)
+}
+
+func NewsletterUnsubscribePage(path string) (*template.Template, error) {
+	return template.New(path).Parse(templates.Unsubscribe)
+}
+
+func NewsletterUnsubscribedPage(path string) (*template.Template, error) {
+	return template.New(path).Parse(templates.Unsubscribed)
+}
+
+func NewsletterPreferencesPage(path string) (*template.Template, error) {
+	return template.New(path).Parse(templates.Preferences)
+}
+
+func NewsletterArchivePage(path string) (*template.Template, error) {
+	return template.New(path).Parse(templates.Archive)
+}
+
+func NewsletterIssuePage(path string) (*template.Template, error) {
+	return template.New(path).Parse(templates.Issue)
+}